@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"huibitica/internal/achievements"
 	"huibitica/internal/config"
+	"huibitica/internal/events"
 	"huibitica/internal/handlers"
 	"huibitica/internal/logger"
+	"huibitica/internal/models"
+	"huibitica/internal/notify"
 	"huibitica/internal/postgresql"
+	"huibitica/internal/realtime"
+	"huibitica/internal/rollover"
+	"huibitica/internal/webhooks"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -25,7 +33,43 @@ func main() {
 	log.Info().Msg("Database initialized")
 	defer db.Close()
 
-	handler := handlers.NewHandler(db, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go webhooks.NewWorker(db, log).Run(ctx)
+
+	channels := map[string]notify.Channel{
+		models.ChannelWebhook: notify.NewWebhookChannel(),
+	}
+	if cfg.LogChannel {
+		log.Warn().Msg("Log notification channel is enabled, reminders will be written to the log")
+		channels[models.ChannelLog] = notify.NewLogChannel(log)
+	}
+	if cfg.SMTP.Host != "" {
+		channels[models.ChannelEmail] = notify.NewMailer(cfg.SMTP)
+	} else {
+		log.Warn().Msg("SMTP is not configured, email reminders are disabled")
+	}
+	if cfg.WebPush.PrivateKey != "" {
+		push, err := notify.NewWebPushChannel(cfg.WebPush)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to init Web Push")
+		}
+		cfg.WebPush.PublicKey = push.PublicKey()
+		channels[models.ChannelWebPush] = push
+	}
+	go notify.NewScheduler(db, log, channels).Run(ctx)
+
+	hub := events.NewHub(db, log)
+	go hub.Listen(ctx)
+
+	go rollover.NewWorker(db, log, hub).Run(ctx)
+	go achievements.Backfill(ctx, db, log)
+
+	rt := realtime.NewServer(db, log, hub)
+	go rt.Listen(ctx)
+
+	handler := handlers.NewHandler(db, log, cfg, hub, rt)
 
 	_ = handler
 
@@ -38,26 +82,102 @@ func main() {
 	r.Post("/api/habits", handler.NewHabit)
 	r.Post("/api/dailies", handler.NewDaily)
 	r.Post("/api/tasks", handler.NewTask)
+	r.Post("/api/rewards", handler.NewReward)
+	r.Post("/api/users/import", handler.ImportAccount)
+	r.Post("/api/users/import/habitica", handler.ImportHabitica)
+	r.Post("/api/calendar/token", handler.NewCalendarToken)
+	r.Post("/api/tasks/import/ical", handler.ImportICal)
+	r.Post("/api/habits/score", handler.ScoreHabit)
+	r.Post("/api/dailies/complete", handler.CompleteDaily)
+	r.Post("/api/tasks/complete", handler.CompleteTask)
+	r.Post("/api/webhooks", handler.NewWebhook)
+	r.Post("/api/notifications/channels", handler.NewNotificationChannel)
+	r.Post("/api/stream/token", handler.NewStreamToken)
+	r.Post("/api/parties", handler.NewParty)
+	r.Post("/api/parties/invite", handler.InviteToParty)
+	r.Post("/api/parties/invites/accept", handler.AcceptPartyInvite)
+	r.Post("/api/parties/invites/decline", handler.DeclinePartyInvite)
+	r.Post("/api/parties/leave", handler.LeaveParty)
+	r.Post("/api/parties/transfer", handler.TransferPartyOwnership)
+	r.Post("/api/challenges", handler.NewChallenge)
+	r.Post("/api/challenges/join", handler.JoinChallenge)
+	r.Post("/api/challenges/leave", handler.LeaveChallenge)
+	r.Post("/api/quests", handler.StartQuest)
+	r.Post("/api/quests/abandon", handler.AbandonQuest)
+	r.Post("/api/rewards/purchase", handler.PurchaseReward)
+	r.Post("/api/inventory/buy", handler.BuyItem)
+	r.Post("/api/inventory/equip", handler.EquipItem)
+	r.Post("/api/inventory/unequip", handler.UnequipItem)
+	r.Post("/api/inventory/use", handler.UseItem)
+	r.Post("/api/stable/hatch", handler.HatchPet)
+	r.Post("/api/stable/feed", handler.FeedPet)
+	r.Post("/api/class", handler.ChooseClass)
+	r.Post("/api/skills/cast", handler.CastSkill)
+	r.Post("/api/vacations", handler.NewVacation)
+	r.Post("/api/tasks/templates", handler.NewTaskTemplate)
+	r.Post("/api/tasks/templates/apply", handler.ApplyTaskTemplate)
+	r.Post("/api/tasks/dependencies", handler.AddTaskDependency)
 
 	r.Get("/api/users/id", handler.GetUserByID)
 	r.Get("/api/users/username", handler.GetUserByUsername)
 	r.Get("/api/users/email", handler.GetUserByEmail)
 	r.Get("/api/habits", handler.GetHabits)
+	r.Get("/api/habits/history", handler.GetHabitHistory)
 	r.Get("/api/dailies", handler.GetDailies)
 	r.Get("/api/tasks", handler.GetTasks)
+	r.Get("/api/tasks/templates", handler.GetTaskTemplates)
+	r.Get("/api/rewards", handler.GetRewards)
+	r.Get("/api/rewards/purchases", handler.GetRewardPurchases)
+	r.Get("/api/calendar/{token}.ics", handler.CalendarFeed)
+	r.Get("/api/stats", handler.GetStats)
+	r.Get("/api/webhooks", handler.GetWebhooks)
+	r.Get("/api/webhooks/deliveries", handler.GetWebhookDeliveries)
+	r.Get("/api/notifications/settings", handler.GetNotificationSettings)
+	r.Get("/api/notifications/channels", handler.GetNotificationChannels)
+	r.Get("/api/notifications/vapid-key", handler.GetVAPIDPublicKey)
+	r.Get("/api/stream", handler.Stream)
+	r.Get("/api/ws", handler.WebSocket)
+	r.Get("/api/parties", handler.GetParty)
+	r.Get("/api/parties/invites", handler.GetPartyInvites)
+	r.Get("/api/challenges", handler.GetChallenges)
+	r.Get("/api/challenges/leaderboard", handler.GetChallengeLeaderboard)
+	r.Get("/api/quests", handler.GetQuest)
+	r.Get("/api/quests/bosses", handler.GetBosses)
+	r.Get("/api/shop/items", handler.GetShopItems)
+	r.Get("/api/inventory", handler.GetInventory)
+	r.Get("/api/stable", handler.GetStable)
+	r.Get("/api/achievements", handler.GetAchievements)
+	r.Get("/api/classes", handler.GetClasses)
+	r.Get("/api/skills", handler.GetSkills)
+	r.Get("/api/vacations", handler.GetVacations)
+	r.Get("/api/settings", handler.GetSettings)
 
 	r.Put("/api/habits", handler.EditHabit)
 	r.Put("/api/dailies", handler.EditDaily)
 	r.Put("/api/tasks", handler.EditTask)
+	r.Put("/api/rewards", handler.EditReward)
 	r.Put("/api/users/username", handler.EditUserUsername)
 	r.Put("/api/users/email", handler.EditUserEmail)
 	r.Put("/api/users/phone", handler.EditUserPhone)
+	r.Put("/api/users/timezone", handler.EditUserTimezone)
 	r.Put("/api/users/password", handler.EditPassword)
+	r.Put("/api/notifications/settings", handler.EditNotificationSettings)
+	r.Put("/api/parties/privacy", handler.EditPartyPrivacy)
+
+	r.Patch("/api/settings", handler.PatchSettings)
 
 	r.Delete("/api/habits", handler.DeleteHabit)
 	r.Delete("/api/dailies", handler.DeleteDaily)
 	r.Delete("/api/tasks", handler.DeleteTask)
+	r.Delete("/api/tasks/templates", handler.DeleteTaskTemplate)
+	r.Delete("/api/tasks/dependencies", handler.DeleteTaskDependency)
+	r.Delete("/api/rewards", handler.DeleteReward)
 	r.Delete("/api/users", handler.DeleteUser)
+	r.Delete("/api/webhooks", handler.DeleteWebhook)
+	r.Delete("/api/notifications/channels", handler.DeleteNotificationChannel)
+	r.Delete("/api/challenges", handler.DeleteChallenge)
+	r.Delete("/api/stable/pets", handler.ReleasePet)
+	r.Delete("/api/vacations", handler.DeleteVacation)
 
 	http.ListenAndServe(":8080", r)
 }
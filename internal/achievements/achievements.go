@@ -0,0 +1,206 @@
+// Package achievements выдает достижения по правилам из встроенного
+// achievements.json. Правило - порог показателя пользователя (серия,
+// число выполненных задач и т.п.); показатели пересчитываются после
+// событий, которые могут их изменить.
+package achievements
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+type Achievement struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Metric      string `json:"metric"`
+	Goal        int    `json:"goal"`
+}
+
+// triggers - после каких событий какие показатели могли измениться
+var triggers = map[string][]string{
+	events.HabitScored:    {models.MetricHabitGood},
+	events.DailyCompleted: {models.MetricDailyStreak},
+	events.TaskCompleted:  {models.MetricTasksOnTime},
+	events.LevelUp:        {models.MetricLevel},
+	events.QuestUpdated:   {models.MetricQuestsWon},
+}
+
+//go:embed achievements.json
+var definitionsData []byte
+
+// definitionsVersion меняется вместе с achievements.json: по нему Backfill
+// узнает, что правила уже проверены
+var definitionsVersion = fmt.Sprintf("%x", sha256.Sum256(definitionsData))
+
+var Definitions = mustLoadDefinitions(definitionsData)
+
+func mustLoadDefinitions(data []byte) []Achievement {
+	var definitions []Achievement
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		panic(fmt.Sprintf("invalid achievements: %v", err))
+	}
+
+	metrics := map[string]bool{}
+	for _, list := range triggers {
+		for _, metric := range list {
+			metrics[metric] = true
+		}
+	}
+	seen := map[string]bool{}
+	for _, a := range definitions {
+		if !metrics[a.Metric] {
+			panic(fmt.Sprintf("invalid achievements: unknown metric %q of %q", a.Metric, a.Key))
+		}
+		if a.Goal <= 0 {
+			panic(fmt.Sprintf("invalid achievements: goal of %q must be positive", a.Key))
+		}
+		if seen[a.Key] {
+			panic(fmt.Sprintf("invalid achievements: duplicate key %q", a.Key))
+		}
+		seen[a.Key] = true
+	}
+	return definitions
+}
+
+// Metrics - показатели, которые надо пересчитать после события
+func Metrics(eventType string) []string {
+	return triggers[eventType]
+}
+
+// allMetrics - показатели всех правил, для полной проверки
+func allMetrics() []string {
+	var metrics []string
+	seen := map[string]bool{}
+	for _, a := range Definitions {
+		if !seen[a.Metric] {
+			seen[a.Metric] = true
+			metrics = append(metrics, a.Metric)
+		}
+	}
+	return metrics
+}
+
+// Reached - ключи достижений, пороги которых достигнуты при данных значениях
+// показателей. Показатели, которых нет в values, не проверяются.
+func Reached(values map[string]int) []string {
+	var keys []string
+	for _, a := range Definitions {
+		if value, ok := values[a.Metric]; ok && value >= a.Goal {
+			keys = append(keys, a.Key)
+		}
+	}
+	return keys
+}
+
+func Find(key string) (Achievement, bool) {
+	for _, a := range Definitions {
+		if a.Key == key {
+			return a, true
+		}
+	}
+	return Achievement{}, false
+}
+
+// Check пересчитывает показатели и выдает новые достижения
+func Check(userID int, metrics []string, conn *pgxpool.Pool) ([]models.UserAchievement, error) {
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+	values, err := postgresql.GetAchievementMetrics(userID, metrics, conn)
+	if err != nil {
+		return nil, err
+	}
+	return postgresql.UnlockAchievements(userID, Reached(values), conn)
+}
+
+// Progress - все достижения: полученные с датой и закрытые с текущим
+// значением показателя
+func Progress(userID int, conn *pgxpool.Pool) ([]models.AchievementProgress, error) {
+	values, err := postgresql.GetAchievementMetrics(userID, allMetrics(), conn)
+	if err != nil {
+		return nil, err
+	}
+	unlocked, err := postgresql.GetUserAchievements(userID, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make([]models.AchievementProgress, 0, len(Definitions))
+	for _, a := range Definitions {
+		p := models.AchievementProgress{
+			Key:         a.Key,
+			Name:        a.Name,
+			Description: a.Description,
+			Goal:        a.Goal,
+			Progress:    min(values[a.Metric], a.Goal),
+		}
+		if at, ok := unlocked[a.Key]; ok {
+			p.Unlocked = true
+			p.UnlockedAt = &at
+			p.Progress = a.Goal
+		}
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
+
+const backfillBatch = 500
+
+// Backfill проверяет все правила для всех пользователей - нужно после
+// добавления новых достижений, чтобы их получили за уже накопленные данные.
+// Выполняется один раз на версию achievements.json: остальные запуски и
+// экземпляры сервера ее пропускают. События при этом не рассылаются.
+func Backfill(ctx context.Context, conn *pgxpool.Pool, log zerolog.Logger) {
+	claimed, err := postgresql.ClaimAchievementBackfill(definitionsVersion, conn)
+	if err != nil {
+		log.Error().Err(err).Msg("Achievements backfill failed")
+		return
+	}
+	if !claimed {
+		log.Debug().Str("version", definitionsVersion).Msg("Achievements are already backfilled")
+		return
+	}
+	release := func() {
+		if err := postgresql.ReleaseAchievementBackfill(definitionsVersion, conn); err != nil {
+			log.Error().Err(err).Msg("Failed to release achievements backfill")
+		}
+	}
+
+	metrics := allMetrics()
+	unlocked, afterID := 0, 0
+	for {
+		ids, err := postgresql.GetUserIDsAfter(afterID, backfillBatch, conn)
+		if err != nil {
+			log.Error().Err(err).Msg("Achievements backfill failed")
+			release()
+			return
+		}
+		for _, userID := range ids {
+			if ctx.Err() != nil {
+				release()
+				return
+			}
+			got, err := Check(userID, metrics, conn)
+			if err != nil {
+				log.Error().Int("user_id", userID).Err(err).Msg("Failed to backfill achievements")
+				continue
+			}
+			unlocked += len(got)
+		}
+		if len(ids) < backfillBatch {
+			break
+		}
+		afterID = ids[len(ids)-1]
+	}
+	log.Info().Int("unlocked", unlocked).Msg("Achievements backfill finished")
+}
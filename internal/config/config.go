@@ -14,6 +14,12 @@ type Config struct {
 	PostgreAddress string `yaml:"postgre_address"`
 	DBName         string `yaml:"db_name" env-default:"huibitica"`
 	HTTPServer     `yaml:"http_server"`
+	SMTP           `yaml:"smtp"`
+	WebPush        `yaml:"web_push"`
+	WebSocket      `yaml:"websocket"`
+	// LogChannel включает канал уведомлений "log", который пишет
+	// напоминания в лог сервера. Только для разработки.
+	LogChannel bool `yaml:"log_channel" env:"LOG_CHANNEL"`
 }
 
 type HTTPServer struct {
@@ -22,6 +28,31 @@ type HTTPServer struct {
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 }
 
+// SMTP - почтовый сервер для напоминаний. Пустой Host отключает отправку.
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from" env-default:"huibitica@localhost"`
+}
+
+// WebPush - VAPID-ключи в base64url: публичный в несжатом виде (65 байт),
+// приватный - скаляр P-256 (32 байта). Subject - контакт для push-сервисов,
+// "mailto:..." или URL. Пустой PrivateKey отключает Web Push.
+type WebPush struct {
+	PublicKey  string `yaml:"vapid_public_key"`
+	PrivateKey string `yaml:"vapid_private_key" env:"VAPID_PRIVATE_KEY"`
+	Subject    string `yaml:"vapid_subject" env-default:"mailto:admin@localhost"`
+}
+
+// WebSocket - с каких сайтов браузеру можно открывать /api/ws, например
+// "https://app.example.com". Запросы со своего хоста и без Origin (не из
+// браузера) разрешены всегда.
+type WebSocket struct {
+	AllowedOrigins []string `yaml:"allowed_origins" env:"WS_ALLOWED_ORIGINS" env-separator:","`
+}
+
 func MustLoad() *Config {
 	_ = godotenv.Load("local.env")
 	configPath := os.Getenv("CONFIG_PATH")
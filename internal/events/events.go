@@ -0,0 +1,53 @@
+package events
+
+import "time"
+
+const (
+	HabitScored         = "habit.scored"
+	DailyCompleted      = "daily.completed"
+	TaskCompleted       = "task.completed"
+	LevelUp             = "user.level_up"
+	ItemCreated         = "item.created"
+	ItemUpdated         = "item.updated"
+	ItemDeleted         = "item.deleted"
+	StatsUpdated        = "stats.updated"
+	PartyUpdated        = "party.updated"
+	DailyMissed         = "daily.missed"
+	QuestUpdated        = "quest.updated"
+	RewardPurchased     = "reward.purchased"
+	ItemDropped         = "item.dropped"
+	AchievementUnlocked = "achievement.unlocked"
+	SkillCast           = "skill.cast"
+
+	// All - подписка на все события
+	All = "*"
+)
+
+var Types = []string{HabitScored, DailyCompleted, TaskCompleted, LevelUp,
+	ItemCreated, ItemUpdated, ItemDeleted, StatsUpdated, PartyUpdated, DailyMissed, QuestUpdated, RewardPurchased, ItemDropped,
+	AchievementUnlocked, SkillCast}
+
+type Event struct {
+	// ID присваивается при публикации и растет монотонно
+	ID        int64     `json:"id,omitempty"`
+	Type      string    `json:"event"`
+	UserID    int       `json:"user_id"`
+	Data      any       `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func New(eventType string, userID int, data any) Event {
+	return Event{Type: eventType, UserID: userID, Data: data, CreatedAt: time.Now().UTC()}
+}
+
+func Valid(eventType string) bool {
+	if eventType == All {
+		return true
+	}
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+const (
+	subscriberBuffer = 64
+	retention        = 24 * time.Hour
+	reconnectDelay   = 5 * time.Second
+)
+
+// Hub - pub/sub событий пользователя. Publish пишет событие в журнал
+// event_log и шлет NOTIFY; Listen на каждом экземпляре сервера получает
+// уведомление и раздает событие локальным подписчикам. Так события доходят
+// до клиентов, подключенных к любому экземпляру, а журнал позволяет
+// продолжить поток после переподключения.
+type Hub struct {
+	db  *pgxpool.Pool
+	log zerolog.Logger
+
+	mu          sync.Mutex
+	subscribers map[int]map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	userID int
+	hub    *Hub
+	closed bool
+}
+
+func NewHub(db *pgxpool.Pool, log zerolog.Logger) *Hub {
+	return &Hub{db: db, log: log, subscribers: map[int]map[*Subscription]struct{}{}}
+}
+
+// Publish сохраняет событие и возвращает его с присвоенным ID
+func (h *Hub) Publish(event Event) (Event, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return event, fmt.Errorf("failed to encode event data: %w", err)
+	}
+
+	event.ID, event.CreatedAt, err = postgresql.AppendEvent(event.UserID, event.Type, data, h.db)
+	if err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+func (h *Hub) Subscribe(userID int) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, userID: userID, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[userID][sub] = struct{}{}
+	return sub
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// remove вызывается под h.mu
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+	delete(h.subscribers[sub.userID], sub)
+	if len(h.subscribers[sub.userID]) == 0 {
+		delete(h.subscribers, sub.userID)
+	}
+}
+
+// dispatch раздает событие локальным подписчикам. Медленный подписчик,
+// у которого переполнен буфер, отключается - клиент переподключится
+// с Last-Event-ID и доберет пропущенное из журнала.
+func (h *Hub) dispatch(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			h.log.Warn().Int("user_id", event.UserID).Msg("Event subscriber is too slow, dropping")
+			h.remove(sub)
+		}
+	}
+}
+
+// Since возвращает сохраненные события пользователя после lastID
+func (h *Hub) Since(userID int, lastID int64, limit int) ([]Event, error) {
+	records, err := postgresql.GetEventsSince(userID, lastID, limit, h.db)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(records))
+	for _, record := range records {
+		events = append(events, fromRecord(record))
+	}
+	return events, nil
+}
+
+// Replay передает в fn все сохраненные события пользователя после lastID,
+// читая журнал страницами по pageSize, и возвращает ID последнего
+// переданного. Ошибка fn прерывает повтор.
+func (h *Hub) Replay(userID int, lastID int64, pageSize int, fn func(Event) error) (int64, error) {
+	for {
+		page, err := h.Since(userID, lastID, pageSize)
+		if err != nil {
+			return lastID, err
+		}
+		for _, event := range page {
+			if err := fn(event); err != nil {
+				return lastID, err
+			}
+			lastID = event.ID
+		}
+		if len(page) < pageSize {
+			return lastID, nil
+		}
+	}
+}
+
+// Listen слушает NOTIFY от всех экземпляров сервера до отмены ctx,
+// переподключаясь при обрыве, и заодно чистит старые записи журнала.
+func (h *Hub) Listen(ctx context.Context) {
+	go h.cleanup(ctx)
+
+	for {
+		if err := h.listen(ctx); err != nil && ctx.Err() == nil {
+			h.log.Error().Err(err).Msg("Event listener failed, reconnecting")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (h *Hub) listen(ctx context.Context) error {
+	conn, err := h.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+postgresql.EventsChannel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			h.log.Warn().Str("payload", notification.Payload).Msg("Invalid event notification")
+			continue
+		}
+
+		record, err := postgresql.GetEvent(id, h.db)
+		if err != nil {
+			h.log.Error().Int64("event_id", id).Err(err).Msg("Failed to load event")
+			continue
+		}
+		h.dispatch(fromRecord(*record))
+	}
+}
+
+func (h *Hub) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := postgresql.DeleteEventsBefore(time.Now().Add(-retention), h.db); err != nil {
+			h.log.Error().Err(err).Msg("Failed to clean up event log")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func fromRecord(record models.EventRecord) Event {
+	return Event{
+		ID:        record.ID,
+		Type:      record.Type,
+		UserID:    record.UserID,
+		Data:      json.RawMessage(record.Data),
+		CreatedAt: record.CreatedAt,
+	}
+}
@@ -0,0 +1,148 @@
+package game
+
+import (
+	"huibitica/internal/models"
+	"time"
+)
+
+// Классы персонажа
+const (
+	ClassWarrior = "warrior"
+	ClassMage    = "mage"
+	ClassHealer  = "healer"
+	ClassRogue   = "rogue"
+)
+
+const (
+	// ClassLevel - с какого уровня можно выбрать класс
+	ClassLevel = 10
+	// ClassChangeCost - цена смены уже выбранного класса в золоте
+	ClassChangeCost = 100
+	// classGrowthLevels - раз в сколько уровней растут характеристики класса
+	classGrowthLevels = 5
+)
+
+// Умения классов
+const (
+	SkillPowerStrike = "power_strike"
+	SkillEmpower     = "empower"
+	SkillHealParty   = "heal_party"
+	SkillStealth     = "stealth"
+)
+
+const (
+	PowerStrikeDamage = 25
+	HealPartyHP       = 15
+)
+
+type Class struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	// Growth - прибавка характеристик на каждые classGrowthLevels уровней
+	Growth Bonuses `json:"growth"`
+	Skills []Skill `json:"skills"`
+}
+
+type Skill struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Mana        int    `json:"mana"`
+	// Cooldown - в минутах
+	Cooldown int `json:"cooldown"`
+	// Target - умению нужен target_id (идентификатор задачи)
+	Target bool `json:"target,omitempty"`
+}
+
+func (s Skill) CooldownDuration() time.Duration {
+	return time.Duration(s.Cooldown) * time.Minute
+}
+
+var Classes = []Class{
+	{
+		Key:    ClassWarrior,
+		Name:   "Воин",
+		Growth: Bonuses{Strength: 1, Constitution: 1},
+		Skills: []Skill{{
+			Key:         SkillPowerStrike,
+			Name:        "Сокрушительный удар",
+			Description: "Наносит боссу квеста группы 25 урона",
+			Mana:        10,
+			Cooldown:    60,
+		}},
+	},
+	{
+		Key:    ClassMage,
+		Name:   "Маг",
+		Growth: Bonuses{Intelligence: 2},
+		Skills: []Skill{{
+			Key:         SkillEmpower,
+			Name:        "Усиление",
+			Description: "Повышает сложность невыполненной задачи на 1, а с ней и награду",
+			Mana:        15,
+			Cooldown:    30,
+			Target:      true,
+		}},
+	},
+	{
+		Key:    ClassHealer,
+		Name:   "Целитель",
+		Growth: Bonuses{Constitution: 2},
+		Skills: []Skill{{
+			Key:         SkillHealParty,
+			Name:        "Исцеление группы",
+			Description: "Восстанавливает 15 здоровья себе и всем участникам группы",
+			Mana:        20,
+			Cooldown:    120,
+		}},
+	},
+	{
+		Key:    ClassRogue,
+		Name:   "Разбойник",
+		Growth: Bonuses{Perception: 2},
+		Skills: []Skill{{
+			Key:         SkillStealth,
+			Name:        "Скрытность",
+			Description: "Пропуски ежедневных задач сегодня не сбросят серии и не нанесут урона",
+			Mana:        15,
+			Cooldown:    24 * 60,
+		}},
+	},
+}
+
+func FindClass(key string) (Class, bool) {
+	for _, class := range Classes {
+		if class.Key == key {
+			return class, true
+		}
+	}
+	return Class{}, false
+}
+
+// FindSkill возвращает умение и класс, которому оно принадлежит
+func FindSkill(key string) (Skill, string, bool) {
+	for _, class := range Classes {
+		for _, skill := range class.Skills {
+			if skill.Key == key {
+				return skill, class.Key, true
+			}
+		}
+	}
+	return Skill{}, "", false
+}
+
+// ClassBonuses - прирост характеристик класса на уровне level: первая
+// прибавка сразу при выборе, дальше каждые classGrowthLevels уровней
+func ClassBonuses(class string, level int) Bonuses {
+	c, ok := FindClass(class)
+	if !ok || level < ClassLevel {
+		return Bonuses{}
+	}
+	return c.Growth.Scale((level-ClassLevel)/classGrowthLevels + 1)
+}
+
+// Heal восстанавливает здоровье, не превышая максимума
+func Heal(stats models.Stats, hp int) models.Stats {
+	stats.HP = min(stats.HP+hp, MaxHP)
+	return stats
+}
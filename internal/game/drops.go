@@ -0,0 +1,128 @@
+package game
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Виды выпадающих предметов. В инвентаре они хранятся под ключом
+// "<вид>:<ключ>", например "egg:wolf".
+const (
+	DropEgg            = "egg"
+	DropHatchingPotion = "hatching_potion"
+	DropFood           = "food"
+)
+
+const (
+	// DropDailyCap - сколько предметов может выпасть пользователю за день
+	DropDailyCap = 5
+	// FeedPoints - насколько еда насыщает питомца; насытившись до
+	// MountFullness, питомец становится ездовым
+	FeedPoints    = 10
+	MountFullness = 50
+)
+
+var (
+	Eggs            = []string{"wolf", "fox", "cat", "owl", "dragon"}
+	HatchingPotions = []string{"base", "red", "golden", "shadow"}
+	Foods           = []string{"meat", "milk", "honey", "cake"}
+)
+
+type Drop struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+}
+
+// InventoryKey - ключ предмета в инвентаре
+func (d Drop) InventoryKey() string {
+	return d.Kind + ":" + d.Key
+}
+
+// Dropper - генератор выпадений. Одинаковое зерно дает одинаковую
+// последовательность, поэтому результат воспроизводим.
+type Dropper struct {
+	rng *rand.Rand
+}
+
+func NewDropper(seed uint64) *Dropper {
+	return &Dropper{rng: rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))}
+}
+
+// DropSeed - зерно для броска номер roll пользователя в день day. Так
+// повтор запроса не меняет исход, а разные броски за день независимы.
+func DropSeed(userID int, day time.Time, roll int) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(userID))
+	h.Write(buf[:])
+	h.Write([]byte(day.Format(time.DateOnly)))
+	binary.BigEndian.PutUint64(buf[:], uint64(roll))
+	h.Write(buf[:])
+	return h.Sum64()
+}
+
+// DropChance - вероятность выпадения за действие сложности 1..5
+func DropChance(difficulty int) float64 {
+	return 0.1 + 0.05*float64(difficulty)
+}
+
+// Roll решает, выпадет ли что-нибудь за действие, и что именно:
+// яйцо (40%), инкубационный эликсир (30%) или еда (30%)
+func (d *Dropper) Roll(difficulty int) (Drop, bool) {
+	if d.rng.Float64() >= DropChance(difficulty) {
+		return Drop{}, false
+	}
+
+	kind := d.rng.IntN(10)
+	switch {
+	case kind < 4:
+		return Drop{Kind: DropEgg, Key: Eggs[d.rng.IntN(len(Eggs))]}, true
+	case kind < 7:
+		return Drop{Kind: DropHatchingPotion, Key: HatchingPotions[d.rng.IntN(len(HatchingPotions))]}, true
+	default:
+		return Drop{Kind: DropFood, Key: Foods[d.rng.IntN(len(Foods))]}, true
+	}
+}
+
+// DailyDrop - бросок номер roll пользователя за день day, если за этот
+// день у него выпало меньше DropDailyCap предметов (dropped)
+func DailyDrop(userID int, day time.Time, roll int, dropped int, difficulty int) (Drop, bool) {
+	if dropped >= DropDailyCap {
+		return Drop{}, false
+	}
+	return NewDropper(DropSeed(userID, day, roll)).Roll(difficulty)
+}
+
+// PetKey - питомец из яйца и эликсира, например "wolf-golden"
+func PetKey(egg string, potion string) string {
+	return egg + "-" + potion
+}
+
+func ValidPet(pet string) bool {
+	egg, potion, ok := strings.Cut(pet, "-")
+	return ok && contains(Eggs, egg) && contains(HatchingPotions, potion)
+}
+
+func ValidDrop(kind string, key string) bool {
+	switch kind {
+	case DropEgg:
+		return contains(Eggs, key)
+	case DropHatchingPotion:
+		return contains(HatchingPotions, key)
+	case DropFood:
+		return contains(Foods, key)
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package game
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+type rollResult struct {
+	drop Drop
+	ok   bool
+}
+
+func rollSequence(seed uint64, difficulty int, n int) []rollResult {
+	dropper := NewDropper(seed)
+	results := make([]rollResult, n)
+	for i := range results {
+		drop, ok := dropper.Roll(difficulty)
+		results[i] = rollResult{drop, ok}
+	}
+	return results
+}
+
+func TestDropperRollIsDeterministic(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	seed := DropSeed(42, day, 3)
+
+	first, second := rollSequence(seed, 3, 100), rollSequence(seed, 3, 100)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("roll %d: %v, then %v with the same seed", i, first[i], second[i])
+		}
+	}
+}
+
+func TestDropSeed(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	seed := DropSeed(42, day, 3)
+
+	// Семя зависит только от даты, а не от времени внутри дня
+	if got := DropSeed(42, day.Add(15*time.Hour), 3); got != seed {
+		t.Errorf("seed changed within the day: %d, want %d", got, seed)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		day    time.Time
+		roll   int
+	}{
+		{"other user", 43, day, 3},
+		{"other day", 42, day.AddDate(0, 0, 1), 3},
+		{"other roll", 42, day, 4},
+	}
+	for _, tt := range tests {
+		if DropSeed(tt.userID, tt.day, tt.roll) == seed {
+			t.Errorf("%s: seed did not change", tt.name)
+		}
+	}
+}
+
+func TestDropChanceByDifficulty(t *testing.T) {
+	const rolls = 20000
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		difficulty int
+		want       float64
+	}{
+		{1, 0.15},
+		{2, 0.20},
+		{3, 0.25},
+		{4, 0.30},
+		{5, 0.35},
+	}
+	for _, tt := range tests {
+		if got := DropChance(tt.difficulty); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("DropChance(%d) = %v, want %v", tt.difficulty, got, tt.want)
+		}
+
+		// Один бросок на зерно, как в RollDrop
+		drops := 0
+		for roll := 0; roll < rolls; roll++ {
+			drop, ok := NewDropper(DropSeed(1, day, roll)).Roll(tt.difficulty)
+			if !ok {
+				continue
+			}
+			drops++
+			if !ValidDrop(drop.Kind, drop.Key) {
+				t.Errorf("difficulty %d: invalid drop %+v", tt.difficulty, drop)
+			}
+		}
+		if got := float64(drops) / rolls; math.Abs(got-tt.want) > 0.015 {
+			t.Errorf("difficulty %d: dropped in %.3f of rolls, want about %.2f", tt.difficulty, got, tt.want)
+		}
+	}
+}
+
+func TestDailyDropCap(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	dropped := 0
+	for roll := 0; roll < 200; roll++ {
+		drop, ok := DailyDrop(7, day, roll, dropped, 5)
+		if dropped >= DropDailyCap {
+			if ok {
+				t.Fatalf("roll %d: dropped %+v over the daily cap", roll, drop)
+			}
+			continue
+		}
+		if want, wantOK := NewDropper(DropSeed(7, day, roll)).Roll(5); drop != want || ok != wantOK {
+			t.Fatalf("roll %d: DailyDrop = %+v %v, Roll = %+v %v", roll, drop, ok, want, wantOK)
+		}
+		if ok {
+			dropped++
+		}
+	}
+	if dropped != DropDailyCap {
+		t.Errorf("dropped %d items in 200 rolls, want the cap %d", dropped, DropDailyCap)
+	}
+}
@@ -0,0 +1,97 @@
+package game
+
+import (
+	"huibitica/internal/models"
+	"math"
+)
+
+const (
+	MaxHP       = 50
+	BaseMana    = 10
+	xpPerPoint  = 10
+	goldPerUnit = 2
+	hpPerPoint  = 2
+)
+
+func NewStats(userID int) models.Stats {
+	return models.Stats{UserID: userID, Level: 1, HP: MaxHP, Mana: BaseMana}
+}
+
+// XPToLevelUp - сколько опыта нужно набрать на уровне level, чтобы перейти
+// на следующий
+func XPToLevelUp(level int) int {
+	return 100 + (level-1)*25
+}
+
+func MaxMana(level int) int {
+	return BaseMana + (level-1)*2
+}
+
+// Reward - опыт и золото за положительное действие со сложностью 1..5
+func Reward(difficulty int) (xp int, gold int) {
+	return difficulty * xpPerPoint, difficulty * goldPerUnit
+}
+
+// Damage - урон здоровью за отрицательное действие или пропуск
+func Damage(difficulty int) int {
+	return difficulty * hpPerPoint
+}
+
+// Score применяет к статам результат действия с учетом бонусов
+// снаряжения. positive - выполнение задачи или "+" у привычки, иначе "-"
+// у привычки.
+func Score(stats models.Stats, bonuses Bonuses, difficulty int, positive bool) models.ScoreResult {
+	return ScoreScaled(stats, bonuses, difficulty, positive, 1)
+}
+
+// ScoreScaled - как Score, но награда или урон умножаются на multiplier
+// (для привычек - HabitDelta)
+func ScoreScaled(stats models.Stats, bonuses Bonuses, difficulty int, positive bool, multiplier float64) models.ScoreResult {
+	if positive {
+		xp, gold := Reward(difficulty)
+		return Gain(stats, bonuses.XP(scale(xp, multiplier)), bonuses.Gold(scale(gold, multiplier)))
+	}
+	return Hurt(stats, bonuses.Damage(scale(Damage(difficulty), multiplier)))
+}
+
+func scale(n int, multiplier float64) int {
+	return int(math.Round(float64(n) * multiplier))
+}
+
+// Gain начисляет опыт и золото с повышением уровня
+func Gain(stats models.Stats, xp int, gold int) models.ScoreResult {
+	result := models.ScoreResult{DeltaXP: xp, DeltaGold: gold}
+
+	stats.XP += xp
+	stats.Gold += gold
+	for stats.XP >= XPToLevelUp(stats.Level) {
+		stats.XP -= XPToLevelUp(stats.Level)
+		stats.Level++
+		stats.HP = MaxHP
+		result.LeveledUp = true
+	}
+	stats.Mana = min(stats.Mana+1, MaxMana(stats.Level))
+
+	result.Stats = stats
+	return result
+}
+
+// Hurt снимает здоровье. При падении здоровья до нуля персонаж теряет
+// уровень и все золото, здоровье восстанавливается.
+func Hurt(stats models.Stats, damage int) models.ScoreResult {
+	result := models.ScoreResult{DeltaHP: -damage}
+
+	stats.HP -= damage
+	if stats.HP <= 0 {
+		result.Died = true
+		result.DeltaGold = -stats.Gold
+		stats.Level = max(stats.Level-1, 1)
+		stats.XP = 0
+		stats.Gold = 0
+		stats.HP = MaxHP
+		stats.Mana = min(stats.Mana, MaxMana(stats.Level))
+	}
+
+	result.Stats = stats
+	return result
+}
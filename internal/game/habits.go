@@ -0,0 +1,78 @@
+package game
+
+import "math"
+
+// Сила привычки (Habit.Value), как в Habitica. Каждая отметка сдвигает
+// значение на
+//
+//	delta = ValueBase ^ value
+//
+// вверх для "+" и вниз для "-". Чем слабее привычка (value < 0), тем
+// больше delta, так что "+" у слабой привычки ценится выше, а "-" бьет
+// сильнее; у сильной привычки наоборот. На ту же delta умножаются опыт,
+// золото и урон. Значение ограничено [MinHabitValue, MaxHabitValue],
+// поэтому delta лежит примерно в [0.58, 3.36].
+//
+// Привычки только с "+" или только с "-" при смене дня теряют часть
+// значения (HabitDecay) и дрейфуют к нулю: одна кнопка не может
+// бесконечно копить силу или слабость. У привычек с обеими кнопками
+// значение уравновешивают сами отметки.
+const (
+	ValueBase     = 0.9747
+	MinHabitValue = -47.27
+	MaxHabitValue = 21.27
+	HabitDecay    = 0.5
+	// Меньшие по модулю значения после дрейфа обнуляются
+	HabitDecaySnap = 0.1
+)
+
+// Уровни силы привычки для раскраски в клиентах, от худшего к лучшему
+const (
+	StrengthWorst   = "worst"
+	StrengthWorse   = "worse"
+	StrengthBad     = "bad"
+	StrengthNeutral = "neutral"
+	StrengthGood    = "good"
+	StrengthBetter  = "better"
+	StrengthBest    = "best"
+)
+
+// HabitDelta - на сколько сдвинется значение value при отметке, она же
+// множитель награды или урона
+func HabitDelta(value float64) float64 {
+	return math.Pow(ValueBase, ClampHabitValue(value))
+}
+
+// ScoreHabitValue - новое значение привычки после отметки и множитель
+// награды
+func ScoreHabitValue(value float64, up bool) (next float64, multiplier float64) {
+	delta := HabitDelta(value)
+	if up {
+		return ClampHabitValue(value + delta), delta
+	}
+	return ClampHabitValue(value - delta), delta
+}
+
+func ClampHabitValue(value float64) float64 {
+	return min(max(value, MinHabitValue), MaxHabitValue)
+}
+
+// HabitStrength - уровень силы по значению, границы как у цветов Habitica
+func HabitStrength(value float64) string {
+	switch {
+	case value < -20:
+		return StrengthWorst
+	case value < -10:
+		return StrengthWorse
+	case value < -1:
+		return StrengthBad
+	case value < 1:
+		return StrengthNeutral
+	case value < 5:
+		return StrengthGood
+	case value < 10:
+		return StrengthBetter
+	default:
+		return StrengthBest
+	}
+}
@@ -0,0 +1,144 @@
+package game
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/models"
+)
+
+// Типы предметов. Снаряжение (все, кроме зелий и заморозок) надевается
+// в слот с именем своего типа, по одному предмету на слот. Заморозка
+// расходуется сама при смене дня: спасает серию одной пропущенной
+// ежедневной задачи.
+const (
+	ItemWeapon = "weapon"
+	ItemArmor  = "armor"
+	ItemHead   = "head"
+	ItemShield = "shield"
+	ItemPotion = "potion"
+	ItemFreeze = "freeze"
+)
+
+// StreakFreeze - ключ заморозки серии в каталоге и инвентаре
+const StreakFreeze = "streak_freeze"
+
+// Каждое очко характеристики дает bonusPercent процентов:
+// сила - к опыту, восприятие - к золоту, телосложение - к защите от урона,
+// интеллект - к урону по боссу.
+const bonusPercent = 2
+
+type Bonuses struct {
+	Strength     int `json:"strength,omitempty"`
+	Constitution int `json:"constitution,omitempty"`
+	Intelligence int `json:"intelligence,omitempty"`
+	Perception   int `json:"perception,omitempty"`
+}
+
+func (b Bonuses) Add(other Bonuses) Bonuses {
+	return Bonuses{
+		Strength:     b.Strength + other.Strength,
+		Constitution: b.Constitution + other.Constitution,
+		Intelligence: b.Intelligence + other.Intelligence,
+		Perception:   b.Perception + other.Perception,
+	}
+}
+
+func (b Bonuses) Scale(n int) Bonuses {
+	return Bonuses{
+		Strength:     b.Strength * n,
+		Constitution: b.Constitution * n,
+		Intelligence: b.Intelligence * n,
+		Perception:   b.Perception * n,
+	}
+}
+
+func (b Bonuses) XP(xp int) int {
+	return xp + xp*b.Strength*bonusPercent/100
+}
+
+func (b Bonuses) Gold(gold int) int {
+	return gold + gold*b.Perception*bonusPercent/100
+}
+
+// Damage уменьшает урон, но не больше чем до 1 и не больше чем вдвое
+func (b Bonuses) Damage(damage int) int {
+	if damage <= 0 {
+		return damage
+	}
+	reduction := min(b.Constitution*bonusPercent, 50)
+	return max(damage-damage*reduction/100, 1)
+}
+
+func (b Bonuses) BossDamage(damage int) int {
+	return damage + damage*b.Intelligence*bonusPercent/100
+}
+
+type Item struct {
+	Key     string  `json:"key"`
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Price   int     `json:"price"`
+	Bonuses Bonuses `json:"bonuses"`
+	// Эффект зелья
+	HP   int `json:"hp,omitempty"`
+	Mana int `json:"mana,omitempty"`
+}
+
+func (i Item) Gear() bool {
+	return i.Type != ItemPotion && i.Type != ItemFreeze
+}
+
+//go:embed catalog.json
+var catalogData []byte
+
+// Catalog - предметы магазина из встроенного catalog.json
+var Catalog = mustLoadCatalog(catalogData)
+
+func mustLoadCatalog(data []byte) []Item {
+	var items []Item
+	if err := json.Unmarshal(data, &items); err != nil {
+		panic(fmt.Sprintf("invalid item catalog: %v", err))
+	}
+	seen := map[string]bool{}
+	for _, item := range items {
+		switch item.Type {
+		case ItemWeapon, ItemArmor, ItemHead, ItemShield, ItemPotion, ItemFreeze:
+		default:
+			panic(fmt.Sprintf("invalid item catalog: unknown type %q of %q", item.Type, item.Key))
+		}
+		if seen[item.Key] {
+			panic(fmt.Sprintf("invalid item catalog: duplicate key %q", item.Key))
+		}
+		seen[item.Key] = true
+	}
+	return items
+}
+
+func FindItem(key string) (Item, bool) {
+	for _, item := range Catalog {
+		if item.Key == key {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// EquipmentBonuses суммирует бонусы надетых предметов. Неизвестные
+// ключи (предмет убрали из каталога) пропускаются.
+func EquipmentBonuses(equipped []string) Bonuses {
+	var total Bonuses
+	for _, key := range equipped {
+		if item, ok := FindItem(key); ok {
+			total = total.Add(item.Bonuses)
+		}
+	}
+	return total
+}
+
+// UsePotion применяет зелье к статам, не превышая максимумов
+func UsePotion(stats models.Stats, item Item) models.Stats {
+	stats.HP = min(stats.HP+item.HP, MaxHP)
+	stats.Mana = min(stats.Mana+item.Mana, MaxMana(stats.Level))
+	return stats
+}
@@ -0,0 +1,41 @@
+package game
+
+// Boss - противник квеста группы. Выполненные ежедневные задачи и "+"
+// у привычек бьют босса, пропущенные при смене дня ежедневные задачи
+// дают боссу ударить всю группу с силой Strength за единицу сложности.
+type Boss struct {
+	Key        string `json:"key"`
+	Name       string `json:"name"`
+	HP         int    `json:"hp"`
+	Strength   int    `json:"strength"`
+	RewardXP   int    `json:"reward_xp"`
+	RewardGold int    `json:"reward_gold"`
+}
+
+const bossDamagePerPoint = 4
+
+var Bosses = []Boss{
+	{Key: "procrastinator", Name: "Прокрастинатор", HP: 200, Strength: 1, RewardXP: 100, RewardGold: 25},
+	{Key: "couch_golem", Name: "Диванный голем", HP: 400, Strength: 2, RewardXP: 200, RewardGold: 50},
+	{Key: "deadline_dragon", Name: "Дракон дедлайнов", HP: 800, Strength: 3, RewardXP: 400, RewardGold: 100},
+}
+
+func FindBoss(key string) (Boss, bool) {
+	for _, boss := range Bosses {
+		if boss.Key == key {
+			return boss, true
+		}
+	}
+	return Boss{}, false
+}
+
+// BossDamage - урон боссу от выполненного действия со сложностью 1..5
+func BossDamage(difficulty int) int {
+	return difficulty * bossDamagePerPoint
+}
+
+// BossAttack - урон каждому участнику группы за пропуски с суммарной
+// сложностью missedDifficulty
+func BossAttack(boss Boss, missedDifficulty int) int {
+	return boss.Strength * missedDifficulty
+}
@@ -0,0 +1,215 @@
+package habitica
+
+import (
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/models"
+	"math"
+	"strings"
+	"time"
+)
+
+// Export - часть выгрузки данных Habitica (userdata.json), которую мы умеем
+// переносить. Награды и прочие разделы игнорируются.
+type Export struct {
+	Tasks struct {
+		Habits  []Habit `json:"habits"`
+		Dailies []Daily `json:"dailys"`
+		Todos   []Todo  `json:"todos"`
+	} `json:"tasks"`
+}
+
+type Habit struct {
+	Text        string  `json:"text"`
+	Notes       string  `json:"notes"`
+	Priority    float64 `json:"priority"`
+	Up          bool    `json:"up"`
+	Down        bool    `json:"down"`
+	CounterUp   int     `json:"counterUp"`
+	CounterDown int     `json:"counterDown"`
+	Frequency   string  `json:"frequency"`
+	Value       float64 `json:"value"`
+}
+
+type Daily struct {
+	Text      string          `json:"text"`
+	Notes     string          `json:"notes"`
+	Priority  float64         `json:"priority"`
+	Frequency string          `json:"frequency"`
+	EveryX    int             `json:"everyX"`
+	Repeat    map[string]bool `json:"repeat"`
+	StartDate string          `json:"startDate"`
+	Streak    int             `json:"streak"`
+}
+
+type Todo struct {
+	Text      string          `json:"text"`
+	Notes     string          `json:"notes"`
+	Priority  float64         `json:"priority"`
+	Date      string          `json:"date"`
+	Completed bool            `json:"completed"`
+	Checklist []ChecklistItem `json:"checklist"`
+}
+
+type ChecklistItem struct {
+	Text      string `json:"text"`
+	Completed bool   `json:"completed"`
+}
+
+// Ключи Habitica в поле repeat в порядке models.WeekDays
+var repeatKeys = [7]string{"su", "m", "t", "w", "th", "f", "s"}
+
+func Parse(data []byte) (*Export, error) {
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid habitica export: %w", err)
+	}
+	return &export, nil
+}
+
+// Convert переводит выгрузку в наш формат. now используется как дата начала
+// для ежедневных задач и как срок для задач без даты. Выполненные задачи
+// не переносятся.
+func (e *Export) Convert(now time.Time) models.AccountData {
+	var data models.AccountData
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	for _, h := range e.Tasks.Habits {
+		data.Habits = append(data.Habits, models.Habit{
+			Text:       models.Truncate(h.Text, models.MaxTextLength),
+			Note:       models.Truncate(h.Notes, models.MaxNoteLength),
+			Good:       h.Up,
+			Bad:        h.Down,
+			Difficulty: Difficulty(h.Priority),
+			CountReset: CountReset(h.Frequency),
+			GoodCount:  max(h.CounterUp, 0),
+			BadCount:   max(h.CounterDown, 0),
+			Value:      h.Value,
+		})
+	}
+
+	for _, d := range e.Tasks.Dailies {
+		startDate := parseDate(d.StartDate)
+		if startDate.IsZero() {
+			startDate = today
+		}
+
+		data.Dailies = append(data.Dailies, models.Daily{
+			Text:         models.Truncate(d.Text, models.MaxTextLength),
+			Note:         models.Truncate(d.Notes, models.MaxNoteLength),
+			Difficulty:   Difficulty(d.Priority),
+			StartDate:    startDate,
+			RepeatEvery:  RepeatEvery(d.Frequency),
+			RepeatEveryX: max(d.EveryX, 1),
+			DayWeeks:     DayWeeks(d.Repeat),
+			Streak:       max(d.Streak, 0),
+		})
+	}
+
+	for _, t := range e.Tasks.Todos {
+		if t.Completed {
+			continue
+		}
+
+		deadline := parseDate(t.Date)
+		if deadline.IsZero() {
+			deadline = today
+		}
+
+		data.Tasks = append(data.Tasks, models.Task{
+			Name:       models.Truncate(t.Text, models.MaxTextLength),
+			Note:       models.Truncate(noteWithChecklist(t.Notes, t.Checklist), models.MaxNoteLength),
+			Difficulty: Difficulty(t.Priority),
+			Deadline:   deadline,
+		})
+	}
+
+	return data
+}
+
+// Difficulty переводит priority Habitica (0.1, 1, 1.5, 2) в нашу шкалу 1..5
+func Difficulty(priority float64) int {
+	switch {
+	case priority <= 0.1:
+		return 1
+	case priority <= 1:
+		return 2
+	case priority <= 1.5:
+		return 3
+	case priority <= 2:
+		return 4
+	default:
+		return int(math.Min(5, math.Ceil(priority*2)))
+	}
+}
+
+func RepeatEvery(frequency string) int {
+	switch frequency {
+	case "weekly":
+		return models.RepeatWeekly
+	case "monthly":
+		return models.RepeatMonthly
+	case "yearly":
+		return models.RepeatYearly
+	default:
+		return models.RepeatDaily
+	}
+}
+
+// CountReset - период сброса счетчиков привычки. В Habitica у привычек
+// тот же набор: daily, weekly, monthly.
+func CountReset(frequency string) string {
+	switch frequency {
+	case models.ResetDaily, models.ResetWeekly, models.ResetMonthly:
+		return frequency
+	default:
+		return models.ResetNever
+	}
+}
+
+// DayWeeks собирает карту repeat ("m": true, "t": false, ...) в строку
+// "mon,wed,fri". Все отмеченные дни переносятся как есть: пустая строка
+// у нас означает только день недели начала, а не любой день. Если не
+// отмечен ни один день, возвращается пустая строка.
+func DayWeeks(repeat map[string]bool) string {
+	var days []string
+	for i, key := range repeatKeys {
+		if repeat[key] {
+			days = append(days, models.WeekDays[i])
+		}
+	}
+	return strings.Join(days, ",")
+}
+
+func noteWithChecklist(notes string, checklist []ChecklistItem) string {
+	if len(checklist) == 0 {
+		return notes
+	}
+
+	var b strings.Builder
+	b.WriteString(notes)
+	for _, item := range checklist {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		if item.Completed {
+			b.WriteString("[x] ")
+		} else {
+			b.WriteString("[ ] ")
+		}
+		b.WriteString(item.Text)
+	}
+	return b.String()
+}
+
+func parseDate(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/achievements"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// GetAchievements - все достижения с отметкой о получении и прогрессом
+// по закрытым
+func (h *Handler) GetAchievements(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching achievements")
+
+	progress, err := achievements.Progress(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch achievements")
+		http.Error(w, "Failed to fetch achievements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/ical"
+	"huibitica/internal/postgresql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) NewCalendarToken(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Issuing calendar token")
+
+	token, err := postgresql.IssueToken(req.UserID, postgresql.TokenScopeCalendar, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to issue calendar token")
+		http.Error(w, "Failed to issue calendar token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"token": token,
+		"url":   "/api/calendar/" + token + ".ics",
+	}); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	userID, err := postgresql.GetUserIDByToken(chi.URLParam(r, "token"), postgresql.TokenScopeCalendar, h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Calendar feed rejected")
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	user, err := postgresql.GetUserByID(userID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch user data")
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+
+	tasks, err := postgresql.GetTasks(userID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch tasks")
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+
+	dailies, err := postgresql.GetDailies(userID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch dailies")
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+
+	clock, err := postgresql.GetUserClock(userID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch user clock")
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+
+	calendar := ical.NewCalendar("huibitica: "+user.Username, time.Now())
+	calendar.Clock = clock
+	calendar.TasksAsEvents = r.URL.Query().Get("tasks") == "event"
+	for _, task := range tasks {
+		calendar.AddTask(task)
+	}
+	for _, daily := range dailies {
+		calendar.AddDaily(daily)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="huibitica.ics"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(calendar.String())); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to write calendar")
+	}
+}
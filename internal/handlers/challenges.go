@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/logger"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) NewChallenge(w http.ResponseWriter, r *http.Request) {
+	var challenge models.Challenge
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &challenge); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	challenge.CreatedAt = time.Now()
+	if err := challenge.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", challenge.OwnerID).Msg("Attempting to create challenge")
+
+	challenge.ID, err = postgresql.AddChallenge(challenge, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to create challenge")
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":    "success",
+		"message":   "Challenge created successfully",
+		"challenge": challenge,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) GetChallenges(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	h.log.Info().Str("request_id", requestID).Msg("Fetching challenges")
+
+	challenges, err := postgresql.GetChallenges(h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch challenges")
+		http.Error(w, "Failed to fetch challenges", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(challenges); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) DeleteChallenge(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID      int `json:"user_id"`
+		ChallengeID int `json:"challenge_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("challenge_id", req.ChallengeID).Msg("Attempting to delete challenge")
+
+	if err := postgresql.DeleteChallenge(req.ChallengeID, req.UserID, h.db); err != nil {
+		h.challengeError(w, requestID, err, "Failed to delete challenge")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JoinChallenge копирует шаблоны испытания участнику
+func (h *Handler) JoinChallenge(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID      int `json:"user_id"`
+		ChallengeID int `json:"challenge_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Int("challenge_id", req.ChallengeID).Msg("Joining challenge")
+
+	clock, err := postgresql.GetUserClock(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to get user clock")
+		http.Error(w, "Failed to join challenge", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := postgresql.JoinChallenge(req.ChallengeID, req.UserID, clock.Today(time.Now()), h.db)
+	if err != nil {
+		h.challengeError(w, requestID, err, "Failed to join challenge")
+		return
+	}
+
+	for _, habit := range created.Habits {
+		h.emit(requestID, events.New(events.ItemCreated, req.UserID, map[string]interface{}{
+			"kind": "habit",
+			"item": habit,
+		}))
+	}
+	for _, daily := range created.Dailies {
+		h.emit(requestID, events.New(events.ItemCreated, req.UserID, map[string]interface{}{
+			"kind": "daily",
+			"item": daily,
+		}))
+	}
+	for _, task := range created.Tasks {
+		h.emit(requestID, events.New(events.ItemCreated, req.UserID, map[string]interface{}{
+			"kind": "task",
+			"item": task,
+		}))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Joined challenge successfully",
+		"items":   created,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// LeaveChallenge - с keep_items связанные элементы остаются у пользователя,
+// без него удаляются
+func (h *Handler) LeaveChallenge(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID      int  `json:"user_id"`
+		ChallengeID int  `json:"challenge_id"`
+		KeepItems   bool `json:"keep_items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Int("challenge_id", req.ChallengeID).Bool("keep_items", req.KeepItems).Msg("Leaving challenge")
+
+	deleted, err := postgresql.LeaveChallenge(req.ChallengeID, req.UserID, req.KeepItems, h.db)
+	if err != nil {
+		h.challengeError(w, requestID, err, "Failed to leave challenge")
+		return
+	}
+
+	for _, link := range deleted {
+		h.emit(requestID, events.New(events.ItemDeleted, req.UserID, map[string]interface{}{
+			"kind": link.Kind,
+			"id":   link.ItemID,
+		}))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetChallengeLeaderboard(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		ChallengeID int `json:"challenge_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("challenge_id", req.ChallengeID).Msg("Fetching challenge leaderboard")
+
+	leaderboard, err := postgresql.GetChallengeLeaderboard(req.ChallengeID, h.db)
+	if err != nil {
+		h.challengeError(w, requestID, err, "Failed to fetch leaderboard")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(leaderboard); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) challengeError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Warn().Str("request_id", requestID).Err(err).Msg(message)
+	switch err.Error() {
+	case "challenge not found", "not a challenge member":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "already joined":
+		http.Error(w, err.Error(), http.StatusConflict)
+	case "only the owner can delete the challenge":
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
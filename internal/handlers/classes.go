@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/game"
+	"huibitica/internal/postgresql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) GetClasses(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"min_level":   game.ClassLevel,
+		"change_cost": game.ClassChangeCost,
+		"classes":     game.Classes,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) ChooseClass(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Class  string `json:"class"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, ok := game.FindClass(req.Class); !ok {
+		http.Error(w, "unknown class "+req.Class, http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("class", req.Class).Msg("Choosing class")
+
+	stats, err := postgresql.SetClass(req.UserID, req.Class, h.db)
+	if err != nil {
+		h.classError(w, requestID, err, "Failed to choose class")
+		return
+	}
+
+	h.emit(requestID, events.New(events.StatsUpdated, stats.UserID, stats))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// GetSkills - умения класса пользователя и когда каждое снова будет готово
+func (h *Handler) GetSkills(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching skills")
+
+	stats, err := postgresql.GetStats(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch stats")
+		http.Error(w, "Failed to fetch skills", http.StatusInternalServerError)
+		return
+	}
+	casts, err := postgresql.GetSkillCasts(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch skill casts")
+		http.Error(w, "Failed to fetch skills", http.StatusInternalServerError)
+		return
+	}
+
+	type skillState struct {
+		game.Skill
+		ReadyAt *time.Time `json:"ready_at,omitempty"`
+	}
+	skills := []skillState{}
+	if class, ok := game.FindClass(stats.Class); ok {
+		now := time.Now()
+		for _, skill := range class.Skills {
+			state := skillState{Skill: skill}
+			if at, ok := casts[skill.Key]; ok {
+				if readyAt := at.Add(skill.CooldownDuration()); readyAt.After(now) {
+					state.ReadyAt = &readyAt
+				}
+			}
+			skills = append(skills, state)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"class":  stats.Class,
+		"mana":   stats.Mana,
+		"skills": skills,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) CastSkill(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		Skill    string `json:"skill"`
+		TargetID int    `json:"target_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	skill, _, ok := game.FindSkill(req.Skill)
+	if !ok {
+		http.Error(w, "unknown skill "+req.Skill, http.StatusBadRequest)
+		return
+	}
+	if skill.Target && req.TargetID == 0 {
+		http.Error(w, "target_id is required", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("skill", skill.Key).Int("target_id", req.TargetID).Msg("Casting skill")
+
+	clock, err := postgresql.GetUserClock(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to get user clock")
+		http.Error(w, "Failed to cast skill", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	result, err := postgresql.CastSkill(req.UserID, skill, req.TargetID, now, clock.Today(now), h.db)
+	if err != nil {
+		h.classError(w, requestID, err, "Failed to cast skill")
+		return
+	}
+
+	h.emit(requestID, events.New(events.SkillCast, req.UserID, result))
+	h.emit(requestID, events.New(events.StatsUpdated, req.UserID, result.Stats))
+	for _, stats := range result.Healed {
+		if stats.UserID != req.UserID {
+			h.emit(requestID, events.New(events.StatsUpdated, stats.UserID, stats))
+		}
+	}
+	if result.Task != nil {
+		h.emit(requestID, events.New(events.ItemUpdated, req.UserID, map[string]interface{}{
+			"kind": "task",
+			"item": result.Task,
+		}))
+	}
+	if result.Quest != nil {
+		h.emitBossHit(requestID, req.UserID, result.Quest)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) classError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Warn().Str("request_id", requestID).Err(err).Msg(message)
+	switch err.Error() {
+	case "task not found", "quest not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "level too low", "skill not available for class":
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case "class already chosen", "not enough gold", "not enough mana", "skill on cooldown":
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"huibitica/internal/achievements"
+	"huibitica/internal/events"
+	"huibitica/internal/webhooks"
+)
+
+// emit рассылает событие подписчикам: в поток событий клиентов и в
+// вебхуки. Ошибка доставки не должна ломать запрос, который событие
+// вызвал, поэтому она только логируется.
+func (h *Handler) emit(requestID string, event events.Event) {
+	event, err := h.hub.Publish(event)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Str("event", event.Type).Err(err).Msg("Failed to publish event")
+	}
+
+	if err := webhooks.Enqueue(event, h.db); err != nil {
+		h.log.Error().Str("request_id", requestID).Str("event", event.Type).Err(err).Msg("Failed to enqueue webhooks")
+	}
+
+	h.checkAchievements(requestID, event)
+}
+
+// checkAchievements выдает достижения, которые могли открыться после
+// события. Событие о новом достижении само ничего не открывает, так что
+// рекурсии нет.
+func (h *Handler) checkAchievements(requestID string, event events.Event) {
+	unlocked, err := achievements.Check(event.UserID, achievements.Metrics(event.Type), h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Int("user_id", event.UserID).Err(err).Msg("Failed to check achievements")
+		return
+	}
+	for _, u := range unlocked {
+		a, _ := achievements.Find(u.Achievement)
+		h.log.Info().Str("request_id", requestID).Int("user_id", event.UserID).Str("achievement", a.Key).Msg("Achievement unlocked")
+		h.emit(requestID, events.New(events.AchievementUnlocked, event.UserID, map[string]interface{}{
+			"achievement": a,
+			"unlocked_at": u.UnlockedAt,
+		}))
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/postgresql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// GetHabitHistory - счетчики привычки по прошедшим периодам сброса
+func (h *Handler) GetHabitHistory(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		HabitID int `json:"habit_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("habit_id", req.HabitID).Msg("Fetching habit history")
+
+	periods, err := postgresql.GetHabitHistory(req.HabitID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch habit history")
+		if err.Error() == "habit not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch habit history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(periods); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"huibitica/internal/config"
+	"huibitica/internal/events"
 	"huibitica/internal/logger"
 	"huibitica/internal/models"
 	"huibitica/internal/postgresql"
+	"huibitica/internal/realtime"
+	"huibitica/internal/schedule"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -16,10 +21,13 @@ import (
 type Handler struct {
 	db  *pgxpool.Pool
 	log zerolog.Logger
+	cfg *config.Config
+	hub *events.Hub
+	rt  *realtime.Server
 }
 
-func NewHandler(db *pgxpool.Pool, log zerolog.Logger) *Handler {
-	return &Handler{db: db, log: log}
+func NewHandler(db *pgxpool.Pool, log zerolog.Logger, cfg *config.Config, hub *events.Hub, rt *realtime.Server) *Handler {
+	return &Handler{db: db, log: log, cfg: cfg, hub: hub, rt: rt}
 }
 
 func (h *Handler) NewUser(w http.ResponseWriter, r *http.Request) {
@@ -42,6 +50,12 @@ func (h *Handler) NewUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := user.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Запись в БД
 	if err := postgresql.RegisterUser(user, h.db); err != nil {
 		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Registration failed")
@@ -89,17 +103,34 @@ func (h *Handler) NewHabit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if habit.Difficulty == 0 {
+		habit.Difficulty = h.defaultDifficulty(requestID, habit.UserID)
+	}
+
+	if err := habit.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Логирование попытки создания
 	h.log.Info().Msg("Attempting to create new habit")
 
 	// Запись в БД
-	if err := postgresql.AddHabit(habit, h.db); err != nil {
+	created, err := postgresql.AddHabit(habit, h.db)
+	if err != nil {
 		h.log.Error().Err(err).Str("request_id", requestID).Msg("Failed to create habit")
 
 		http.Error(w, "Failed to create habit", http.StatusInternalServerError)
 		return
 	}
 
+	habit = *created
+	h.emit(requestID, events.New(events.ItemCreated, habit.UserID, map[string]interface{}{
+		"kind": "habit",
+		"item": habit,
+	}))
+
 	// Успешный ответ
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -134,14 +165,31 @@ func (h *Handler) NewDaily(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if daily.Difficulty == 0 {
+		daily.Difficulty = h.defaultDifficulty(requestID, daily.UserID)
+	}
+
+	if err := daily.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	h.log.Info().Str("request_id", requestID).Msg("Attempting to create new habit")
 
-	if err := postgresql.AddDaily(daily, h.db); err != nil {
+	id, err := postgresql.AddDaily(daily, h.db)
+	if err != nil {
 		h.log.Error().Err(err).Str("request_id", requestID).Msg("Failed to create habit")
 		http.Error(w, "Failed to create habit", http.StatusInternalServerError)
 		return
 	}
 
+	daily.ID = id
+	h.emit(requestID, events.New(events.ItemCreated, daily.UserID, map[string]interface{}{
+		"kind": "daily",
+		"item": daily,
+	}))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 
@@ -175,13 +223,29 @@ func (h *Handler) NewTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if task.Difficulty == 0 {
+		task.Difficulty = h.defaultDifficulty(requestID, task.UserID)
+	}
+
+	if err := task.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	h.log.Info().Str("request_id", requestID).Msg("Attempting to create new task")
-	if err := postgresql.AddTask(task, h.db); err != nil {
-		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to create task")
-		http.Error(w, "Failed to create task", http.StatusInternalServerError)
+	id, err := postgresql.AddTask(task, h.db)
+	if err != nil {
+		h.taskError(w, requestID, err, "Failed to create task")
 		return
 	}
 
+	task.ID = id
+	h.emit(requestID, events.New(events.ItemCreated, task.UserID, map[string]interface{}{
+		"kind": "task",
+		"item": task,
+	}))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 
@@ -303,6 +367,16 @@ func (h *Handler) GetHabits(w http.ResponseWriter, r *http.Request) {
 
 	h.log.Info().Str("request_id", requestID).Int("user_id", userID).Msg("Fetching habits")
 
+	// Воркер смены дня обнуляет счетчики с задержкой до своего интервала,
+	// поэтому перед чтением догоняем сброс сами
+	clock, err := postgresql.GetUserClock(userID, h.db)
+	if err == nil {
+		_, err = postgresql.ResetHabitCounts(userID, clock.Today(time.Now()), h.db)
+	}
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Failed to reset habit counters")
+	}
+
 	habits, err := postgresql.GetHabits(userID, h.db)
 	if err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch habits")
@@ -348,11 +422,15 @@ func (h *Handler) GetDailies(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetTasks - задачи пользователя. view выбирает представление:
+// "today" - план на сегодня по приоритету и сроку, "overdue" -
+// просроченные, пусто - все задачи.
 func (h *Handler) GetTasks(w http.ResponseWriter, r *http.Request) {
 	requestID := middleware.GetReqID(r.Context())
 
 	var req struct {
-		UserID int `json:"user_id"`
+		UserID int    `json:"user_id"`
+		View   string `json:"view"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
@@ -360,8 +438,12 @@ func (h *Handler) GetTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	userID := req.UserID
+	if req.View != models.TaskViewAll && req.View != models.TaskViewToday && req.View != models.TaskViewOverdue {
+		http.Error(w, "view must be one of today, overdue", http.StatusBadRequest)
+		return
+	}
 
-	h.log.Info().Str("request_id", requestID).Int("user_id", userID).Msg("Fetching tasks")
+	h.log.Info().Str("request_id", requestID).Int("user_id", userID).Str("view", req.View).Msg("Fetching tasks")
 
 	tasks, err := postgresql.GetTasks(userID, h.db)
 	if err != nil {
@@ -369,6 +451,24 @@ func (h *Handler) GetTasks(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch tasks", http.StatusInternalServerError)
 		return
 	}
+	clock, err := postgresql.GetUserClock(userID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch user clock")
+		http.Error(w, "Failed to fetch tasks", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	switch req.View {
+	case models.TaskViewToday:
+		tasks = schedule.Agenda(tasks, clock, now)
+	case models.TaskViewOverdue:
+		tasks = schedule.Overdue(tasks, clock, now)
+	}
+	for i := range tasks {
+		dueAt := schedule.DueAt(tasks[i], clock).UTC()
+		tasks[i].DueAt = &dueAt
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -396,14 +496,31 @@ func (h *Handler) EditHabit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := habit.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	h.log.Info().Str("request_id", requestID).Msg("Attempting to edit habit")
 
-	if err := postgresql.EditHabit(habit, h.db); err != nil {
+	userID, err := postgresql.EditHabit(habit, h.db)
+	if err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to edit habit")
+		if err.Error() == "habit not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to edit habit", http.StatusInternalServerError)
 		return
 	}
 
+	habit.UserID = userID
+	h.emit(requestID, events.New(events.ItemUpdated, userID, map[string]interface{}{
+		"kind": "habit",
+		"item": habit,
+	}))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
@@ -438,15 +555,31 @@ func (h *Handler) EditDaily(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := daily.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	h.log.Info().
 		Str("request_id", requestID).Msg("Attempting to edit habit")
 
-	if err := postgresql.EditDaily(daily, h.db); err != nil {
+	userID, err := postgresql.EditDaily(daily, h.db)
+	if err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to edit habit")
-
+		if err.Error() == "daily not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to edit habit", http.StatusInternalServerError)
 		return
 	}
+
+	daily.UserID = userID
+	h.emit(requestID, events.New(events.ItemUpdated, userID, map[string]interface{}{
+		"kind": "daily",
+		"item": daily,
+	}))
 }
 
 func (h *Handler) EditTask(w http.ResponseWriter, r *http.Request) {
@@ -467,13 +600,25 @@ func (h *Handler) EditTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := task.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	h.log.Info().Str("request_id", requestID).Msg("Attempting to edit task")
 
-	if err := postgresql.EditTask(task, h.db); err != nil {
-		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to edit task")
-		http.Error(w, "Failed to edit task", http.StatusInternalServerError)
+	userID, err := postgresql.EditTask(task, h.db)
+	if err != nil {
+		h.taskError(w, requestID, err, "Failed to edit task")
 		return
 	}
+
+	task.UserID = userID
+	h.emit(requestID, events.New(events.ItemUpdated, userID, map[string]interface{}{
+		"kind": "task",
+		"item": task,
+	}))
 }
 
 func (h *Handler) EditUserUsername(w http.ResponseWriter, r *http.Request) {
@@ -557,6 +702,54 @@ func (h *Handler) EditUserPhone(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// EditUserTimezone задает часовой пояс IANA и час начала дня. В ответе -
+// какой день у пользователя сейчас по новым часам.
+func (h *Handler) EditUserTimezone(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		Timezone string `json:"timezone"`
+		DayStart int    `json:"day_start"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	clock, err := schedule.NewClock(req.Timezone, req.DayStart)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("timezone", clock.Location.String()).Int("day_start", req.DayStart).Msg("Attempting to edit timezone")
+
+	if err := postgresql.EditUserClock(req.UserID, clock.Location.String(), clock.DayStart, h.db); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to edit timezone")
+		if err.Error() == "user not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to edit timezone", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"timezone":  clock.Location.String(),
+		"day_start": clock.DayStart,
+		"today":     clock.Today(time.Now()).Format(time.DateOnly),
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
 func (h *Handler) EditPassword(w http.ResponseWriter, r *http.Request) {
 	var user models.Password
 
@@ -599,12 +792,22 @@ func (h *Handler) DeleteHabit(w http.ResponseWriter, r *http.Request) {
 
 	h.log.Info().Str("request_id", requestID).Int("habit_id", habitID).Msg("Attempting to delete habit")
 
-	if err := postgresql.DeleteHabit(habitID, h.db); err != nil {
+	userID, err := postgresql.DeleteHabit(habitID, h.db)
+	if err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to delete habit")
+		if err.Error() == "habit not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to delete habit", http.StatusInternalServerError)
 		return
 	}
 
+	h.emit(requestID, events.New(events.ItemDeleted, userID, map[string]interface{}{
+		"kind": "habit",
+		"id":   habitID,
+	}))
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -623,12 +826,22 @@ func (h *Handler) DeleteDaily(w http.ResponseWriter, r *http.Request) {
 
 	h.log.Info().Str("request_id", requestID).Int("daily_id", dailyID).Msg("Attempting to delete daily")
 
-	if err := postgresql.DeleteDaily(dailyID, h.db); err != nil {
+	userID, err := postgresql.DeleteDaily(dailyID, h.db)
+	if err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to delete daily")
+		if err.Error() == "daily not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to delete daily", http.StatusInternalServerError)
 		return
 	}
 
+	h.emit(requestID, events.New(events.ItemDeleted, userID, map[string]interface{}{
+		"kind": "daily",
+		"id":   dailyID,
+	}))
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -647,12 +860,22 @@ func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 
 	h.log.Info().Str("request_id", requestID).Int("task_id", taskID).Msg("Attempting to delete task")
 
-	if err := postgresql.DeleteTask(taskID, h.db); err != nil {
+	userID, err := postgresql.DeleteTask(taskID, h.db)
+	if err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to delete task")
+		if err.Error() == "task not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to delete task", http.StatusInternalServerError)
 		return
 	}
 
+	h.emit(requestID, events.New(events.ItemDeleted, userID, map[string]interface{}{
+		"kind": "task",
+		"id":   taskID,
+	}))
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -671,6 +894,16 @@ func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	h.log.Info().Str("request_id", requestID).Int("user_id", userID).Msg("Attempting to delete user")
 
+	// Выходим из группы заранее, чтобы она перешла другому участнику,
+	// а не удалилась каскадом вместе с владельцем
+	if partyID, err := postgresql.LeaveParty(userID, h.db); err == nil {
+		h.emitParty(requestID, partyID, "left", userID)
+	} else if err.Error() != "party not found" {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to leave party")
+		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+
 	if err := postgresql.DeleteUser(userID, h.db); err != nil {
 		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to delete user")
 		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
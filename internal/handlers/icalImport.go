@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"huibitica/internal/ical"
+	"huibitica/internal/models"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const maxCalendarUpload = 5 << 20
+
+// ImportICal принимает .ics либо телом запроса (text/calendar), либо файлом
+// в multipart-поле "file". Параметры в query: user_id, preview=true - только
+// показать, что будет создано, dailies=true - превращать повторяющиеся
+// события в ежедневные задачи.
+func (h *Handler) ImportICal(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	query := r.URL.Query()
+	userID, err := strconv.Atoi(query.Get("user_id"))
+	if err != nil || userID <= 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	preview, _ := strconv.ParseBool(query.Get("preview"))
+	asDailies, _ := strconv.ParseBool(query.Get("dailies"))
+
+	// Ограничение ставится на само тело, иначе FormFile разберет
+	// multipart-форму любого размера
+	r.Body = http.MaxBytesReader(w, r.Body, maxCalendarUpload)
+	var source io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			h.log.Warn().Str("request_id", requestID).Err(err).Msg("Calendar file is missing")
+			http.Error(w, "Calendar file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		source = file
+	}
+
+	items, err := ical.Parse(source)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid calendar")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := models.ImportRequest{
+		UserID:     userID,
+		DryRun:     preview,
+		OnConflict: query.Get("on_conflict"),
+	}
+
+	// PRIORITY переходит в приоритет задачи, сложность - из настроек
+	taskDifficulty := h.defaultDifficulty(requestID, userID)
+	for _, item := range items {
+		if item.Date().IsZero() {
+			req.Ignored = append(req.Ignored, models.ImportedItem{Kind: strings.ToLower(item.Component), Text: item.Summary})
+			continue
+		}
+
+		if asDailies && item.Component == "VEVENT" && item.RRule != "" {
+			daily, err := item.Daily()
+			if err == nil {
+				req.Data.Dailies = append(req.Data.Dailies, daily)
+				continue
+			}
+			h.log.Debug().Str("request_id", requestID).Str("uid", item.UID).Err(err).Msg("Unsupported RRULE, importing as task")
+		}
+
+		task := item.Task()
+		task.Difficulty = taskDifficulty
+		req.Data.Tasks = append(req.Data.Tasks, task)
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", userID).Bool("preview", preview).Int("items", len(items)).Msg("Attempting to import calendar")
+
+	h.runImport(w, requestID, req)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/habitica"
+	"huibitica/internal/logger"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) ImportAccount(w http.ResponseWriter, r *http.Request) {
+	var req models.ImportRequest
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Bool("dry_run", req.DryRun).Msg("Attempting to import account")
+
+	h.runImport(w, requestID, req)
+}
+
+// validateImport проверяет весь документ по тем же правилам, что и обработчики
+// создания, и возвращает все найденные ошибки сразу.
+func validateImport(req models.ImportRequest) []string {
+	var problems []string
+
+	switch req.OnConflict {
+	case "", models.ConflictCreate, models.ConflictSkip, models.ConflictFail:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown on_conflict mode %q", req.OnConflict))
+	}
+
+	if req.UserID == 0 {
+		user := models.RegisterUserRequest{
+			Username: req.Data.User.Username,
+			Email:    req.Data.User.Email,
+			Phone:    req.Data.User.Phone,
+			Password: req.Password,
+		}
+		if err := user.Validate(); err != nil {
+			problems = append(problems, "user: "+err.Error())
+		}
+	}
+
+	for i, habit := range req.Data.Habits {
+		if err := habit.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("habits[%d]: %s", i, err))
+		}
+	}
+	for i, daily := range req.Data.Dailies {
+		if err := daily.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("dailies[%d]: %s", i, err))
+		}
+	}
+	for i, task := range req.Data.Tasks {
+		if err := task.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("tasks[%d]: %s", i, err))
+		}
+	}
+
+	return problems
+}
+
+func (h *Handler) ImportHabitica(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID     int             `json:"user_id"`
+		DryRun     bool            `json:"dry_run"`
+		OnConflict string          `json:"on_conflict,omitempty"`
+		Export     json.RawMessage `json:"export"`
+	}
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.UserID == 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	export, err := habitica.Parse(req.Export)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid Habitica export")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	importReq := models.ImportRequest{
+		UserID:     req.UserID,
+		DryRun:     req.DryRun,
+		OnConflict: req.OnConflict,
+		Data:       export.Convert(time.Now()),
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Bool("dry_run", req.DryRun).Msg("Attempting to import Habitica export")
+
+	h.runImport(w, requestID, importReq)
+}
+
+// runImport валидирует запрос импорта, выполняет его и пишет ответ.
+// Общая часть для всех форматов импорта.
+func (h *Handler) runImport(w http.ResponseWriter, requestID string, req models.ImportRequest) {
+	if problems := validateImport(req); len(problems) > 0 {
+		h.log.Warn().Str("request_id", requestID).Strs("errors", problems).Msg("Import validation failed")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "error",
+			"errors": problems,
+		})
+		return
+	}
+
+	report, err := postgresql.ImportAccount(req, h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Import failed")
+		switch {
+		case err.Error() == "user not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case strings.HasSuffix(err.Error(), "already exists"):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Failed to import account", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	status := http.StatusCreated
+	if req.DryRun {
+		status = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/game"
+	"huibitica/internal/postgresql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const maxPurchaseQuantity = 99
+
+func (h *Handler) GetShopItems(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(game.Catalog); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// GetInventory - предметы пользователя, надетое снаряжение и суммарные
+// бонусы от него
+func (h *Handler) GetInventory(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching inventory")
+
+	items, err := postgresql.GetInventory(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch inventory")
+		http.Error(w, "Failed to fetch inventory", http.StatusInternalServerError)
+		return
+	}
+	equipped, err := postgresql.GetEquipment(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch equipment")
+		http.Error(w, "Failed to fetch inventory", http.StatusInternalServerError)
+		return
+	}
+	keys := make([]string, 0, len(equipped))
+	for _, key := range equipped {
+		keys = append(keys, key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"items":    items,
+		"equipped": equipped,
+		"bonuses":  game.EquipmentBonuses(keys),
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) BuyItem(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		Item     string `json:"item"`
+		Quantity int    `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	item, ok := game.FindItem(req.Item)
+	if !ok {
+		http.Error(w, "unknown item "+req.Item, http.StatusBadRequest)
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 1 || req.Quantity > maxPurchaseQuantity {
+		http.Error(w, "quantity must be between 1 and 99", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("item", item.Key).Int("quantity", req.Quantity).Msg("Buying item")
+
+	stats, err := postgresql.BuyItem(req.UserID, item, req.Quantity, h.db)
+	if err != nil {
+		h.inventoryError(w, requestID, err, "Failed to buy item")
+		return
+	}
+
+	h.emit(requestID, events.New(events.StatsUpdated, stats.UserID, stats))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"status":   "success",
+		"item":     item,
+		"quantity": req.Quantity,
+		"stats":    stats,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) EquipItem(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Item   string `json:"item"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	item, ok := game.FindItem(req.Item)
+	if !ok {
+		http.Error(w, "unknown item "+req.Item, http.StatusBadRequest)
+		return
+	}
+	if !item.Gear() {
+		http.Error(w, "item cannot be equipped", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("item", item.Key).Msg("Equipping item")
+
+	if err := postgresql.Equip(req.UserID, item, h.db); err != nil {
+		h.inventoryError(w, requestID, err, "Failed to equip item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) UnequipItem(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Slot   string `json:"slot"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("slot", req.Slot).Msg("Unequipping item")
+
+	if err := postgresql.Unequip(req.UserID, req.Slot, h.db); err != nil {
+		h.inventoryError(w, requestID, err, "Failed to unequip item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) UseItem(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Item   string `json:"item"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	item, ok := game.FindItem(req.Item)
+	if !ok {
+		http.Error(w, "unknown item "+req.Item, http.StatusBadRequest)
+		return
+	}
+	if item.Type != game.ItemPotion {
+		http.Error(w, "item cannot be used", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("item", item.Key).Msg("Using item")
+
+	stats, err := postgresql.UseItem(req.UserID, item, h.db)
+	if err != nil {
+		h.inventoryError(w, requestID, err, "Failed to use item")
+		return
+	}
+
+	h.emit(requestID, events.New(events.StatsUpdated, stats.UserID, stats))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) inventoryError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Warn().Str("request_id", requestID).Err(err).Msg(message)
+	switch err.Error() {
+	case "item not in inventory", "slot is empty":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "not enough gold", "item already owned":
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/logger"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/webhooks"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching notification settings")
+
+	settings, err := postgresql.GetNotificationSettings(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch notification settings")
+		http.Error(w, "Failed to fetch notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) EditNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	var settings models.NotificationSettings
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &settings); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := settings.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", settings.UserID).Msg("Attempting to edit notification settings")
+
+	if err := postgresql.SaveNotificationSettings(settings, h.db); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to edit notification settings")
+		http.Error(w, "Failed to edit notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"status":   "success",
+		"message":  "Notification settings saved",
+		"settings": settings,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) GetVAPIDPublicKey(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.WebPush.PublicKey == "" {
+		http.Error(w, "Web Push is not configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"public_key": h.cfg.WebPush.PublicKey,
+	})
+}
+
+func (h *Handler) NewNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var channel models.NotificationChannel
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &channel); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch channel.Kind {
+	case models.ChannelWebPush:
+		if channel.Keys.P256dh == "" || channel.Keys.Auth == "" {
+			http.Error(w, "keys.p256dh and keys.auth are required for webpush", http.StatusBadRequest)
+			return
+		}
+		fallthrough
+	case models.ChannelWebhook:
+		// Адрес задает пользователь - во внутреннюю сеть не ходим
+		if err := webhooks.CheckURL(r.Context(), channel.Endpoint); err != nil {
+			h.log.Warn().Str("request_id", requestID).Err(err).Msg("Notification endpoint rejected")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case models.ChannelLog:
+		if !h.cfg.LogChannel {
+			http.Error(w, "log channel is disabled", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "kind must be one of webpush, webhook, log", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", channel.UserID).Str("kind", channel.Kind).Msg("Attempting to subscribe notification channel")
+
+	channel.ID, err = postgresql.AddNotificationChannel(channel, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to subscribe notification channel")
+		http.Error(w, "Failed to subscribe notification channel", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Notification channel subscribed",
+		"channel": channel,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) GetNotificationChannels(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching notification channels")
+
+	channels, err := postgresql.GetNotificationChannels(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch notification channels")
+		http.Error(w, "Failed to fetch notification channels", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(channels); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) DeleteNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		ChannelID int `json:"channel_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("channel_id", req.ChannelID).Msg("Attempting to delete notification channel")
+
+	if err := postgresql.DeleteNotificationChannel(req.ChannelID, h.db); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to delete notification channel")
+		if err.Error() == "notification channel not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete notification channel", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
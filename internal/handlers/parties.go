@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/realtime"
+	"huibitica/internal/schedule"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5"
+)
+
+func (h *Handler) NewParty(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Name   string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	party := models.Party{Name: req.Name, OwnerID: req.UserID}
+	if err := party.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Attempting to create party")
+
+	created, err := postgresql.CreateParty(party, h.db)
+	if err != nil {
+		h.partyError(w, requestID, err, "Failed to create party")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Party created successfully",
+		"party":   created,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// GetParty - обзор группы пользователя: участники, их статы и выполнение
+// за сегодня с учетом настроек приватности каждого участника
+func (h *Handler) GetParty(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching party")
+
+	party, err := postgresql.GetPartyByUser(req.UserID, h.db)
+	if err != nil {
+		h.partyError(w, requestID, err, "Failed to fetch party")
+		return
+	}
+
+	view, err := h.partyView(*party, req.UserID, time.Now())
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to build party view")
+		http.Error(w, "Failed to fetch party", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) partyView(party models.Party, viewerID int, now time.Time) (*models.PartyView, error) {
+	members, err := postgresql.GetPartyMembers(party.ID, h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &models.PartyView{Party: party, Members: make([]models.PartyMemberView, 0, len(members))}
+	for _, member := range members {
+		self := member.UserID == viewerID
+		memberView := models.PartyMemberView{
+			UserID:   member.UserID,
+			Username: member.Username,
+			Owner:    member.UserID == party.OwnerID,
+			JoinedAt: member.JoinedAt,
+		}
+
+		if self || member.ShareStats {
+			memberView.Stats, err = postgresql.GetStats(member.UserID, h.db)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if self || member.ShareProgress {
+			dailies, err := postgresql.GetDailies(member.UserID, h.db)
+			if err != nil {
+				return nil, err
+			}
+			tasks, err := postgresql.GetTasks(member.UserID, h.db)
+			if err != nil {
+				return nil, err
+			}
+			clock, err := postgresql.GetUserClock(member.UserID, h.db)
+			if err != nil {
+				return nil, err
+			}
+			progress := schedule.Progress(dailies, tasks, clock.Today(now))
+			memberView.Today = &progress
+		}
+
+		view.Members = append(view.Members, memberView)
+	}
+	return view, nil
+}
+
+func (h *Handler) InviteToParty(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("username", req.Username).Msg("Inviting to party")
+
+	invitee, err := postgresql.GetUserByUsername(req.Username, h.db)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch user data")
+		http.Error(w, "Failed to invite to party", http.StatusInternalServerError)
+		return
+	}
+	if invitee.UserID == req.UserID {
+		http.Error(w, "cannot invite yourself", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := postgresql.InviteToParty(req.UserID, invitee.UserID, h.db)
+	if err != nil {
+		h.partyError(w, requestID, err, "Failed to invite to party")
+		return
+	}
+
+	h.emit(requestID, events.New(events.PartyUpdated, invitee.UserID, map[string]interface{}{
+		"party_id": invite.PartyID,
+		"action":   "invited",
+		"invite":   invite,
+	}))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Invite sent successfully",
+		"invite":  invite,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) GetPartyInvites(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching party invites")
+
+	invites, err := postgresql.GetPartyInvites(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch party invites")
+		http.Error(w, "Failed to fetch party invites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(invites); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) AcceptPartyInvite(w http.ResponseWriter, r *http.Request) {
+	h.answerPartyInvite(w, r, true)
+}
+
+func (h *Handler) DeclinePartyInvite(w http.ResponseWriter, r *http.Request) {
+	h.answerPartyInvite(w, r, false)
+}
+
+func (h *Handler) answerPartyInvite(w http.ResponseWriter, r *http.Request, accept bool) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID  int `json:"user_id"`
+		PartyID int `json:"party_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Int("party_id", req.PartyID).Bool("accept", accept).Msg("Answering party invite")
+
+	var err error
+	if accept {
+		err = postgresql.AcceptPartyInvite(req.UserID, req.PartyID, h.db)
+	} else {
+		err = postgresql.DeclinePartyInvite(req.UserID, req.PartyID, h.db)
+	}
+	if err != nil {
+		h.partyError(w, requestID, err, "Failed to answer party invite")
+		return
+	}
+
+	if accept {
+		h.emitParty(requestID, req.PartyID, "joined", req.UserID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) LeaveParty(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Leaving party")
+
+	partyID, err := postgresql.LeaveParty(req.UserID, h.db)
+	if err != nil {
+		h.partyError(w, requestID, err, "Failed to leave party")
+		return
+	}
+
+	h.rt.Kick(req.UserID, realtime.PartyChannel(partyID))
+	h.emit(requestID, events.New(events.PartyUpdated, req.UserID, map[string]interface{}{
+		"party_id": partyID,
+		"action":   "left",
+		"user_id":  req.UserID,
+	}))
+	h.emitParty(requestID, partyID, "left", req.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) TransferPartyOwnership(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID     int `json:"user_id"`
+		NewOwnerID int `json:"new_owner_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Int("new_owner_id", req.NewOwnerID).Msg("Transferring party ownership")
+
+	partyID, err := postgresql.TransferPartyOwnership(req.UserID, req.NewOwnerID, h.db)
+	if err != nil {
+		h.partyError(w, requestID, err, "Failed to transfer party ownership")
+		return
+	}
+
+	h.emitParty(requestID, partyID, "owner_changed", req.NewOwnerID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) EditPartyPrivacy(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID        int  `json:"user_id"`
+		ShareStats    bool `json:"share_stats"`
+		ShareProgress bool `json:"share_progress"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Updating party privacy")
+
+	if err := postgresql.SetPartyPrivacy(req.UserID, req.ShareStats, req.ShareProgress, h.db); err != nil {
+		h.partyError(w, requestID, err, "Failed to update party privacy")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emitParty сообщает всем участникам группы об изменении ее состава
+func (h *Handler) emitParty(requestID string, partyID int, action string, userID int) {
+	members, err := postgresql.GetPartyMembers(partyID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Int("party_id", partyID).Err(err).Msg("Failed to fetch party members")
+		return
+	}
+	for _, member := range members {
+		h.emit(requestID, events.New(events.PartyUpdated, member.UserID, map[string]interface{}{
+			"party_id": partyID,
+			"action":   action,
+			"user_id":  userID,
+		}))
+	}
+}
+
+func (h *Handler) partyError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Warn().Str("request_id", requestID).Err(err).Msg(message)
+	switch err.Error() {
+	case "party not found", "invite not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "user already in a party":
+		http.Error(w, err.Error(), http.StatusConflict)
+	case "only the owner can invite", "only the owner can transfer ownership":
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case "user is not a party member":
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) GetBosses(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(game.Bosses); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) StartQuest(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Boss   string `json:"boss"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	boss, ok := game.FindBoss(req.Boss)
+	if !ok {
+		http.Error(w, "unknown boss "+req.Boss, http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("boss", boss.Key).Msg("Starting quest")
+
+	quest, err := postgresql.StartQuest(req.UserID, boss, h.db)
+	if err != nil {
+		h.questError(w, requestID, err, "Failed to start quest")
+		return
+	}
+
+	h.emitQuest(requestID, *quest, map[string]interface{}{
+		"action": "started",
+		"quest":  quest,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Quest started successfully",
+		"quest":   quest,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// GetQuest - состояние текущего (или последнего) квеста группы
+func (h *Handler) GetQuest(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching quest")
+
+	quest, err := postgresql.GetQuest(req.UserID, h.db)
+	if err != nil {
+		h.questError(w, requestID, err, "Failed to fetch quest")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(quest); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) AbandonQuest(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Abandoning quest")
+
+	quest, err := postgresql.AbandonQuest(req.UserID, h.db)
+	if err != nil {
+		h.questError(w, requestID, err, "Failed to abandon quest")
+		return
+	}
+
+	h.emitQuest(requestID, *quest, map[string]interface{}{
+		"action": "abandoned",
+		"quest":  quest,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// hitBoss бьет босса квеста группы после выполненного действия. Квест -
+// побочный эффект, поэтому ошибка только логируется.
+func (h *Handler) hitBoss(requestID string, userID int, difficulty int) {
+	hit, err := postgresql.DamageBoss(userID, game.BossDamage(difficulty), h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Int("user_id", userID).Err(err).Msg("Failed to damage boss")
+		return
+	}
+	if hit == nil {
+		return
+	}
+	h.emitBossHit(requestID, userID, hit)
+}
+
+// emitBossHit рассылает группе удар userID по боссу и награды за победу
+func (h *Handler) emitBossHit(requestID string, userID int, hit *models.QuestHit) {
+	action := "boss_damaged"
+	if hit.Defeated {
+		action = "boss_defeated"
+	}
+	h.emitQuest(requestID, hit.Quest, map[string]interface{}{
+		"action":  action,
+		"user_id": userID,
+		"damage":  hit.Damage,
+		"quest":   hit.Quest,
+	})
+	for i := range hit.Rewards {
+		h.emitStats(requestID, &hit.Rewards[i])
+	}
+}
+
+// emitQuest рассылает событие квеста всем участникам группы
+func (h *Handler) emitQuest(requestID string, quest models.Quest, data map[string]interface{}) {
+	members, err := postgresql.GetPartyMembers(quest.PartyID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Int("party_id", quest.PartyID).Err(err).Msg("Failed to fetch party members")
+		return
+	}
+	for _, member := range members {
+		h.emit(requestID, events.New(events.QuestUpdated, member.UserID, data))
+	}
+}
+
+func (h *Handler) questError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Warn().Str("request_id", requestID).Err(err).Msg(message)
+	switch err.Error() {
+	case "party not found", "quest not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "quest already active":
+		http.Error(w, err.Error(), http.StatusConflict)
+	case "only the owner can start a quest", "only the owner can abandon a quest":
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
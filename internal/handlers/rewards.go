@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/logger"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const purchaseHistoryLimit = 100
+
+func (h *Handler) NewReward(w http.ResponseWriter, r *http.Request) {
+	var reward models.Reward
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &reward); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := reward.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Msg("Attempting to create new reward")
+
+	reward.ID, err = postgresql.AddReward(reward, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to create reward")
+		http.Error(w, "Failed to create reward", http.StatusInternalServerError)
+		return
+	}
+
+	h.emit(requestID, events.New(events.ItemCreated, reward.UserID, map[string]interface{}{
+		"kind": "reward",
+		"item": reward,
+	}))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Reward created successfully",
+		"reward":  reward,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) GetRewards(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching rewards")
+
+	rewards, err := postgresql.GetRewards(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch rewards")
+		http.Error(w, "Failed to fetch rewards", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(rewards); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) EditReward(w http.ResponseWriter, r *http.Request) {
+	var reward models.Reward
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &reward); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := reward.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Msg("Attempting to edit reward")
+
+	userID, err := postgresql.EditReward(reward, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to edit reward")
+		if err.Error() == "reward not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to edit reward", http.StatusInternalServerError)
+		return
+	}
+
+	reward.UserID = userID
+	h.emit(requestID, events.New(events.ItemUpdated, userID, map[string]interface{}{
+		"kind": "reward",
+		"item": reward,
+	}))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Reward edited successfully",
+		"reward":  reward,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) DeleteReward(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		RewardID int `json:"reward_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("reward_id", req.RewardID).Msg("Attempting to delete reward")
+
+	userID, err := postgresql.DeleteReward(req.RewardID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to delete reward")
+		if err.Error() == "reward not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete reward", http.StatusInternalServerError)
+		return
+	}
+
+	h.emit(requestID, events.New(events.ItemDeleted, userID, map[string]interface{}{
+		"kind": "reward",
+		"id":   req.RewardID,
+	}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurchaseReward списывает золото за награду. При нехватке золота - 409.
+func (h *Handler) PurchaseReward(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		RewardID int `json:"reward_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("reward_id", req.RewardID).Msg("Purchasing reward")
+
+	purchase, stats, err := postgresql.PurchaseReward(req.RewardID, h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Failed to purchase reward")
+		switch err.Error() {
+		case "reward not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case "not enough gold":
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Failed to purchase reward", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.emit(requestID, events.New(events.RewardPurchased, purchase.UserID, purchase))
+	h.emit(requestID, events.New(events.StatsUpdated, stats.UserID, stats))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"status":   "success",
+		"purchase": purchase,
+		"stats":    stats,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) GetRewardPurchases(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching reward purchases")
+
+	purchases, err := postgresql.GetRewardPurchases(req.UserID, purchaseHistoryLimit, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch reward purchases")
+		http.Error(w, "Failed to fetch reward purchases", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(purchases); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
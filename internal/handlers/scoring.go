@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching stats")
+
+	stats, err := postgresql.GetStats(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch stats")
+		http.Error(w, "Failed to fetch stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) ScoreHabit(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		HabitID   int    `json:"habit_id"`
+		Direction string `json:"direction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Direction != "up" && req.Direction != "down" {
+		http.Error(w, `direction must be "up" or "down"`, http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("habit_id", req.HabitID).Str("direction", req.Direction).Msg("Scoring habit")
+
+	habit, result, err := postgresql.ScoreHabit(req.HabitID, req.Direction == "up", time.Now(), h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Failed to score habit")
+		switch err.Error() {
+		case "habit not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case "direction not allowed":
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to score habit", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.emit(requestID, events.New(events.HabitScored, habit.UserID, map[string]interface{}{
+		"habit":     habit,
+		"direction": req.Direction,
+		"result":    result,
+	}))
+	h.emitStats(requestID, result)
+	if req.Direction == "up" {
+		h.hitBoss(requestID, habit.UserID, habit.Difficulty)
+		h.rollDrop(requestID, habit.UserID, habit.Difficulty)
+	}
+
+	h.writeScore(w, requestID, "habit", habit, result)
+}
+
+func (h *Handler) CompleteDaily(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		DailyID int `json:"daily_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("daily_id", req.DailyID).Msg("Completing daily")
+
+	daily, result, err := postgresql.CompleteDaily(req.DailyID, time.Now(), h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Failed to complete daily")
+		switch err.Error() {
+		case "daily not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case "daily already completed":
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Failed to complete daily", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.emit(requestID, events.New(events.DailyCompleted, daily.UserID, map[string]interface{}{
+		"daily":  daily,
+		"result": result,
+	}))
+	h.emitStats(requestID, result)
+	h.hitBoss(requestID, daily.UserID, daily.Difficulty)
+	h.rollDrop(requestID, daily.UserID, daily.Difficulty)
+
+	h.writeScore(w, requestID, "daily", daily, result)
+}
+
+func (h *Handler) CompleteTask(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		TaskID int `json:"task_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("task_id", req.TaskID).Msg("Completing task")
+
+	task, next, result, err := postgresql.CompleteTask(req.TaskID, h.db)
+	if err != nil {
+		h.taskError(w, requestID, err, "Failed to complete task")
+		return
+	}
+
+	h.emit(requestID, events.New(events.TaskCompleted, task.UserID, map[string]interface{}{
+		"task":   task,
+		"result": result,
+	}))
+	h.emitStats(requestID, result)
+	h.rollDrop(requestID, task.UserID, task.Difficulty)
+
+	if next == nil {
+		h.writeScore(w, requestID, "task", task, result)
+		return
+	}
+
+	h.emit(requestID, events.New(events.ItemCreated, next.UserID, map[string]interface{}{
+		"kind": "task",
+		"item": next,
+	}))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"status": "success",
+		"task":   task,
+		"next":   next,
+		"result": result,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) emitStats(requestID string, result *models.ScoreResult) {
+	h.emit(requestID, events.New(events.StatsUpdated, result.Stats.UserID, result.Stats))
+	if result.LeveledUp {
+		h.emit(requestID, events.New(events.LevelUp, result.Stats.UserID, result.Stats))
+	}
+}
+
+func (h *Handler) writeScore(w http.ResponseWriter, requestID string, kind string, item interface{}, result *models.ScoreResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"status": "success",
+		kind:     item,
+		"result": result,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
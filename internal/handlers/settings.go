@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"huibitica/internal/logger"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (h *Handler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching settings")
+
+	settings, err := postgresql.GetSettings(req.UserID, h.db)
+	if err != nil {
+		h.settingsError(w, requestID, err, "Failed to fetch settings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// PatchSettings меняет только переданные поля: тело накладывается на
+// текущие настройки, после чего результат проверяется целиком
+func (h *Handler) PatchSettings(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Attempting to edit settings")
+
+	// Ошибки наложения и проверки - ошибки запроса, а не базы
+	var invalid error
+	settings, err := postgresql.PatchSettings(req.UserID, func(settings *models.Settings) error {
+		patch := struct {
+			UserID int `json:"user_id"`
+			*models.Settings
+		}{Settings: settings}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		if invalid = decoder.Decode(&patch); invalid != nil {
+			return invalid
+		}
+		settings.Version = models.SettingsVersion
+		invalid = settings.Validate()
+		return invalid
+	}, h.db)
+	if invalid != nil {
+		h.log.Warn().Str("request_id", requestID).Err(invalid).Msg("Invalid settings")
+		http.Error(w, invalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.settingsError(w, requestID, err, "Failed to edit settings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"status":   "success",
+		"message":  "Settings saved",
+		"settings": settings,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// defaultDifficulty - сложность из настроек для новых задач без явной
+// сложности. Если настройки не прочитались, берется значение по умолчанию.
+func (h *Handler) defaultDifficulty(requestID string, userID int) int {
+	settings, err := postgresql.GetSettings(userID, h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Failed to fetch settings, using default difficulty")
+		return models.DefaultSettings().DefaultDifficulty
+	}
+	return settings.DefaultDifficulty
+}
+
+func (h *Handler) settingsError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Error().Str("request_id", requestID).Err(err).Msg(message)
+	if err.Error() == "user not found" {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/game"
+	"huibitica/internal/postgresql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// rollDrop разыгрывает выпадение за выполненное действие. Как и урон по
+// боссу, это побочный эффект - ошибка только логируется.
+func (h *Handler) rollDrop(requestID string, userID int, difficulty int) {
+	clock, err := postgresql.GetUserClock(userID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Int("user_id", userID).Err(err).Msg("Failed to get user clock")
+		return
+	}
+
+	drop, err := postgresql.RollDrop(userID, difficulty, clock.Today(time.Now()), h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Int("user_id", userID).Err(err).Msg("Failed to roll drop")
+		return
+	}
+	if drop == nil {
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", userID).Str("item", drop.InventoryKey()).Msg("Item dropped")
+	h.emit(requestID, events.New(events.ItemDropped, userID, map[string]interface{}{
+		"drop": drop,
+		"item": drop.InventoryKey(),
+	}))
+}
+
+// GetStable - питомцы и ездовые животные пользователя
+func (h *Handler) GetStable(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching stable")
+
+	pets, err := postgresql.GetPets(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch pets")
+		http.Error(w, "Failed to fetch stable", http.StatusInternalServerError)
+		return
+	}
+	mounts, err := postgresql.GetMounts(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch mounts")
+		http.Error(w, "Failed to fetch stable", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"pets":   pets,
+		"mounts": mounts,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) HatchPet(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Egg    string `json:"egg"`
+		Potion string `json:"potion"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !game.ValidDrop(game.DropEgg, req.Egg) {
+		http.Error(w, "unknown egg "+req.Egg, http.StatusBadRequest)
+		return
+	}
+	if !game.ValidDrop(game.DropHatchingPotion, req.Potion) {
+		http.Error(w, "unknown hatching potion "+req.Potion, http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("egg", req.Egg).Str("potion", req.Potion).Msg("Hatching pet")
+
+	pet, err := postgresql.HatchPet(req.UserID, req.Egg, req.Potion, h.db)
+	if err != nil {
+		h.stableError(w, requestID, err, "Failed to hatch pet")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(pet); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) FeedPet(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Pet    string `json:"pet"`
+		Food   string `json:"food"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !game.ValidPet(req.Pet) {
+		http.Error(w, "unknown pet "+req.Pet, http.StatusBadRequest)
+		return
+	}
+	if !game.ValidDrop(game.DropFood, req.Food) {
+		http.Error(w, "unknown food "+req.Food, http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("pet", req.Pet).Str("food", req.Food).Msg("Feeding pet")
+
+	pet, mount, err := postgresql.FeedPet(req.UserID, req.Pet, req.Food, h.db)
+	if err != nil {
+		h.stableError(w, requestID, err, "Failed to feed pet")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := map[string]interface{}{
+		"pet":   pet,
+		"mount": mount,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) ReleasePet(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Pet    string `json:"pet"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Str("pet", req.Pet).Msg("Releasing pet")
+
+	if err := postgresql.ReleasePet(req.UserID, req.Pet, h.db); err != nil {
+		h.stableError(w, requestID, err, "Failed to release pet")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stableError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Warn().Str("request_id", requestID).Err(err).Msg(message)
+	switch err.Error() {
+	case "item not in inventory", "pet not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "pet already hatched":
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/events"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/ws"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	streamHeartbeat  = 25 * time.Second
+	streamReplayPage = 500
+)
+
+func (h *Handler) NewStreamToken(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Issuing stream token")
+
+	token, err := postgresql.IssueToken(req.UserID, postgresql.TokenScopeStream, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to issue stream token")
+		http.Error(w, "Failed to issue stream token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"token": token,
+	}); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+// Stream - Server-Sent Events с изменениями привычек, ежедневных задач,
+// задач и статов пользователя. Токен передается в query (EventSource не
+// умеет ставить заголовки). После переподключения браузер присылает
+// Last-Event-ID, и поток продолжается с пропущенных событий.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	userID, err := postgresql.GetUserIDByToken(r.URL.Query().Get("token"), postgresql.TokenScopeStream, h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Stream rejected")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID int64
+	if lastID != "" {
+		lastEventID, err = strconv.ParseInt(lastID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Подписываемся до чтения журнала, чтобы не потерять события между ними
+	sub := h.hub.Subscribe(userID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", userID).Int64("last_event_id", lastEventID).Msg("Stream opened")
+	defer h.log.Info().Str("request_id", requestID).Int("user_id", userID).Msg("Stream closed")
+
+	// Пропущенное отдается целиком, страницами: иначе живые события
+	// сдвинули бы lastEventID за пропуск, и клиент его бы не заметил
+	if lastEventID > 0 {
+		lastEventID, err = h.hub.Replay(userID, lastEventID, streamReplayPage, func(event events.Event) error {
+			return writeEvent(w, event)
+		})
+		if err != nil {
+			h.log.Warn().Str("request_id", requestID).Err(err).Msg("Failed to replay events")
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-sub.C:
+			// Канал закрыт - клиент не успевал читать, пусть переподключится
+			if !ok {
+				return
+			}
+			if event.ID <= lastEventID {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastEventID = event.ID
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// WebSocket - двусторонний канал для чата групп, присутствия и тех же
+// событий пользователя, что и в Stream. Авторизация тем же токеном потока.
+func (h *Handler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	userID, err := postgresql.GetUserIDByToken(r.URL.Query().Get("token"), postgresql.TokenScopeStream, h.db)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("WebSocket rejected")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := ws.Upgrade(w, r, h.cfg.WebSocket.AllowedOrigins)
+	if err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("WebSocket upgrade failed")
+		return
+	}
+
+	h.rt.Serve(conn, userID)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// AddTaskDependency - задача task_id не может быть выполнена раньше
+// blocked_by
+func (h *Handler) AddTaskDependency(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var dep models.TaskDependency
+	if err := json.NewDecoder(r.Body).Decode(&dep); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := dep.Validate(); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Validation failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("task_id", dep.TaskID).Int("blocked_by", dep.BlockedBy).Msg("Adding task dependency")
+
+	task, err := postgresql.AddTaskDependency(dep, h.db)
+	if err != nil {
+		h.taskError(w, requestID, err, "Failed to add task dependency")
+		return
+	}
+	h.emitTaskUpdated(requestID, task)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":     "success",
+		"dependency": dep,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) DeleteTaskDependency(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var dep models.TaskDependency
+	if err := json.NewDecoder(r.Body).Decode(&dep); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("task_id", dep.TaskID).Int("blocked_by", dep.BlockedBy).Msg("Deleting task dependency")
+
+	task, err := postgresql.DeleteTaskDependency(dep, h.db)
+	if err != nil {
+		h.taskError(w, requestID, err, "Failed to delete task dependency")
+		return
+	}
+	h.emitTaskUpdated(requestID, task)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emitTaskUpdated сообщает клиентам, что у задачи изменились зависимости
+// и, возможно, блокировка
+func (h *Handler) emitTaskUpdated(requestID string, task models.Task) {
+	h.emit(requestID, events.New(events.ItemUpdated, task.UserID, map[string]interface{}{
+		"kind": "task",
+		"item": task,
+	}))
+}
+
+// taskError - ошибки изменения задач, их родителей и зависимостей
+func (h *Handler) taskError(w http.ResponseWriter, requestID string, err error, message string) {
+	h.log.Warn().Str("request_id", requestID).Err(err).Msg(message)
+	switch err.Error() {
+	case "task not found", "parent task not found", "blocking task not found", "dependency not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case "task already completed", "task is blocked", "task has incomplete subtasks",
+		"task cannot be moved under its own subtask", "dependency would create a cycle",
+		"dependency already exists":
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"huibitica/internal/events"
+	"huibitica/internal/logger"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/webhooks"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const deliveryLogLimit = 100
+
+func (h *Handler) NewWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook models.Webhook
+
+	requestID := middleware.GetReqID(r.Context())
+
+	body, err := logger.RequestLogger(requestID, r, h.log)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Invalid JSON")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := webhooks.CheckURL(r.Context(), webhook.URL); err != nil {
+		h.log.Warn().Str("request_id", requestID).Err(err).Msg("Webhook URL rejected")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(webhook.Events) == 0 {
+		webhook.Events = []string{events.All}
+	}
+	for _, event := range webhook.Events {
+		if !events.Valid(event) {
+			http.Error(w, "unknown event "+event, http.StatusBadRequest)
+			return
+		}
+	}
+	if webhook.Secret == "" {
+		webhook.Secret, err = webhooks.NewSecret()
+		if err != nil {
+			h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to generate webhook secret")
+			http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+			return
+		}
+	}
+	webhook.Active = true
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", webhook.UserID).Msg("Attempting to create webhook")
+
+	webhook.ID, err = postgresql.AddWebhook(webhook, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to create webhook")
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Webhook created successfully",
+		"webhook": webhook,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Msg("Fetching webhooks")
+
+	hooks, err := postgresql.GetWebhooks(req.UserID, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch webhooks")
+		http.Error(w, "Failed to fetch webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(hooks); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		WebhookID int `json:"webhook_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("webhook_id", req.WebhookID).Msg("Attempting to delete webhook")
+
+	if err := postgresql.DeleteWebhook(req.WebhookID, h.db); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to delete webhook")
+		if err.Error() == "webhook not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	requestID := middleware.GetReqID(r.Context())
+
+	var req struct {
+		UserID    int `json:"user_id"`
+		WebhookID int `json:"webhook_id,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Invalid request body")
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log.Info().Str("request_id", requestID).Int("user_id", req.UserID).Int("webhook_id", req.WebhookID).Msg("Fetching webhook deliveries")
+
+	deliveries, err := postgresql.GetWebhookDeliveries(req.UserID, req.WebhookID, deliveryLogLimit, h.db)
+	if err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to fetch webhook deliveries")
+		http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		h.log.Error().Str("request_id", requestID).Err(err).Msg("Failed to encode response")
+	}
+}
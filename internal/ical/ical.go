@@ -0,0 +1,206 @@
+package ical
+
+import (
+	"fmt"
+	"huibitica/internal/models"
+	"huibitica/internal/schedule"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405Z"
+	maxLineOctets  = 75
+	uidDomain      = "huibitica"
+)
+
+// Calendar собирает VCALENDAR с элементами пользователя. UID элементов
+// строятся из ID в базе, поэтому клиенты обновляют события, а не дублируют их.
+type Calendar struct {
+	Name string
+	// TasksAsEvents выводит задачи как VEVENT вместо VTODO - многие
+	// календари не показывают VTODO.
+	TasksAsEvents bool
+	// Clock - часы пользователя, по ним считается срок задач со временем
+	// (schedule.DueAt)
+	Clock schedule.Clock
+
+	stamp time.Time
+	lines []string
+}
+
+func NewCalendar(name string, now time.Time) *Calendar {
+	return &Calendar{Name: name, stamp: now.UTC()}
+}
+
+func (c *Calendar) AddTask(task models.Task) {
+	component := "VTODO"
+	if c.TasksAsEvents {
+		component = "VEVENT"
+	}
+
+	c.add("BEGIN:" + component)
+	c.add(fmt.Sprintf("UID:task-%d@%s", task.ID, uidDomain))
+	c.add("DTSTAMP:" + c.stamp.Format(dateTimeLayout))
+	c.add("SUMMARY:" + escapeText(task.Name))
+	if task.Note != "" {
+		c.add("DESCRIPTION:" + escapeText(task.Note))
+	}
+	// Выполненный экземпляр уже не повторяется - повторы несет следующий
+	recurring := task.Recurrence != "" && !task.Completed
+	switch {
+	case task.DeadlineTime != "":
+		// Срок со временем - точный момент, в UTC, чтобы не описывать
+		// пояс в VTIMEZONE
+		due := schedule.DueAt(task, c.Clock).UTC().Format(dateTimeLayout)
+		c.add("DTSTART:" + due)
+		if !c.TasksAsEvents {
+			c.add("DUE:" + due)
+		}
+	case c.TasksAsEvents:
+		c.add("DTSTART;VALUE=DATE:" + task.Deadline.Format(dateLayout))
+		c.add("DTEND;VALUE=DATE:" + task.Deadline.AddDate(0, 0, 1).Format(dateLayout))
+	default:
+		// RRULE требует DTSTART (RFC 5545), повторы отсчитываются от срока
+		if recurring {
+			c.add("DTSTART;VALUE=DATE:" + task.Deadline.Format(dateLayout))
+		}
+		c.add("DUE;VALUE=DATE:" + task.Deadline.Format(dateLayout))
+	}
+	if recurring {
+		c.add("RRULE:" + task.Recurrence)
+	}
+	if task.Completed && !c.TasksAsEvents {
+		c.add("STATUS:COMPLETED")
+		if task.CompletedAt != nil {
+			c.add("COMPLETED:" + task.CompletedAt.UTC().Format(dateTimeLayout))
+		}
+	}
+	c.add(fmt.Sprintf("PRIORITY:%d", priority(task.Priority)))
+	c.add("END:" + component)
+}
+
+func (c *Calendar) AddDaily(daily models.Daily) {
+	c.add("BEGIN:VEVENT")
+	c.add(fmt.Sprintf("UID:daily-%d@%s", daily.ID, uidDomain))
+	c.add("DTSTAMP:" + c.stamp.Format(dateTimeLayout))
+	c.add("SUMMARY:" + escapeText(daily.Text))
+	if daily.Note != "" {
+		c.add("DESCRIPTION:" + escapeText(daily.Note))
+	}
+	c.add("DTSTART;VALUE=DATE:" + daily.StartDate.Format(dateLayout))
+	c.add("DTEND;VALUE=DATE:" + daily.StartDate.AddDate(0, 0, 1).Format(dateLayout))
+	c.add("RRULE:" + RRule(daily))
+	c.add("TRANSP:TRANSPARENT")
+	c.add("END:VEVENT")
+}
+
+func (c *Calendar) String() string {
+	var b strings.Builder
+	for _, line := range []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//huibitica//calendar feed//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:" + escapeText(c.Name),
+	} {
+		b.WriteString(fold(line))
+	}
+	for _, line := range c.lines {
+		b.WriteString(fold(line))
+	}
+	b.WriteString(fold("END:VCALENDAR"))
+	return b.String()
+}
+
+func (c *Calendar) add(line string) {
+	c.lines = append(c.lines, line)
+}
+
+// RRule строит правило повтора из RepeatEvery/RepeatEveryX/DayWeeks
+func RRule(daily models.Daily) string {
+	freq := "DAILY"
+	switch daily.RepeatEvery {
+	case models.RepeatWeekly:
+		freq = "WEEKLY"
+	case models.RepeatMonthly:
+		freq = "MONTHLY"
+	case models.RepeatYearly:
+		freq = "YEARLY"
+	}
+
+	rule := "FREQ=" + freq
+	if daily.RepeatEveryX > 1 {
+		rule += fmt.Sprintf(";INTERVAL=%d", daily.RepeatEveryX)
+	}
+
+	if daily.RepeatEvery == models.RepeatWeekly {
+		// Без DayWeeks задача положена только в день недели начала
+		// (schedule.IsDue) - пишем его явно, а не полагаемся на DTSTART
+		dayWeeks := daily.DayWeeks
+		if dayWeeks == "" {
+			dayWeeks = models.WeekDays[daily.StartDate.Weekday()]
+		}
+		var days []string
+		for _, day := range strings.Split(dayWeeks, ",") {
+			day = strings.TrimSpace(strings.ToLower(day))
+			if len(day) >= 2 {
+				days = append(days, strings.ToUpper(day[:2]))
+			}
+		}
+		if len(days) > 0 {
+			rule += ";BYDAY=" + strings.Join(days, ",")
+		}
+	}
+
+	return rule
+}
+
+// priority переводит Task.Priority в PRIORITY iCalendar: 1 - высший,
+// 5 - средний, 9 - низший, 0 - не задан (RFC 5545, 3.8.1.9)
+func priority(taskPriority int) int {
+	switch taskPriority {
+	case models.PriorityHigh:
+		return 1
+	case models.PriorityMedium:
+		return 5
+	case models.PriorityLow:
+		return 9
+	default:
+		return 0
+	}
+}
+
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
+
+// fold разбивает строку длиннее 75 октетов по RFC 5545, не разрезая
+// многобайтовые символы.
+func fold(line string) string {
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
@@ -0,0 +1,348 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"huibitica/internal/models"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Item - VTODO или VEVENT из загруженного календаря
+type Item struct {
+	Component   string
+	UID         string
+	Summary     string
+	Description string
+	Due         time.Time
+	Start       time.Time
+	RRule       string
+	Priority    int
+
+	// dueTimed/startTimed - у DUE/DTSTART есть время, а не только дата;
+	// floating - время без пояса (по часам пользователя)
+	dueTimed, startTimed, floating bool
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse читает VTODO и VEVENT, остальные компоненты (VTIMEZONE, VALARM...)
+// пропускаются.
+func Parse(r io.Reader) ([]Item, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	var current *Item
+	depth := 0
+
+	for _, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch prop.name {
+		case "BEGIN":
+			if current != nil {
+				depth++
+				continue
+			}
+			if prop.value == "VTODO" || prop.value == "VEVENT" {
+				current = &Item{Component: prop.value}
+			}
+			continue
+		case "END":
+			if current == nil {
+				continue
+			}
+			if depth > 0 {
+				depth--
+				continue
+			}
+			items = append(items, *current)
+			current = nil
+			continue
+		}
+
+		// Свойства вложенных компонентов (например, VALARM) не относятся к элементу
+		if current == nil || depth > 0 {
+			continue
+		}
+
+		switch prop.name {
+		case "UID":
+			current.UID = prop.value
+		case "SUMMARY":
+			current.Summary = unescapeText(prop.value)
+		case "DESCRIPTION":
+			current.Description = unescapeText(prop.value)
+		case "DUE":
+			current.Due, current.dueTimed, err = parseTime(prop)
+			current.floating = current.dueTimed && floating(prop)
+		case "DTSTART":
+			current.Start, current.startTimed, err = parseTime(prop)
+			if current.Due.IsZero() {
+				current.floating = current.startTimed && floating(prop)
+			}
+		case "RRULE":
+			current.RRule = prop.value
+		case "PRIORITY":
+			current.Priority, _ = strconv.Atoi(prop.value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", prop.name, current.Component, err)
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("unterminated %s", current.Component)
+	}
+
+	return items, nil
+}
+
+// Date возвращает срок элемента: DUE, а если его нет - DTSTART
+func (i Item) Date() time.Time {
+	if !i.Due.IsZero() {
+		return i.Due
+	}
+	return i.Start
+}
+
+// Timed - указано ли у срока элемента (см. Date) время
+func (i Item) Timed() bool {
+	if !i.Due.IsZero() {
+		return i.dueTimed
+	}
+	return i.startTimed
+}
+
+// Task переводит элемент в задачу. Время срока сохраняется в
+// DeadlineTime и DeadlineTimezone; время без пояса считается по часам
+// пользователя. RRULE переносится в Recurrence, если его можно выразить
+// правилом повтора задачи, иначе задача становится разовой.
+func (i Item) Task() models.Task {
+	date := i.Date()
+	task := models.Task{
+		Name:     models.Truncate(i.Summary, models.MaxTextLength),
+		Note:     models.Truncate(i.Description, models.MaxNoteLength),
+		Priority: taskPriority(i.Priority),
+		Deadline: time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+	}
+	if i.Timed() {
+		task.DeadlineTime = date.Format("15:04")
+		if !i.floating {
+			task.DeadlineTimezone = date.Location().String()
+		}
+	}
+	if i.RRule != "" {
+		if rule, err := models.ParseRecurrence(i.RRule); err == nil {
+			task.Recurrence = rule.String()
+		}
+	}
+	return task
+}
+
+func (i Item) Daily() (models.Daily, error) {
+	repeatEvery, everyX, dayWeeks, err := ParseRRule(i.RRule)
+	if err != nil {
+		return models.Daily{}, err
+	}
+	return models.Daily{
+		Text:         models.Truncate(i.Summary, models.MaxTextLength),
+		Note:         models.Truncate(i.Description, models.MaxNoteLength),
+		Difficulty:   difficulty(i.Priority),
+		StartDate:    i.Date(),
+		RepeatEvery:  repeatEvery,
+		RepeatEveryX: everyX,
+		DayWeeks:     dayWeeks,
+	}, nil
+}
+
+// ParseRRule - обратная операция к RRule. Части правила, которые нельзя
+// выразить в Daily (COUNT, UNTIL, BYMONTHDAY...), отбрасываются.
+func ParseRRule(rule string) (repeatEvery int, everyX int, dayWeeks string, err error) {
+	everyX = 1
+	for _, part := range strings.Split(rule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch strings.ToUpper(value) {
+			case "DAILY":
+				repeatEvery = models.RepeatDaily
+			case "WEEKLY":
+				repeatEvery = models.RepeatWeekly
+			case "MONTHLY":
+				repeatEvery = models.RepeatMonthly
+			case "YEARLY":
+				repeatEvery = models.RepeatYearly
+			default:
+				return 0, 0, "", fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			everyX, err = strconv.Atoi(value)
+			if err != nil || everyX < 1 {
+				return 0, 0, "", fmt.Errorf("invalid interval %q", value)
+			}
+		case "BYDAY":
+			var days []string
+			for _, day := range strings.Split(value, ",") {
+				// Префиксы вида "1MO" (первый понедельник) не поддерживаются:
+				// без них правило означало бы каждый понедельник
+				found := false
+				for _, weekDay := range models.WeekDays {
+					if strings.EqualFold(weekDay[:2], day) {
+						days = append(days, weekDay)
+						found = true
+					}
+				}
+				if !found {
+					return 0, 0, "", fmt.Errorf("unsupported day %q", day)
+				}
+			}
+			dayWeeks = strings.Join(days, ",")
+		}
+	}
+	return repeatEvery, everyX, dayWeeks, nil
+}
+
+// taskPriority - обратная операция к priority: 1-4 - высокий, 5 -
+// средний, 6-9 - низкий
+func taskPriority(priority int) int {
+	switch {
+	case priority >= 1 && priority <= 4:
+		return models.PriorityHigh
+	case priority == 5:
+		return models.PriorityMedium
+	case priority >= 6 && priority <= 9:
+		return models.PriorityLow
+	default:
+		return models.PriorityNone
+	}
+}
+
+// difficulty - сложность ежедневной задачи по PRIORITY: у них нет
+// приоритета, а важное обычно и труднее
+func difficulty(priority int) int {
+	if priority < 1 || priority > 9 {
+		return 3
+	}
+	return (11 - priority) / 2
+}
+
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(lines) > 0 {
+				lines[len(lines)-1] += line[1:]
+			}
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+func parseProperty(line string) (property, error) {
+	// Двоеточие внутри параметров может быть в кавычках
+	inQuotes := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuotes = !inQuotes
+		}
+		if c == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := property{
+		name:   strings.ToUpper(parts[0]),
+		params: map[string]string{},
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// parseTime читает DATE или DATE-TIME; timed - было ли указано время
+func parseTime(prop property) (t time.Time, timed bool, err error) {
+	if prop.params["VALUE"] == "DATE" || len(prop.value) == len(dateLayout) {
+		t, err = time.Parse(dateLayout, prop.value)
+		return t, false, err
+	}
+	if strings.HasSuffix(prop.value, "Z") {
+		t, err = time.Parse(dateTimeLayout, prop.value)
+		return t, true, err
+	}
+
+	location := time.UTC
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			location = loc
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", prop.value, location)
+	return t, true, err
+}
+
+// floating - время без пояса: ни Z, ни известного TZID
+func floating(prop property) bool {
+	if strings.HasSuffix(prop.value, "Z") {
+		return false
+	}
+	if tzid := prop.params["TZID"]; tzid != "" {
+		_, err := time.LoadLocation(tzid)
+		return err != nil
+	}
+	return true
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range s {
+		if escaped {
+			switch c {
+			case 'n', 'N':
+				b.WriteRune('\n')
+			default:
+				b.WriteRune(c)
+			}
+			escaped = false
+			continue
+		}
+		if c == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -22,6 +23,10 @@ type User struct {
 	Email     string    `json:"email" db:"email"`
 	Phone     string    `json:"phone,omitempty" db:"phone"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// Часовой пояс IANA и час начала дня - по ним считаются "сегодня",
+	// смена дня и напоминания
+	Timezone string `json:"timezone" db:"timezone"`
+	DayStart int    `json:"day_start" db:"day_start"`
 }
 
 type Password struct {
@@ -31,16 +36,54 @@ type Password struct {
 }
 
 type Habit struct {
-	ID              int    `json:"id" db:"id"`
-	UserID          int    `json:"user_id" db:"user_id"`
-	Text            string `json:"text" db:"text"`
-	Note            string `json:"note,omitempty" db:"note"`
-	Good            bool   `json:"good" db:"good"`
-	Bad             bool   `json:"bad" db:"bad"`
-	Difficulty      int    `json:"difficulty" db:"difficulty"`
-	CountResetAfter int    `json:"count_reset_after" db:"count_reset_after"`
-	GoodCount       int    `json:"good_count" db:"good_count"`
-	BadCount        int    `json:"bad_count" db:"bad_count"`
+	ID         int    `json:"id" db:"id"`
+	UserID     int    `json:"user_id" db:"user_id"`
+	Text       string `json:"text" db:"text"`
+	Note       string `json:"note,omitempty" db:"note"`
+	Good       bool   `json:"good" db:"good"`
+	Bad        bool   `json:"bad" db:"bad"`
+	Difficulty int    `json:"difficulty" db:"difficulty"`
+	// CountReset - когда обнулять счетчики, одно из ResetPeriods
+	CountReset string `json:"count_reset" db:"count_reset"`
+	// Счетчики текущего периода, начавшегося в CountsSince
+	GoodCount   int       `json:"good_count" db:"good_count"`
+	BadCount    int       `json:"bad_count" db:"bad_count"`
+	CountsSince time.Time `json:"counts_since" db:"counts_since"`
+	// Счетчики за все время, при сбросе не обнуляются
+	TotalGoodCount int `json:"total_good_count" db:"total_good_count"`
+	TotalBadCount  int `json:"total_bad_count" db:"total_bad_count"`
+	// Value - сила привычки (формула в game.HabitDelta), Strength - ее
+	// уровень для раскраски в клиентах
+	Value    float64 `json:"value" db:"value"`
+	Strength string  `json:"strength" db:"-"`
+}
+
+// Значения Habit.CountReset. Недели начинаются с дня из настроек
+// пользователя (Settings.WeekStart).
+const (
+	ResetNever   = "never"
+	ResetDaily   = "daily"
+	ResetWeekly  = "weekly"
+	ResetMonthly = "monthly"
+)
+
+var ResetPeriods = []string{ResetNever, ResetDaily, ResetWeekly, ResetMonthly}
+
+// ResetPeriod - период сброса; пустое значение означает ResetNever
+func (h Habit) ResetPeriod() string {
+	if h.CountReset == "" {
+		return ResetNever
+	}
+	return h.CountReset
+}
+
+// HabitPeriod - счетчики привычки за завершившийся период
+type HabitPeriod struct {
+	HabitID     int       `json:"habit_id" db:"habit_id"`
+	PeriodStart time.Time `json:"period_start" db:"period_start"`
+	PeriodEnd   time.Time `json:"period_end" db:"period_end"`
+	GoodCount   int       `json:"good_count" db:"good_count"`
+	BadCount    int       `json:"bad_count" db:"bad_count"`
 }
 
 type Daily struct {
@@ -54,13 +97,543 @@ type Daily struct {
 	RepeatEveryX int       `json:"repeat_every_x" db:"repeat_every_x"`
 	DayWeeks     string    `json:"day_weeks,omitempty" db:"dayweeks"`
 	Streak       int       `json:"streak" db:"streak"`
+	// Дата последнего выполнения, nil - еще не выполнялась
+	LastCompleted *time.Time `json:"last_completed,omitempty" db:"last_completed"`
 }
 
+// Значения Daily.RepeatEvery. RepeatEveryX задает интервал в этих единицах
+// (каждые X дней/недель/...), значения меньше 1 считаются за 1.
+// DayWeeks используется для еженедельного повтора и содержит дни недели
+// через запятую: "mon,wed,fri". Пустая строка - день недели StartDate.
+const (
+	RepeatDaily = iota
+	RepeatWeekly
+	RepeatMonthly
+	RepeatYearly
+)
+
+var WeekDays = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
 type Task struct {
-	ID         int       `json:"id" db:"id"`
-	UserID     int       `json:"user_id" db:"user_id"`
-	Name       string    `json:"name" db:"name"`
-	Note       string    `json:"note,omitempty" db:"note"`
-	Difficulty int       `json:"difficulty" db:"difficulty"`
-	Deadline   time.Time `json:"deadline" db:"deadline"`
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	Note        string     `json:"note,omitempty" db:"note"`
+	Difficulty  int        `json:"difficulty" db:"difficulty"`
+	Deadline    time.Time  `json:"deadline" db:"deadline"`
+	Completed   bool       `json:"completed" db:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	// Recurrence - правило повтора (см. Recurrence). При выполнении
+	// создается следующий экземпляр с новым сроком.
+	Recurrence string `json:"recurrence,omitempty" db:"recurrence"`
+	Priority   int    `json:"priority" db:"priority"`
+	// StartDate - с какого дня задача попадает в план на день
+	StartDate *time.Time `json:"start_date,omitempty" db:"start_date"`
+	// DeadlineTime ("HH:MM") уточняет срок до времени в поясе
+	// DeadlineTimezone, по умолчанию - в поясе пользователя. Без времени
+	// срок истекает в конце дня Deadline.
+	DeadlineTime     string `json:"deadline_time,omitempty" db:"deadline_time"`
+	DeadlineTimezone string `json:"deadline_timezone,omitempty" db:"deadline_timezone"`
+	EstimatedMinutes int    `json:"estimated_minutes,omitempty" db:"estimated_minutes"`
+	// ParentID - родительская задача. Родителя нельзя выполнить, пока не
+	// выполнены все его подзадачи, если не задан AllowIncompleteSubtasks.
+	ParentID                *int `json:"parent_id,omitempty" db:"parent_id"`
+	AllowIncompleteSubtasks bool `json:"allow_incomplete_subtasks,omitempty" db:"allow_incomplete_subtasks"`
+	// DueAt - вычисленный момент срока, только в ответах
+	DueAt *time.Time `json:"due_at,omitempty" db:"-"`
+	// BlockedBy - задачи, которые нужно выполнить раньше этой. Blocked -
+	// среди них (или у одного из родителей) есть невыполненные. Оба поля
+	// только в ответах, зависимости меняются отдельными запросами.
+	BlockedBy []int `json:"blocked_by,omitempty" db:"-"`
+	Blocked   bool  `json:"blocked,omitempty" db:"-"`
+}
+
+// TaskDependency - задача TaskID заблокирована задачей BlockedBy
+type TaskDependency struct {
+	TaskID    int `json:"task_id" db:"task_id"`
+	BlockedBy int `json:"blocked_by" db:"blocked_by"`
+}
+
+// Значения Task.Priority
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+// Представления списка задач: все, план на сегодня, просроченные
+const (
+	TaskViewAll     = ""
+	TaskViewToday   = "today"
+	TaskViewOverdue = "overdue"
+)
+
+// TaskTemplate - набор задач, который можно создать разом. Сроки задаются
+// в днях от даты применения шаблона.
+type TaskTemplate struct {
+	ID        int            `json:"template_id" db:"template_id"`
+	UserID    int            `json:"user_id" db:"user_id"`
+	Name      string         `json:"name" db:"name"`
+	Tasks     []TemplateTask `json:"tasks" db:"tasks"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+}
+
+type TemplateTask struct {
+	Name             string `json:"name"`
+	Note             string `json:"note,omitempty"`
+	Difficulty       int    `json:"difficulty"`
+	Priority         int    `json:"priority"`
+	DeadlineDays     int    `json:"deadline_days"`
+	DeadlineTime     string `json:"deadline_time,omitempty"`
+	EstimatedMinutes int    `json:"estimated_minutes,omitempty"`
+	Recurrence       string `json:"recurrence,omitempty"`
+}
+
+// Task - задача из шаблона со сроком через DeadlineDays дней от start
+func (t TemplateTask) Task(userID int, start time.Time) Task {
+	return Task{
+		UserID:           userID,
+		Name:             t.Name,
+		Note:             t.Note,
+		Difficulty:       t.Difficulty,
+		Priority:         t.Priority,
+		Deadline:         start.AddDate(0, 0, t.DeadlineDays),
+		DeadlineTime:     t.DeadlineTime,
+		EstimatedMinutes: t.EstimatedMinutes,
+		Recurrence:       t.Recurrence,
+	}
+}
+
+type AccountData struct {
+	User    User    `json:"user"`
+	Habits  []Habit `json:"habits"`
+	Dailies []Daily `json:"dailies"`
+	Tasks   []Task  `json:"tasks"`
+}
+
+type ImportRequest struct {
+	UserID     int         `json:"user_id"`
+	Password   string      `json:"password,omitempty"`
+	DryRun     bool        `json:"dry_run"`
+	OnConflict string      `json:"on_conflict,omitempty"`
+	Data       AccountData `json:"data"`
+	// Ignored - элементы, которые конвертер исходного формата не смог
+	// перенести; попадают в отчет как есть.
+	Ignored []ImportedItem `json:"-"`
+}
+
+type ImportedItem struct {
+	Kind  string `json:"kind"`
+	OldID int    `json:"old_id"`
+	NewID int    `json:"new_id,omitempty"`
+	Text  string `json:"text"`
+}
+
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	UserID  int            `json:"user_id"`
+	Created []ImportedItem `json:"created"`
+	Skipped []ImportedItem `json:"skipped,omitempty"`
+	Ignored []ImportedItem `json:"ignored,omitempty"`
+}
+
+const (
+	ConflictCreate = "create"
+	ConflictSkip   = "skip"
+	ConflictFail   = "fail"
+)
+
+type Stats struct {
+	UserID int `json:"user_id" db:"user_id"`
+	Level  int `json:"level" db:"level"`
+	XP     int `json:"xp" db:"xp"`
+	Gold   int `json:"gold" db:"gold"`
+	HP     int `json:"hp" db:"hp"`
+	Mana   int `json:"mana" db:"mana"`
+	// Класс выбирается с game.ClassLevel уровня, до этого пустой
+	Class string `json:"class,omitempty" db:"class"`
+}
+
+type ScoreResult struct {
+	Stats     Stats `json:"stats"`
+	DeltaXP   int   `json:"delta_xp"`
+	DeltaGold int   `json:"delta_gold"`
+	DeltaHP   int   `json:"delta_hp"`
+	LeveledUp bool  `json:"leveled_up"`
+	Died      bool  `json:"died"`
+}
+
+type Webhook struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	URL       string    `json:"url" db:"url"`
+	Secret    string    `json:"secret,omitempty" db:"secret"`
+	Events    []string  `json:"events" db:"events"`
+	Active    bool      `json:"active" db:"active"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID            int        `json:"id" db:"id"`
+	WebhookID     int        `json:"webhook_id" db:"webhook_id"`
+	URL           string     `json:"url,omitempty" db:"url"`
+	Secret        string     `json:"-" db:"secret"`
+	Event         string     `json:"event" db:"event"`
+	Payload       []byte     `json:"-" db:"payload"`
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatus    int        `json:"last_status,omitempty" db:"last_status"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type NotificationSettings struct {
+	UserID       int    `json:"user_id" db:"user_id"`
+	EmailEnabled bool   `json:"email_enabled" db:"email_enabled"`
+	RemindAt     string `json:"remind_at" db:"remind_at"`
+	DeadlineDays int    `json:"deadline_days" db:"deadline_days"`
+	Email        string `json:"-" db:"email"`
+}
+
+// ReminderRecipient - пользователь, которому пора напомнить, его часы
+// (см. schedule.Clock) и текущий день
+type ReminderRecipient struct {
+	NotificationSettings
+	Timezone string
+	DayStart int
+	Day      time.Time
+}
+
+// ReminderItem - строка напоминания. Due - день срока; At - момент срока,
+// если у задачи указано время (DeadlineTime)
+type ReminderItem struct {
+	Kind string     `json:"kind"`
+	ID   int        `json:"id"`
+	Text string     `json:"text"`
+	Due  time.Time  `json:"due"`
+	At   *time.Time `json:"at,omitempty"`
+}
+
+type PushKeys struct {
+	P256dh string `json:"p256dh" db:"p256dh"`
+	Auth   string `json:"auth" db:"auth"`
+}
+
+// NotificationChannel - устройство или адрес, куда пользователь хочет
+// получать напоминания. Для webpush Endpoint и Keys берутся из
+// PushSubscription браузера. Keys только принимаются: Auth - секрет
+// подписки, в ответы он не попадает (см. MarshalJSON).
+type NotificationChannel struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Endpoint  string    `json:"endpoint" db:"endpoint"`
+	Keys      PushKeys  `json:"keys,omitempty"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (c NotificationChannel) MarshalJSON() ([]byte, error) {
+	type channel NotificationChannel
+	return json.Marshal(struct {
+		channel
+		Keys *PushKeys `json:"keys,omitempty"`
+	}{channel: channel(c)})
+}
+
+const (
+	ChannelEmail   = "email"
+	ChannelWebPush = "webpush"
+	ChannelWebhook = "webhook"
+	ChannelLog     = "log"
+)
+
+type EventRecord struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Type      string    `json:"event" db:"type"`
+	Data      []byte    `json:"data" db:"data"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type ChatMessage struct {
+	ID        int64     `json:"id" db:"id"`
+	Channel   string    `json:"channel" db:"channel"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Text      string    `json:"text" db:"text"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type Party struct {
+	ID        int       `json:"id" db:"party_id"`
+	Name      string    `json:"name" db:"name"`
+	OwnerID   int       `json:"owner_id" db:"owner_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PartyMember - участник группы. ShareStats и ShareProgress определяют,
+// что видят остальные участники в обзоре группы.
+type PartyMember struct {
+	PartyID       int       `json:"party_id" db:"party_id"`
+	UserID        int       `json:"user_id" db:"user_id"`
+	Username      string    `json:"username" db:"username"`
+	ShareStats    bool      `json:"share_stats" db:"share_stats"`
+	ShareProgress bool      `json:"share_progress" db:"share_progress"`
+	JoinedAt      time.Time `json:"joined_at" db:"joined_at"`
+}
+
+type PartyInvite struct {
+	PartyID   int       `json:"party_id" db:"party_id"`
+	PartyName string    `json:"party_name" db:"name"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	InviterID int       `json:"inviter_id" db:"inviter_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// DayProgress - выполнение за сегодня
+type DayProgress struct {
+	DailiesDue     int `json:"dailies_due"`
+	DailiesDone    int `json:"dailies_done"`
+	TasksCompleted int `json:"tasks_completed"`
+}
+
+// PartyMemberView - участник в обзоре группы. Stats и Today пустые,
+// если участник скрыл их настройками приватности.
+type PartyMemberView struct {
+	UserID   int          `json:"user_id"`
+	Username string       `json:"username"`
+	Owner    bool         `json:"owner"`
+	JoinedAt time.Time    `json:"joined_at"`
+	Stats    *Stats       `json:"stats,omitempty"`
+	Today    *DayProgress `json:"today,omitempty"`
+}
+
+type PartyView struct {
+	Party   Party             `json:"party"`
+	Members []PartyMemberView `json:"members"`
+}
+
+// ChallengeTemplates - привычки, ежедневные задачи и задачи испытания.
+// При вступлении они копируются участнику.
+type ChallengeTemplates struct {
+	Habits  []Habit `json:"habits"`
+	Dailies []Daily `json:"dailies"`
+	Tasks   []Task  `json:"tasks"`
+}
+
+type Challenge struct {
+	ID          int                `json:"id" db:"challenge_id"`
+	OwnerID     int                `json:"owner_id" db:"owner_id"`
+	Name        string             `json:"name" db:"name"`
+	Description string             `json:"description,omitempty" db:"description"`
+	Templates   ChallengeTemplates `json:"templates" db:"templates"`
+	Members     int                `json:"members" db:"-"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at"`
+}
+
+// ChallengeLink связывает скопированный элемент участника с испытанием
+type ChallengeLink struct {
+	ChallengeID int    `json:"challenge_id" db:"challenge_id"`
+	UserID      int    `json:"user_id" db:"user_id"`
+	Kind        string `json:"kind" db:"kind"`
+	ItemID      int    `json:"item_id" db:"item_id"`
+}
+
+// LeaderboardEntry - очки участника по связанным элементам: баланс
+// привычек за все время, сумма текущих серий ежедневных задач и число
+// выполненных задач
+type LeaderboardEntry struct {
+	Rank           int    `json:"rank"`
+	UserID         int    `json:"user_id"`
+	Username       string `json:"username"`
+	HabitScore     int    `json:"habit_score"`
+	StreakTotal    int    `json:"streak_total"`
+	BestStreak     int    `json:"best_streak"`
+	TasksCompleted int    `json:"tasks_completed"`
+	Score          int    `json:"score"`
+}
+
+// Статусы квеста группы. Активным может быть только один квест группы.
+const (
+	QuestActive    = "active"
+	QuestWon       = "won"
+	QuestAbandoned = "abandoned"
+)
+
+type Quest struct {
+	ID            int                 `json:"id" db:"quest_id"`
+	PartyID       int                 `json:"party_id" db:"party_id"`
+	Boss          string              `json:"boss" db:"boss"`
+	HP            int                 `json:"hp" db:"hp"`
+	MaxHP         int                 `json:"max_hp" db:"max_hp"`
+	Status        string              `json:"status" db:"status"`
+	StartedAt     time.Time           `json:"started_at" db:"started_at"`
+	FinishedAt    *time.Time          `json:"finished_at,omitempty" db:"finished_at"`
+	Contributions []QuestContribution `json:"contributions,omitempty" db:"-"`
+}
+
+// QuestContribution - урон, нанесенный боссу участником
+type QuestContribution struct {
+	UserID   int    `json:"user_id" db:"user_id"`
+	Username string `json:"username" db:"username"`
+	Damage   int    `json:"damage" db:"damage"`
+}
+
+// QuestHit - результат удара по боссу или босса по группе. Rewards -
+// начисления участникам при победе, Hits - урон участникам от босса.
+type QuestHit struct {
+	Quest    Quest         `json:"quest"`
+	Damage   int           `json:"damage"`
+	Defeated bool          `json:"defeated"`
+	Rewards  []ScoreResult `json:"rewards,omitempty"`
+	Hits     []ScoreResult `json:"hits,omitempty"`
+}
+
+// Reward - награда, которую пользователь покупает себе за золото
+type Reward struct {
+	ID     int    `json:"id" db:"id"`
+	UserID int    `json:"user_id" db:"user_id"`
+	Text   string `json:"text" db:"text"`
+	Note   string `json:"note,omitempty" db:"note"`
+	Cost   int    `json:"cost" db:"cost"`
+}
+
+// RewardPurchase - запись истории покупок. Текст и цена копируются на
+// момент покупки, чтобы история не менялась при правке или удалении награды.
+type RewardPurchase struct {
+	ID          int       `json:"id" db:"id"`
+	UserID      int       `json:"user_id" db:"user_id"`
+	RewardID    *int      `json:"reward_id,omitempty" db:"reward_id"`
+	Text        string    `json:"text" db:"text"`
+	Cost        int       `json:"cost" db:"cost"`
+	PurchasedAt time.Time `json:"purchased_at" db:"purchased_at"`
+}
+
+type InventoryItem struct {
+	Item     string `json:"item" db:"item"`
+	Quantity int    `json:"quantity" db:"quantity"`
+}
+
+type Pet struct {
+	Pet       string    `json:"pet" db:"pet"`
+	Fullness  int       `json:"fullness" db:"fullness"`
+	HatchedAt time.Time `json:"hatched_at" db:"hatched_at"`
+}
+
+type Mount struct {
+	Mount      string    `json:"mount" db:"mount"`
+	ObtainedAt time.Time `json:"obtained_at" db:"obtained_at"`
+}
+
+// Показатели пользователя, по которым выдаются достижения
+const (
+	MetricDailyStreak = "daily_streak"
+	MetricHabitGood   = "habit_good"
+	MetricTasksOnTime = "tasks_on_time"
+	MetricLevel       = "level"
+	MetricQuestsWon   = "quests_won"
+)
+
+type UserAchievement struct {
+	Achievement string    `json:"achievement" db:"achievement"`
+	UnlockedAt  time.Time `json:"unlocked_at" db:"unlocked_at"`
+}
+
+type AchievementProgress struct {
+	Key         string     `json:"key"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Goal        int        `json:"goal"`
+	Progress    int        `json:"progress"`
+	Unlocked    bool       `json:"unlocked"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+}
+
+// SkillResult - итог применения умения. Заполнены только поля эффекта
+// этого умения.
+type SkillResult struct {
+	Skill   string    `json:"skill"`
+	Stats   Stats     `json:"stats"`
+	ReadyAt time.Time `json:"ready_at"`
+	Quest   *QuestHit `json:"quest,omitempty"`
+	Task    *Task     `json:"task,omitempty"`
+	Healed  []Stats   `json:"healed,omitempty"`
+	// ProtectedDay - день, пропуски в который не сбросят серии
+	ProtectedDay string `json:"protected_day,omitempty"`
+}
+
+// Vacation - отпуск: в дни с StartDate по EndDate включительно пропуски
+// ежедневных задач не сбрасывают серии и не наносят урона
+type Vacation struct {
+	ID        int       `json:"id" db:"vacation_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	StartDate time.Time `json:"start_date" db:"start_date"`
+	EndDate   time.Time `json:"end_date" db:"end_date"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// SettingsVersion - текущая версия схемы настроек. Повышается, только
+// когда меняется смысл или формат уже существующих полей.
+const SettingsVersion = 1
+
+const (
+	DefaultRemindAt     = "08:00"
+	DefaultDeadlineDays = 1
+)
+
+var (
+	Languages = []string{"ru", "en"}
+	Themes    = []string{"system", "light", "dark"}
+)
+
+// Settings - настройки пользователя. Часы (timezone, day_start) и
+// уведомления живут в своих таблицах, где их читают фоновые задачи;
+// остальное хранится в JSONB и дополняется значениями по умолчанию.
+type Settings struct {
+	Version           int                     `json:"version"`
+	Timezone          string                  `json:"timezone"`
+	DayStart          int                     `json:"day_start"`
+	Language          string                  `json:"language"`
+	DefaultDifficulty int                     `json:"default_difficulty"`
+	WeekStart         string                  `json:"week_start"`
+	Theme             string                  `json:"theme"`
+	Privacy           PrivacySettings         `json:"privacy"`
+	Notifications     NotificationPreferences `json:"notifications"`
+}
+
+// PrivacySettings - с какими флагами пользователь вступает в группу
+type PrivacySettings struct {
+	ShareStats    bool `json:"share_stats"`
+	ShareProgress bool `json:"share_progress"`
+}
+
+type NotificationPreferences struct {
+	EmailEnabled bool   `json:"email_enabled"`
+	RemindAt     string `json:"remind_at"`
+	DeadlineDays int    `json:"deadline_days"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Version:           SettingsVersion,
+		Timezone:          "UTC",
+		Language:          "ru",
+		DefaultDifficulty: MinDifficulty,
+		WeekStart:         "mon",
+		Theme:             "system",
+		Privacy:           PrivacySettings{ShareStats: true, ShareProgress: true},
+		Notifications: NotificationPreferences{
+			EmailEnabled: true,
+			RemindAt:     DefaultRemindAt,
+			DeadlineDays: DefaultDeadlineDays,
+		},
+	}
 }
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxRecurrenceInterval - ограничение INTERVAL, чтобы поиск следующего
+// срока не перебирал века
+const MaxRecurrenceInterval = 100
+
+// Recurrence - правило повтора задачи, подмножество RRULE из RFC 5545:
+//
+//	FREQ=DAILY|WEEKLY|MONTHLY|YEARLY  обязательно
+//	INTERVAL=n                        каждые n единиц FREQ, по умолчанию 1
+//	BYDAY=MO,WE                       дни недели, только для WEEKLY
+//	BYMONTHDAY=n                      число месяца 1..31 или -1 (последнее),
+//	                                  только для MONTHLY и YEARLY
+//	UNTIL=YYYYMMDD                    последний допустимый срок
+//	COUNT=n                           сколько экземпляров осталось, включая
+//	                                  текущий
+//
+// Например "FREQ=MONTHLY;BYMONTHDAY=1" - каждое первое число,
+// "FREQ=YEARLY;INTERVAL=10" - раз в десять лет.
+type Recurrence struct {
+	Freq       int // одно из Repeat*
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay int // 0 - число из текущего срока
+	Until      time.Time
+	Count      int // 0 - без ограничения
+}
+
+var recurrenceFreqs = [...]string{
+	RepeatDaily:   "DAILY",
+	RepeatWeekly:  "WEEKLY",
+	RepeatMonthly: "MONTHLY",
+	RepeatYearly:  "YEARLY",
+}
+
+func ParseRecurrence(rule string) (Recurrence, error) {
+	r := Recurrence{Freq: -1, Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(rule, "RRULE:"), ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return Recurrence{}, fmt.Errorf("invalid recurrence part %q", part)
+		}
+		value = strings.ToUpper(value)
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = -1
+			for freq, name := range recurrenceFreqs {
+				if name == value {
+					r.Freq = freq
+				}
+			}
+			if r.Freq < 0 {
+				return Recurrence{}, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err != nil || r.Interval < 1 || r.Interval > MaxRecurrenceInterval {
+				return Recurrence{}, fmt.Errorf("interval must be between 1 and %d", MaxRecurrenceInterval)
+			}
+		case "BYDAY":
+			r.ByDay = nil
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := parseRecurrenceDay(day)
+				if !ok {
+					return Recurrence{}, fmt.Errorf("invalid day %q", day)
+				}
+				r.ByDay = append(r.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = strconv.Atoi(value)
+			if err != nil || r.ByMonthDay == 0 || r.ByMonthDay < -1 || r.ByMonthDay > 31 {
+				return Recurrence{}, fmt.Errorf("bymonthday must be between 1 and 31 or -1")
+			}
+		case "UNTIL":
+			// Время в UNTIL не нужно - сроки задач хранятся датами
+			r.Until, err = time.Parse("20060102", value[:min(len(value), 8)])
+			if err != nil {
+				return Recurrence{}, fmt.Errorf("until must be in YYYYMMDD format")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err != nil || r.Count < 1 {
+				return Recurrence{}, fmt.Errorf("count must be positive")
+			}
+		default:
+			return Recurrence{}, fmt.Errorf("unsupported recurrence part %q", key)
+		}
+	}
+
+	if r.Freq < 0 {
+		return Recurrence{}, fmt.Errorf("recurrence requires FREQ")
+	}
+	if len(r.ByDay) > 0 && r.Freq != RepeatWeekly {
+		return Recurrence{}, fmt.Errorf("BYDAY is supported only for WEEKLY")
+	}
+	if r.ByMonthDay != 0 && r.Freq != RepeatMonthly && r.Freq != RepeatYearly {
+		return Recurrence{}, fmt.Errorf("BYMONTHDAY is supported only for MONTHLY and YEARLY")
+	}
+	return r, nil
+}
+
+func parseRecurrenceDay(day string) (time.Weekday, bool) {
+	for i, weekDay := range WeekDays {
+		if strings.EqualFold(weekDay[:2], strings.TrimSpace(day)) {
+			return time.Weekday(i), true
+		}
+	}
+	return time.Sunday, false
+}
+
+// String - правило в каноническом виде, в котором оно хранится у задачи
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + recurrenceFreqs[r.Freq]}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = strings.ToUpper(WeekDays[day][:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTHDAY=%d", r.ByMonthDay))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,304 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxTextLength = 63
+	MaxNoteLength = 255
+	MaxChatLength = 500
+	MinDifficulty = 1
+	MaxDifficulty = 5
+	// MaxVacationDays - самый длинный отпуск одной записью
+	MaxVacationDays = 90
+	MaxDeadlineDays = 30
+	// Шаблон задач: не больше MaxTemplateTasks задач со сроками не дальше
+	// десяти лет от даты применения
+	MaxTemplateTasks        = 50
+	MaxTemplateDeadlineDays = 3650
+	// MaxEstimatedMinutes - оценка задачи не больше недели
+	MaxEstimatedMinutes = 7 * 24 * 60
+)
+
+// Truncate обрезает строку до limit символов - для импорта из сторонних
+// форматов, где длина полей не ограничена.
+func Truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit])
+}
+
+func validateText(field, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if utf8.RuneCountInString(text) > MaxTextLength {
+		return fmt.Errorf("%s must be at most %d characters", field, MaxTextLength)
+	}
+	return nil
+}
+
+func validateNote(note string) error {
+	if utf8.RuneCountInString(note) > MaxNoteLength {
+		return fmt.Errorf("note must be at most %d characters", MaxNoteLength)
+	}
+	return nil
+}
+
+func validateDifficulty(difficulty int) error {
+	if difficulty < MinDifficulty || difficulty > MaxDifficulty {
+		return fmt.Errorf("difficulty must be between %d and %d", MinDifficulty, MaxDifficulty)
+	}
+	return nil
+}
+
+func (u RegisterUserRequest) Validate() error {
+	if strings.TrimSpace(u.Username) == "" || utf8.RuneCountInString(u.Username) > 255 {
+		return fmt.Errorf("username must be between 1 and 255 characters")
+	}
+	if !strings.Contains(u.Email, "@") || utf8.RuneCountInString(u.Email) > 255 {
+		return fmt.Errorf("invalid email")
+	}
+	if len(u.Phone) > 20 {
+		return fmt.Errorf("phone must be at most 20 characters")
+	}
+	if u.Password == "" {
+		return fmt.Errorf("password is required")
+	}
+	return nil
+}
+
+func (h Habit) Validate() error {
+	if err := validateText("text", h.Text); err != nil {
+		return err
+	}
+	if err := validateNote(h.Note); err != nil {
+		return err
+	}
+	if err := validateDifficulty(h.Difficulty); err != nil {
+		return err
+	}
+	if h.CountReset != "" && !slices.Contains(ResetPeriods, h.CountReset) {
+		return fmt.Errorf("count_reset must be one of %s", strings.Join(ResetPeriods, ", "))
+	}
+	if h.GoodCount < 0 || h.BadCount < 0 {
+		return fmt.Errorf("counters must not be negative")
+	}
+	return nil
+}
+
+func (d Daily) Validate() error {
+	if err := validateText("text", d.Text); err != nil {
+		return err
+	}
+	if err := validateNote(d.Note); err != nil {
+		return err
+	}
+	if err := validateDifficulty(d.Difficulty); err != nil {
+		return err
+	}
+	if d.StartDate.IsZero() {
+		return fmt.Errorf("start_date is required")
+	}
+	if d.RepeatEvery < 0 || d.RepeatEveryX < 0 {
+		return fmt.Errorf("repeat values must not be negative")
+	}
+	if len(d.DayWeeks) > 32 {
+		return fmt.Errorf("day_weeks must be at most 32 characters")
+	}
+	if d.Streak < 0 {
+		return fmt.Errorf("streak must not be negative")
+	}
+	return nil
+}
+
+func (t Task) Validate() error {
+	if err := validateText("name", t.Name); err != nil {
+		return err
+	}
+	if err := validateNote(t.Note); err != nil {
+		return err
+	}
+	if err := validateDifficulty(t.Difficulty); err != nil {
+		return err
+	}
+	if t.Deadline.IsZero() {
+		return fmt.Errorf("deadline is required")
+	}
+	if t.Priority < PriorityNone || t.Priority > PriorityHigh {
+		return fmt.Errorf("priority must be between %d and %d", PriorityNone, PriorityHigh)
+	}
+	if t.StartDate != nil && t.StartDate.After(t.Deadline) {
+		return fmt.Errorf("start_date must not be after deadline")
+	}
+	if t.DeadlineTime != "" {
+		if _, err := time.Parse("15:04", t.DeadlineTime); err != nil {
+			return fmt.Errorf(`deadline_time must be in "HH:MM" format`)
+		}
+	}
+	if t.DeadlineTimezone != "" {
+		if t.DeadlineTime == "" {
+			return fmt.Errorf("deadline_timezone requires deadline_time")
+		}
+		if _, err := time.LoadLocation(t.DeadlineTimezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", t.DeadlineTimezone)
+		}
+	}
+	if t.EstimatedMinutes < 0 || t.EstimatedMinutes > MaxEstimatedMinutes {
+		return fmt.Errorf("estimated_minutes must be between 0 and %d", MaxEstimatedMinutes)
+	}
+	if t.ParentID != nil && *t.ParentID == t.ID {
+		return fmt.Errorf("task cannot be its own parent")
+	}
+	return validateRecurrence(t.Recurrence)
+}
+
+func (d TaskDependency) Validate() error {
+	if d.TaskID == d.BlockedBy {
+		return fmt.Errorf("task cannot depend on itself")
+	}
+	return nil
+}
+
+func validateRecurrence(rule string) error {
+	if rule == "" {
+		return nil
+	}
+	if _, err := ParseRecurrence(rule); err != nil {
+		return fmt.Errorf("recurrence: %w", err)
+	}
+	return nil
+}
+
+func (t TaskTemplate) Validate() error {
+	if err := validateText("name", t.Name); err != nil {
+		return err
+	}
+	if len(t.Tasks) == 0 || len(t.Tasks) > MaxTemplateTasks {
+		return fmt.Errorf("template must contain between 1 and %d tasks", MaxTemplateTasks)
+	}
+	for _, task := range t.Tasks {
+		if task.DeadlineDays < 0 || task.DeadlineDays > MaxTemplateDeadlineDays {
+			return fmt.Errorf("deadline_days must be between 0 and %d", MaxTemplateDeadlineDays)
+		}
+		if err := task.Task(t.UserID, time.Now()).Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Reward) Validate() error {
+	if err := validateText("text", r.Text); err != nil {
+		return err
+	}
+	if err := validateNote(r.Note); err != nil {
+		return err
+	}
+	if r.Cost < 0 {
+		return fmt.Errorf("cost must not be negative")
+	}
+	return nil
+}
+
+func (m ChatMessage) Validate() error {
+	if strings.TrimSpace(m.Text) == "" {
+		return fmt.Errorf("text is required")
+	}
+	if utf8.RuneCountInString(m.Text) > MaxChatLength {
+		return fmt.Errorf("text must be at most %d characters", MaxChatLength)
+	}
+	return nil
+}
+
+func validateReminder(remindAt string, deadlineDays int) error {
+	if _, err := time.Parse("15:04", remindAt); err != nil {
+		return fmt.Errorf(`remind_at must be in "HH:MM" format`)
+	}
+	if deadlineDays < 0 || deadlineDays > MaxDeadlineDays {
+		return fmt.Errorf("deadline_days must be between 0 and %d", MaxDeadlineDays)
+	}
+	return nil
+}
+
+func (n NotificationSettings) Validate() error {
+	return validateReminder(n.RemindAt, n.DeadlineDays)
+}
+
+func (s Settings) Validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil || s.Timezone == "" {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	if s.DayStart < 0 || s.DayStart > 23 {
+		return fmt.Errorf("day_start must be between 0 and 23")
+	}
+	if !slices.Contains(Languages, s.Language) {
+		return fmt.Errorf("language must be one of %s", strings.Join(Languages, ", "))
+	}
+	if err := validateDifficulty(s.DefaultDifficulty); err != nil {
+		return fmt.Errorf("default_%w", err)
+	}
+	if !slices.Contains(WeekDays[:], s.WeekStart) {
+		return fmt.Errorf("week_start must be one of %s", strings.Join(WeekDays[:], ", "))
+	}
+	if !slices.Contains(Themes, s.Theme) {
+		return fmt.Errorf("theme must be one of %s", strings.Join(Themes, ", "))
+	}
+	return validateReminder(s.Notifications.RemindAt, s.Notifications.DeadlineDays)
+}
+
+func (v Vacation) Validate() error {
+	if v.StartDate.IsZero() || v.EndDate.IsZero() {
+		return fmt.Errorf("start_date and end_date are required")
+	}
+	if v.EndDate.Before(v.StartDate) {
+		return fmt.Errorf("end_date must not be before start_date")
+	}
+	if v.EndDate.Sub(v.StartDate) >= MaxVacationDays*24*time.Hour {
+		return fmt.Errorf("vacation must be at most %d days", MaxVacationDays)
+	}
+	return nil
+}
+
+func (p Party) Validate() error {
+	return validateText("name", p.Name)
+}
+
+func (c Challenge) Validate() error {
+	if err := validateText("name", c.Name); err != nil {
+		return err
+	}
+	if err := validateNote(c.Description); err != nil {
+		return err
+	}
+	if len(c.Templates.Habits)+len(c.Templates.Dailies)+len(c.Templates.Tasks) == 0 {
+		return fmt.Errorf("challenge must contain at least one habit, daily or task")
+	}
+	for _, habit := range c.Templates.Habits {
+		if err := habit.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, daily := range c.Templates.Dailies {
+		// Дата начала шаблону не нужна - при вступлении ставится день вступления
+		if daily.StartDate.IsZero() {
+			daily.StartDate = c.CreatedAt
+		}
+		if err := daily.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, task := range c.Templates.Tasks {
+		if err := task.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+	"huibitica/internal/webhooks"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrSubscriptionGone - канал сообщил, что подписки больше нет
+// (например, пользователь отозвал разрешение на push); ее нужно удалить.
+var ErrSubscriptionGone = errors.New("subscription is gone")
+
+type Message struct {
+	UserID  int                   `json:"user_id"`
+	Subject string                `json:"subject"`
+	Body    string                `json:"body"`
+	Items   []models.ReminderItem `json:"items"`
+}
+
+// Channel доставляет сообщение на один адрес пользователя
+type Channel interface {
+	Notify(ctx context.Context, target models.NotificationChannel, msg Message) error
+}
+
+// Notify отправляет письмо на адрес из target.Endpoint
+func (m *Mailer) Notify(_ context.Context, target models.NotificationChannel, msg Message) error {
+	return m.Send(target.Endpoint, msg.Subject, msg.Body)
+}
+
+// WebhookChannel отправляет сообщение JSON-ом на произвольный URL
+type WebhookChannel struct {
+	Client *http.Client
+}
+
+func NewWebhookChannel() *WebhookChannel {
+	return &WebhookChannel{Client: webhooks.NewClient(10 * time.Second)}
+}
+
+func (c *WebhookChannel) Notify(ctx context.Context, target models.NotificationChannel, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode == http.StatusGone {
+		return ErrSubscriptionGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// LogChannel только пишет сообщение в лог - для разработки
+type LogChannel struct {
+	log zerolog.Logger
+}
+
+func NewLogChannel(log zerolog.Logger) *LogChannel {
+	return &LogChannel{log: log}
+}
+
+func (c *LogChannel) Notify(_ context.Context, target models.NotificationChannel, msg Message) error {
+	c.log.Info().
+		Int("user_id", msg.UserID).
+		Str("endpoint", target.Endpoint).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("Notification")
+	return nil
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"bufio"
+	"huibitica/internal/config"
+	"net"
+	"strings"
+	"testing"
+)
+
+// smtpSession - то, что фейковый SMTP-сервер получил за одно соединение
+type smtpSession struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP принимает одно соединение и отвечает на минимальный набор
+// команд, которого хватает net/smtp.SendMail (без STARTTLS и AUTH).
+// rcptCode - код ответа на RCPT TO.
+func fakeSMTP(t *testing.T, rcptCode string) (config.SMTP, <-chan smtpSession) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session smtpSession
+		defer func() { sessions <- session }()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				session.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				session.to = append(session.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				reply(rcptCode + " recipient")
+			case command == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				session.data = data.String()
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return config.SMTP{Host: "127.0.0.1", Port: addr.Port, From: "huibitica@example.com"}, sessions
+}
+
+func TestMailerSend(t *testing.T) {
+	cfg, sessions := fakeSMTP(t, "250")
+
+	err := NewMailer(cfg).Send("user@example.com", "Дела на сегодня", "Зарядка\nПрочитать главу")
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	session := <-sessions
+
+	if session.from != "huibitica@example.com" {
+		t.Errorf("MAIL FROM = %q", session.from)
+	}
+	if len(session.to) != 1 || session.to[0] != "user@example.com" {
+		t.Errorf("RCPT TO = %q", session.to)
+	}
+
+	headers, body, ok := strings.Cut(session.data, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message has no header separator: %q", session.data)
+	}
+	for _, want := range []string{
+		"From: huibitica@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+	} {
+		if !strings.Contains(headers+"\r\n", want) {
+			t.Errorf("headers lack %q:\n%s", want, headers)
+		}
+	}
+	if want := "Зарядка\r\nПрочитать главу\r\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestMailerSendRejectedRecipient(t *testing.T) {
+	cfg, sessions := fakeSMTP(t, "550")
+
+	if err := NewMailer(cfg).Send("nobody@example.com", "Дела на сегодня", "Зарядка"); err == nil {
+		t.Fatal("Send succeeded although the server rejected the recipient")
+	}
+	if session := <-sessions; session.data != "" {
+		t.Errorf("message was sent after the recipient was rejected: %q", session.data)
+	}
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"huibitica/internal/models"
+	"huibitica/internal/schedule"
+	"text/template"
+	"time"
+)
+
+var reminderTemplate = template.Must(template.New("reminder").Parse(
+	`Привет! Вот что запланировано на {{.Day.Format "02.01.2006"}}.
+{{if .Dailies}}
+Ежедневные задачи:
+{{range .Dailies}}  - {{.Text}}
+{{end}}{{end}}{{if .Tasks}}
+Задачи со сроком:
+{{range .Tasks}}  - {{.Text}} (до {{.Due.Format "02.01.2006"}}{{with .At}} {{.Format "15:04 MST"}}{{end}})
+{{end}}{{end}}
+Отключить напоминания можно в настройках уведомлений.
+`))
+
+type Reminder struct {
+	Day     time.Time
+	Dailies []models.ReminderItem
+	Tasks   []models.ReminderItem
+}
+
+// DueItems отбирает ежедневные задачи, которые нужно выполнить в day и
+// которые еще не выполнены, и невыполненные задачи, срок которых
+// (schedule.DueAt) наступает не позже конца дня day + deadlineDays.
+func DueItems(dailies []models.Daily, tasks []models.Task, clock schedule.Clock, day time.Time, deadlineDays int) []models.ReminderItem {
+	var items []models.ReminderItem
+	day = schedule.Day(day)
+	horizon := clock.DayEnd(day.AddDate(0, 0, deadlineDays))
+
+	for _, daily := range dailies {
+		if schedule.IsDue(daily, day) && !schedule.CompletedOn(daily, day) {
+			items = append(items, models.ReminderItem{Kind: "daily", ID: daily.ID, Text: daily.Text, Due: day})
+		}
+	}
+	for _, task := range tasks {
+		dueAt := schedule.DueAt(task, clock)
+		if task.Completed || dueAt.After(horizon) {
+			continue
+		}
+		item := models.ReminderItem{Kind: "task", ID: task.ID, Text: task.Name, Due: schedule.Day(task.Deadline)}
+		if task.DeadlineTime != "" {
+			item.At = &dueAt
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func NewReminder(day time.Time, items []models.ReminderItem) Reminder {
+	reminder := Reminder{Day: day}
+	for _, item := range items {
+		if item.Kind == "daily" {
+			reminder.Dailies = append(reminder.Dailies, item)
+		} else {
+			reminder.Tasks = append(reminder.Tasks, item)
+		}
+	}
+	return reminder
+}
+
+func (r Reminder) Subject() string {
+	return fmt.Sprintf("Напоминание: %d дел на сегодня", len(r.Dailies)+len(r.Tasks))
+}
+
+func (r Reminder) Body() (string, error) {
+	var body bytes.Buffer
+	if err := reminderTemplate.Execute(&body, r); err != nil {
+		return "", fmt.Errorf("failed to render reminder: %w", err)
+	}
+	return body.String(), nil
+}
@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/schedule"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// Scheduler раз в Interval проверяет, у кого из пользователей наступило
+// время напоминания, и рассылает список дел на сегодня по всем каналам
+// пользователя. Напоминание отправляется раз в день; если не удалось,
+// повторяется при следующей проверке. Каждый элемент попадает в
+// напоминание не чаще раза в день.
+type Scheduler struct {
+	db       *pgxpool.Pool
+	log      zerolog.Logger
+	channels map[string]Channel
+	Interval time.Duration
+}
+
+// NewScheduler принимает каналы по видам (models.ChannelEmail, ...).
+// Подписки на виды, для которых канала нет, пропускаются.
+func NewScheduler(db *pgxpool.Pool, log zerolog.Logger, channels map[string]Channel) *Scheduler {
+	return &Scheduler{db: db, log: log, channels: channels, Interval: time.Minute}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) {
+	// Время напоминания и "сегодня" считаются по часам получателя прямо в
+	// запросе: за минуту обрабатываются только те, кому пора
+	recipients, err := postgresql.ClaimReminderRecipients(now, s.db)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to claim reminder recipients")
+		return
+	}
+
+	for _, recipient := range recipients {
+		if ctx.Err() != nil {
+			s.releaseRun(recipient)
+			continue
+		}
+		// Неизвестный пояс запрос тоже считает UTC
+		clock, err := schedule.NewClock(recipient.Timezone, recipient.DayStart)
+		if err != nil {
+			clock = schedule.UTC
+		}
+		if err := s.remind(ctx, recipient.NotificationSettings, clock, recipient.Day); err != nil {
+			s.log.Error().Int("user_id", recipient.UserID).Err(err).Msg("Failed to send reminder")
+			s.releaseRun(recipient)
+		}
+	}
+}
+
+func (s *Scheduler) remind(ctx context.Context, recipient models.NotificationSettings, clock schedule.Clock, day time.Time) error {
+	targets, err := s.targets(recipient)
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+
+	dailies, err := postgresql.GetDailies(recipient.UserID, s.db)
+	if err != nil {
+		return err
+	}
+	tasks, err := postgresql.GetTasks(recipient.UserID, s.db)
+	if err != nil {
+		return err
+	}
+
+	items, err := postgresql.ClaimReminders(recipient.UserID, day, DueItems(dailies, tasks, clock, day, recipient.DeadlineDays), s.db)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	reminder := NewReminder(day, items)
+	body, err := reminder.Body()
+	if err != nil {
+		s.release(recipient.UserID, day, items)
+		return err
+	}
+	msg := Message{UserID: recipient.UserID, Subject: reminder.Subject(), Body: body, Items: items}
+
+	// Ошибка одного канала не мешает остальным. Напоминание считается
+	// отправленным, если его доставил хотя бы один канал.
+	delivered := 0
+	for _, target := range targets {
+		err := s.channels[target.Kind].Notify(ctx, target, msg)
+		switch {
+		case err == nil:
+			delivered++
+		case errors.Is(err, ErrSubscriptionGone):
+			s.log.Info().Int("user_id", recipient.UserID).Int("channel_id", target.ID).Msg("Subscription is gone, removing")
+			if err := postgresql.DeleteNotificationChannel(target.ID, s.db); err != nil {
+				s.log.Error().Int("channel_id", target.ID).Err(err).Msg("Failed to remove notification channel")
+			}
+		default:
+			s.log.Warn().Int("user_id", recipient.UserID).Str("kind", target.Kind).Err(err).Msg("Notification channel failed")
+		}
+	}
+
+	if delivered == 0 {
+		s.release(recipient.UserID, day, items)
+		return fmt.Errorf("all %d notification channels failed", len(targets))
+	}
+
+	s.log.Info().Int("user_id", recipient.UserID).Int("items", len(items)).Int("channels", delivered).Msg("Reminder sent")
+	return nil
+}
+
+// targets собирает адреса пользователя: почту из профиля (если она не
+// отключена) и подписанные устройства
+func (s *Scheduler) targets(recipient models.NotificationSettings) ([]models.NotificationChannel, error) {
+	var targets []models.NotificationChannel
+	if _, ok := s.channels[models.ChannelEmail]; ok && recipient.EmailEnabled && recipient.Email != "" {
+		targets = append(targets, models.NotificationChannel{
+			UserID:   recipient.UserID,
+			Kind:     models.ChannelEmail,
+			Endpoint: recipient.Email,
+		})
+	}
+
+	subscriptions, err := postgresql.GetNotificationChannels(recipient.UserID, s.db)
+	if err != nil {
+		return nil, err
+	}
+	for _, subscription := range subscriptions {
+		if _, ok := s.channels[subscription.Kind]; !ok {
+			s.log.Debug().Int("channel_id", subscription.ID).Str("kind", subscription.Kind).Msg("Notification channel is not configured")
+			continue
+		}
+		targets = append(targets, subscription)
+	}
+	return targets, nil
+}
+
+// releaseRun возвращает получателя в очередь на следующую проверку
+func (s *Scheduler) releaseRun(recipient models.ReminderRecipient) {
+	if err := postgresql.ReleaseReminderRun(recipient.UserID, recipient.Day, s.db); err != nil {
+		s.log.Error().Int("user_id", recipient.UserID).Err(err).Msg("Failed to release reminder run")
+	}
+}
+
+// release снимает отметки об отправке, чтобы следующая проверка повторила напоминание
+func (s *Scheduler) release(userID int, day time.Time, items []models.ReminderItem) {
+	if err := postgresql.ReleaseReminders(userID, day, items, s.db); err != nil {
+		s.log.Error().Int("user_id", userID).Err(err).Msg("Failed to release reminders")
+	}
+}
@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/config"
+	"huibitica/internal/models"
+	"huibitica/internal/webhooks"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	pushRecordSize = 4096
+	pushTTL        = 24 * time.Hour
+	vapidLifetime  = 12 * time.Hour
+)
+
+var b64 = base64.RawURLEncoding
+
+// WebPushChannel отправляет уведомления по протоколу Web Push:
+// тело шифруется по RFC 8291 (aes128gcm), сервер подписывается VAPID (RFC 8292).
+type WebPushChannel struct {
+	Client    *http.Client
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+}
+
+func NewWebPushChannel(cfg config.WebPush) (*WebPushChannel, error) {
+	d, err := b64.DecodeString(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	private, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	public := private.PublicKey().Bytes()
+
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+
+	return &WebPushChannel{
+		Client:    webhooks.NewClient(10 * time.Second),
+		key:       key,
+		publicKey: b64.EncodeToString(public),
+		subject:   cfg.Subject,
+	}, nil
+}
+
+// PublicKey - ключ сервера, который браузер передает в pushManager.subscribe
+func (c *WebPushChannel) PublicKey() string {
+	return c.publicKey
+}
+
+func (c *WebPushChannel) Notify(ctx context.Context, target models.NotificationChannel, msg Message) error {
+	payload, err := json.Marshal(map[string]string{
+		"title": msg.Subject,
+		"body":  msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	body, err := encryptPush(payload, target.Keys)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := c.vapidAuthorization(target.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(int(pushTTL.Seconds())))
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("push service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// vapidAuthorization подписывает JWT (ES256) для origin push-сервиса
+func (c *WebPushChannel) vapidAuthorization(endpoint string) (string, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": target.Scheme + "://" + target.Host,
+		"exp": time.Now().Add(vapidLifetime).Unix(),
+		"sub": c.subject,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode VAPID claims: %w", err)
+	}
+	unsigned := header + "." + b64.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, b64.EncodeToString(signature), c.publicKey), nil
+}
+
+// encryptPush шифрует payload ключами подписки по RFC 8291 в одну запись aes128gcm
+func encryptPush(payload []byte, keys models.PushKeys) ([]byte, error) {
+	uaPublicBytes, err := b64.DecodeString(keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := b64.DecodeString(keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublicBytes...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, sharedSecret, keyInfo, 32)
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init cipher: %w", err)
+	}
+
+	// 0x02 - разделитель последней записи
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > pushRecordSize {
+		return nil, fmt.Errorf("push payload is too large")
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// hkdf - HKDF-SHA256 (RFC 5869) для length <= 32, чего хватает для Web Push
+func hkdf(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
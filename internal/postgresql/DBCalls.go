@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"huibitica/internal/game"
 	"huibitica/internal/models"
+	"huibitica/internal/schedule"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -64,34 +67,55 @@ func RegisterUser(user models.RegisterUserRequest, conn *pgxpool.Pool) error {
 	return nil
 }
 
-func AddHabit(habit models.Habit, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+// AddHabit создает привычку; счетчики текущего периода идут и в
+// счетчики за все время, период начинается сегодня по часам пользователя
+func AddHabit(habit models.Habit, conn *pgxpool.Pool) (*models.Habit, error) {
+	ctx := context.Background()
+	clock, err := userClock(ctx, conn, habit.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.QueryRow(ctx,
 		`INSERT INTO habits (
 			user_id, text, note, good, bad, difficulty,
-			count_reset_after, good_count, bad_count)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			count_reset, good_count, bad_count, counts_since,
+			total_good_count, total_bad_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $8, $9)
+		RETURNING id, count_reset, counts_since, total_good_count, total_bad_count, value`,
 		habit.UserID,
 		habit.Text,
 		habit.Note,
 		habit.Good,
 		habit.Bad,
 		habit.Difficulty,
-		habit.CountResetAfter,
+		habit.ResetPeriod(),
 		habit.GoodCount,
 		habit.BadCount,
+		clock.Today(time.Now()),
+	).Scan(
+		&habit.ID,
+		&habit.CountReset,
+		&habit.CountsSince,
+		&habit.TotalGoodCount,
+		&habit.TotalBadCount,
+		&habit.Value,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert habit: %w", err)
+		return nil, fmt.Errorf("failed to insert habit: %w", err)
 	}
-	return nil
+	habit.Strength = game.HabitStrength(habit.Value)
+	return &habit, nil
 }
 
-func AddDaily(daily models.Daily, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+func AddDaily(daily models.Daily, conn *pgxpool.Pool) (int, error) {
+	var id int
+	err := conn.QueryRow(context.Background(),
 		`INSERT INTO dailies (
 			user_id, text, note, difficulty, start_date,
 			repeat_every, repeat_every_x, dayweeks, streak)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
 		daily.UserID,
 		daily.Text,
 		daily.Note,
@@ -101,28 +125,39 @@ func AddDaily(daily models.Daily, conn *pgxpool.Pool) error {
 		daily.RepeatEveryX,
 		daily.DayWeeks,
 		daily.Streak,
-	)
+	).Scan(&id)
 	if err != nil {
-		return fmt.Errorf("failed to insert daily: %w", err)
+		return 0, fmt.Errorf("failed to insert daily: %w", err)
 	}
-	return nil
+	return id, nil
 }
 
-func AddTask(task models.Task, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
-		`INSERT INTO tasks (
-			user_id, name, note, difficulty, deadline)
-		VALUES ($1, $2, $3, $4, $5)`,
-		task.UserID,
-		task.Name,
-		task.Note,
-		task.Difficulty,
-		task.Deadline,
-	)
+func AddTask(task models.Task, conn *pgxpool.Pool) (int, error) {
+	if task.ParentID == nil {
+		return insertTask(context.Background(), conn, task)
+	}
+
+	// Новая задача не может замкнуть цикл, достаточно проверить родителя
+	// в той же транзакции, что и вставку
+	ctx := context.Background()
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to insert task: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	return nil
+	defer tx.Rollback(ctx)
+
+	if err := checkTaskParent(ctx, tx, task.UserID, 0, *task.ParentID); err != nil {
+		return 0, err
+	}
+	id, err := insertTask(ctx, tx, task)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
 }
 
 func EditUserUsername(r models.EditUserData, conn *pgxpool.Pool) error {
@@ -213,37 +248,49 @@ func EditPassword(password models.Password, conn *pgxpool.Pool) error {
 	}
 	return nil
 }
-func EditHabit(habit models.Habit, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+// EditHabit возвращает владельца записи. Правка счетчиков текущего
+// периода на ту же величину меняет и счетчики за все время.
+func EditHabit(habit models.Habit, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
 		`UPDATE habits
 		SET text = $1, note = $2, good = $3, bad = $4,
-			difficulty = $5, count_reset_after = $6,
+			difficulty = $5, count_reset = $6,
+			total_good_count = GREATEST(total_good_count + $7 - good_count, 0),
+			total_bad_count = GREATEST(total_bad_count + $8 - bad_count, 0),
 			good_count = $7, bad_count = $8
-		WHERE id = $9`,
+		WHERE id = $9
+		RETURNING user_id`,
 		habit.Text,
 		habit.Note,
 		habit.Good,
 		habit.Bad,
 		habit.Difficulty,
-		habit.CountResetAfter,
+		habit.ResetPeriod(),
 		habit.GoodCount,
 		habit.BadCount,
 		habit.ID,
-	)
+	).Scan(&userID)
 	if err != nil {
-		return fmt.Errorf("failed to update habit: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("habit not found")
+		}
+		return 0, fmt.Errorf("failed to update habit: %w", err)
 	}
-	return nil
+	return userID, nil
 }
 
-func EditDaily(daily models.Daily, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+// EditDaily возвращает владельца записи
+func EditDaily(daily models.Daily, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
 		`UPDATE dailies
 		SET text = $1, note = $2, difficulty = $3,
 			start_date = $4, repeat_every = $5,
 			repeat_every_x = $6, dayweeks = $7,
 			streak = $8
-		WHERE id = $9`,
+		WHERE id = $9
+		RETURNING user_id`,
 		daily.Text,
 		daily.Note,
 		daily.Difficulty,
@@ -253,28 +300,92 @@ func EditDaily(daily models.Daily, conn *pgxpool.Pool) error {
 		daily.DayWeeks,
 		daily.Streak,
 		daily.ID,
-	)
+	).Scan(&userID)
 	if err != nil {
-		return fmt.Errorf("failed to update daily: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("daily not found")
+		}
+		return 0, fmt.Errorf("failed to update daily: %w", err)
 	}
-	return nil
+	return userID, nil
 }
 
-func EditTask(task models.Task, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+// EditTask возвращает владельца записи. Смена родителя проверяется на
+// циклы (в дереве и в графе ожидания) под блокировкой графа задач
+// пользователя.
+func EditTask(task models.Task, conn *pgxpool.Pool) (int, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	err = tx.QueryRow(ctx,
+		`SELECT user_id FROM tasks WHERE id = $1`,
+		task.ID,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("task not found")
+		}
+		return 0, fmt.Errorf("failed to get task: %w", err)
+	}
+	// Новый родитель и снятый AllowIncompleteSubtasks добавляют ребра
+	// ожидания, поэтому граф проверяется при любом изменении
+	if err := lockTaskGraph(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+	if task.ParentID != nil {
+		if err := checkTaskParent(ctx, tx, userID, task.ID, *task.ParentID); err != nil {
+			return 0, err
+		}
+	}
+	err = checkTaskGraph(ctx, tx, userID, taskGraphChange{
+		TaskID:                  task.ID,
+		ParentID:                task.ParentID,
+		AllowIncompleteSubtasks: task.AllowIncompleteSubtasks,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(ctx,
 		`UPDATE tasks
-		SET name = $1, note = $2, difficulty = $3, deadline = $4
-		WHERE id = $5`,
+		SET name = $1, note = $2, difficulty = $3, deadline = $4,
+			recurrence = $5, priority = $6, start_date = $7,
+			deadline_time = NULLIF($8, '')::time, deadline_timezone = $9,
+			estimated_minutes = $10, parent_id = $11,
+			allow_incomplete_subtasks = $12
+		WHERE id = $13
+		RETURNING user_id`,
 		task.Name,
 		task.Note,
 		task.Difficulty,
 		task.Deadline,
+		task.Recurrence,
+		task.Priority,
+		task.StartDate,
+		task.DeadlineTime,
+		task.DeadlineTimezone,
+		task.EstimatedMinutes,
+		task.ParentID,
+		task.AllowIncompleteSubtasks,
 		task.ID,
-	)
+	).Scan(&userID)
 	if err != nil {
-		return fmt.Errorf("failed to update task: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("task not found")
+		}
+		return 0, fmt.Errorf("failed to update task: %w", err)
 	}
-	return nil
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, nil
 }
 
 func DeleteUser(userID int, conn *pgxpool.Pool) error {
@@ -289,46 +400,64 @@ func DeleteUser(userID int, conn *pgxpool.Pool) error {
 	return nil
 }
 
-func DeleteHabit(id int, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+// DeleteHabit возвращает владельца удаленной записи
+func DeleteHabit(id int, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
 		`DELETE FROM habits
-		WHERE id = $1`,
+		WHERE id = $1
+		RETURNING user_id`,
 		id,
-	)
+	).Scan(&userID)
 	if err != nil {
-		return fmt.Errorf("failed to delete habit: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("habit not found")
+		}
+		return 0, fmt.Errorf("failed to delete habit: %w", err)
 	}
-	return nil
+	return userID, nil
 }
 
-func DeleteDaily(id int, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+// DeleteDaily возвращает владельца удаленной записи
+func DeleteDaily(id int, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
 		`DELETE FROM dailies
-		WHERE id = $1`,
+		WHERE id = $1
+		RETURNING user_id`,
 		id,
-	)
+	).Scan(&userID)
 	if err != nil {
-		return fmt.Errorf("failed to delete daily: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("daily not found")
+		}
+		return 0, fmt.Errorf("failed to delete daily: %w", err)
 	}
-	return nil
+	return userID, nil
 }
 
-func DeleteTask(id int, conn *pgxpool.Pool) error {
-	_, err := conn.Exec(context.Background(),
+// DeleteTask возвращает владельца удаленной записи
+func DeleteTask(id int, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
 		`DELETE FROM tasks
-		WHERE id = $1`,
+		WHERE id = $1
+		RETURNING user_id`,
 		id,
-	)
+	).Scan(&userID)
 	if err != nil {
-		return fmt.Errorf("failed to delete task: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("task not found")
+		}
+		return 0, fmt.Errorf("failed to delete task: %w", err)
 	}
-	return nil
+	return userID, nil
 }
 
 func GetUserByID(userID int, conn *pgxpool.Pool) (*models.User, error) {
 	var user models.User
 	err := conn.QueryRow(context.Background(),
-		`SELECT user_id, username, email, phone
+		`SELECT user_id, username, email, phone, timezone, day_start
 		FROM users
 		WHERE user_id = $1`,
 		userID).Scan(
@@ -336,6 +465,8 @@ func GetUserByID(userID int, conn *pgxpool.Pool) (*models.User, error) {
 		&user.Username,
 		&user.Email,
 		&user.Phone,
+		&user.Timezone,
+		&user.DayStart,
 	)
 
 	if err != nil {
@@ -346,6 +477,8 @@ func GetUserByID(userID int, conn *pgxpool.Pool) (*models.User, error) {
 		Username: user.Username,
 		Email:    user.Email,
 		Phone:    user.Phone,
+		Timezone: user.Timezone,
+		DayStart: user.DayStart,
 	}, nil
 }
 
@@ -401,11 +534,25 @@ func GetUserByEmail(email string, conn *pgxpool.Pool) (*models.User, error) {
 	}, nil
 }
 
+// GetHabits возвращает привычки со счетчиками текущего периода по часам
+// пользователя (см. schedule.CurrentCounts)
 func GetHabits(userID int, conn *pgxpool.Pool) ([]models.Habit, error) {
+	ctx := context.Background()
+	clock, err := userClock(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	firstDay, err := userWeekStart(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	today := clock.Today(time.Now())
+
 	var habits []models.Habit
-	rows, err := conn.Query(context.Background(),
+	rows, err := conn.Query(ctx,
 		`SELECT id, user_id, text, note, good, bad,
-			difficulty, count_reset_after, good_count, bad_count
+			difficulty, count_reset, good_count, bad_count,
+			counts_since, total_good_count, total_bad_count, value
 		FROM habits
 		WHERE user_id = $1`,
 		userID,
@@ -425,14 +572,19 @@ func GetHabits(userID int, conn *pgxpool.Pool) ([]models.Habit, error) {
 			&habit.Good,
 			&habit.Bad,
 			&habit.Difficulty,
-			&habit.CountResetAfter,
+			&habit.CountReset,
 			&habit.GoodCount,
 			&habit.BadCount,
+			&habit.CountsSince,
+			&habit.TotalGoodCount,
+			&habit.TotalBadCount,
+			&habit.Value,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan habit: %w", err)
 		}
-		habits = append(habits, habit)
+		habit.Strength = game.HabitStrength(habit.Value)
+		habits = append(habits, schedule.CurrentCounts(habit, today, firstDay))
 	}
 
 	if err := rows.Err(); err != nil {
@@ -447,7 +599,7 @@ func GetDailies(userID int, conn *pgxpool.Pool) ([]models.Daily, error) {
 	rows, err := conn.Query(context.Background(),
 		`SELECT id, user_id, text, note, difficulty,
 			start_date, repeat_every, repeat_every_x,
-			dayweeks, streak
+			dayweeks, streak, last_completed
 		FROM dailies
 		WHERE user_id = $1`,
 		userID,
@@ -470,6 +622,7 @@ func GetDailies(userID int, conn *pgxpool.Pool) ([]models.Daily, error) {
 			&daily.RepeatEveryX,
 			&daily.DayWeeks,
 			&daily.Streak,
+			&daily.LastCompleted,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan daily: %w", err)
@@ -484,11 +637,33 @@ func GetDailies(userID int, conn *pgxpool.Pool) ([]models.Daily, error) {
 	return dailies, nil
 }
 
+// GetTasks возвращает задачи вместе с зависимостями. Задача считается
+// заблокированной, если невыполненная задача блокирует ее саму или
+// любого из ее родителей.
 func GetTasks(userID int, conn *pgxpool.Pool) ([]models.Task, error) {
 	var tasks []models.Task
 	rows, err := conn.Query(context.Background(),
-		`SELECT id, user_id, name, note, difficulty,
-			deadline
+		`WITH RECURSIVE lineage AS (
+			SELECT id AS task_id, id AS ancestor_id, parent_id
+			FROM tasks
+			WHERE user_id = $1
+			UNION
+			SELECT l.task_id, t.id, t.parent_id
+			FROM lineage l
+			JOIN tasks t ON t.id = l.parent_id
+		), blocked AS (
+			SELECT DISTINCT l.task_id
+			FROM lineage l
+			JOIN task_dependencies d ON d.task_id = l.ancestor_id
+			JOIN tasks b ON b.id = d.blocked_by
+			WHERE NOT b.completed
+		)
+		SELECT `+taskColumns+`,
+			ARRAY(SELECT d.blocked_by
+				FROM task_dependencies d
+				WHERE d.task_id = tasks.id
+				ORDER BY d.blocked_by),
+			EXISTS(SELECT 1 FROM blocked WHERE blocked.task_id = tasks.id)
 		FROM tasks
 		WHERE user_id = $1`,
 		userID,
@@ -500,15 +675,7 @@ func GetTasks(userID int, conn *pgxpool.Pool) ([]models.Task, error) {
 
 	for rows.Next() {
 		var task models.Task
-		err := rows.Scan(
-			&task.ID,
-			&task.UserID,
-			&task.Name,
-			&task.Note,
-			&task.Difficulty,
-			&task.Deadline,
-		)
-		if err != nil {
+		if err := scanTask(rows, &task, &task.BlockedBy, &task.Blocked); err != nil {
 			return nil, fmt.Errorf("failed to scan task: %w", err)
 		}
 		tasks = append(tasks, task)
@@ -0,0 +1,180 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// metricQueries - как посчитать каждый показатель достижений по данным
+// пользователя. Выполняются на лету, так что достижения подхватывают и
+// данные, появившиеся до их введения.
+var metricQueries = map[string]string{
+	models.MetricDailyStreak: `SELECT COALESCE(MAX(streak), 0) FROM dailies WHERE user_id = $1`,
+	models.MetricHabitGood:   `SELECT COALESCE(MAX(total_good_count), 0) FROM habits WHERE user_id = $1`,
+	// completed_at хранится в UTC. Момент срока - как schedule.DueAt: со
+	// временем - в поясе задачи или пользователя, без времени - конец дня
+	// deadline по часам пользователя (DayStart следующего дня).
+	models.MetricTasksOnTime: `SELECT COUNT(*) FROM tasks t
+		JOIN users u ON u.user_id = t.user_id
+		WHERE t.user_id = $1 AND t.completed
+			AND CASE
+				WHEN t.deadline_time IS NOT NULL THEN
+					t.completed_at AT TIME ZONE 'UTC'
+						<= (t.deadline + t.deadline_time)
+							AT TIME ZONE COALESCE(NULLIF(t.deadline_timezone, ''), u.timezone)
+				ELSE
+					t.completed_at AT TIME ZONE 'UTC'
+						< (t.deadline + 1 + make_interval(hours => u.day_start))
+							AT TIME ZONE u.timezone
+			END`,
+	models.MetricLevel: `SELECT COALESCE(MAX(level), 1) FROM stats WHERE user_id = $1`,
+	models.MetricQuestsWon: `SELECT COUNT(*) FROM quest_contributions c
+		JOIN quests q ON q.quest_id = c.quest_id
+		WHERE c.user_id = $1 AND q.status = 'won'`,
+}
+
+func GetAchievementMetrics(userID int, metrics []string, conn *pgxpool.Pool) (map[string]int, error) {
+	values := make(map[string]int, len(metrics))
+	for _, metric := range metrics {
+		query, ok := metricQueries[metric]
+		if !ok {
+			return nil, fmt.Errorf("unknown metric %q", metric)
+		}
+		var value int
+		if err := conn.QueryRow(context.Background(), query, userID).Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to get metric %s: %w", metric, err)
+		}
+		values[metric] = value
+	}
+	return values, nil
+}
+
+func GetUserAchievements(userID int, conn *pgxpool.Pool) (map[string]time.Time, error) {
+	rows, err := conn.Query(context.Background(),
+		`SELECT achievement, unlocked_at
+		FROM user_achievements
+		WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get achievements: %w", err)
+	}
+	defer rows.Close()
+
+	unlocked := map[string]time.Time{}
+	for rows.Next() {
+		var key string
+		var at time.Time
+		if err := rows.Scan(&key, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan achievement: %w", err)
+		}
+		unlocked[key] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return unlocked, nil
+}
+
+// UnlockAchievements выдает достижения и возвращает только новые - уже
+// полученные пропускаются, так что повторная проверка безопасна.
+func UnlockAchievements(userID int, keys []string, conn *pgxpool.Pool) ([]models.UserAchievement, error) {
+	unlocked := []models.UserAchievement{}
+	if len(keys) == 0 {
+		return unlocked, nil
+	}
+
+	rows, err := conn.Query(context.Background(),
+		`INSERT INTO user_achievements (user_id, achievement)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, achievement) DO NOTHING
+		RETURNING achievement, unlocked_at`,
+		userID,
+		keys,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock achievements: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var achievement models.UserAchievement
+		if err := rows.Scan(&achievement.Achievement, &achievement.UnlockedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan achievement: %w", err)
+		}
+		unlocked = append(unlocked, achievement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return unlocked, nil
+}
+
+// GetUserIDsAfter - страница идентификаторов пользователей по возрастанию
+func GetUserIDsAfter(afterID int, limit int, conn *pgxpool.Pool) ([]int, error) {
+	rows, err := conn.Query(context.Background(),
+		`SELECT user_id
+		FROM users
+		WHERE user_id > $1
+		ORDER BY user_id
+		LIMIT $2`,
+		afterID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ClaimAchievementBackfill отмечает, что проверка достижений версии
+// version запущена. false - ее уже выполнил этот или другой экземпляр
+// сервера.
+func ClaimAchievementBackfill(version string, conn *pgxpool.Pool) (bool, error) {
+	tag, err := conn.Exec(context.Background(),
+		`INSERT INTO achievement_backfills (version)
+		VALUES ($1)
+		ON CONFLICT (version) DO NOTHING`,
+		version,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim achievements backfill: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ReleaseAchievementBackfill снимает отметку, если проверка не дошла до
+// конца, чтобы ее повторил следующий запуск
+func ReleaseAchievementBackfill(version string, conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(),
+		`DELETE FROM achievement_backfills WHERE version = $1`,
+		version,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release achievements backfill: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func AddChallenge(challenge models.Challenge, conn *pgxpool.Pool) (int, error) {
+	templates, err := json.Marshal(challenge.Templates)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode challenge templates: %w", err)
+	}
+
+	var id int
+	err = conn.QueryRow(context.Background(),
+		`INSERT INTO challenges (owner_id, name, description, templates)
+		VALUES ($1, $2, $3, $4)
+		RETURNING challenge_id`,
+		challenge.OwnerID,
+		challenge.Name,
+		challenge.Description,
+		templates,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert challenge: %w", err)
+	}
+	return id, nil
+}
+
+func GetChallenges(conn *pgxpool.Pool) ([]models.Challenge, error) {
+	var challenges []models.Challenge
+	rows, err := conn.Query(context.Background(),
+		`SELECT c.challenge_id, c.owner_id, c.name, c.description, c.templates, c.created_at,
+			(SELECT COUNT(*) FROM challenge_members m WHERE m.challenge_id = c.challenge_id)
+		FROM challenges c
+		ORDER BY c.challenge_id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get challenges: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var challenge models.Challenge
+		var templates []byte
+		err := rows.Scan(
+			&challenge.ID,
+			&challenge.OwnerID,
+			&challenge.Name,
+			&challenge.Description,
+			&templates,
+			&challenge.CreatedAt,
+			&challenge.Members,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan challenge: %w", err)
+		}
+		if err := json.Unmarshal(templates, &challenge.Templates); err != nil {
+			return nil, fmt.Errorf("failed to decode challenge templates: %w", err)
+		}
+		challenges = append(challenges, challenge)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return challenges, nil
+}
+
+// DeleteChallenge - удалить испытание может только автор. Скопированные
+// участникам элементы остаются у них, пропадает только связь.
+func DeleteChallenge(challengeID int, ownerID int, conn *pgxpool.Pool) error {
+	var actualOwnerID int
+	err := conn.QueryRow(context.Background(),
+		`SELECT owner_id
+		FROM challenges
+		WHERE challenge_id = $1`,
+		challengeID,
+	).Scan(&actualOwnerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("challenge not found")
+		}
+		return fmt.Errorf("failed to get challenge: %w", err)
+	}
+	if actualOwnerID != ownerID {
+		return fmt.Errorf("only the owner can delete the challenge")
+	}
+
+	_, err = conn.Exec(context.Background(),
+		`DELETE FROM challenges
+		WHERE challenge_id = $1`,
+		challengeID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete challenge: %w", err)
+	}
+	return nil
+}
+
+// JoinChallenge копирует шаблоны испытания пользователю и связывает копии
+// с испытанием. Счетчики и серии начинаются с нуля, ежедневные задачи -
+// с дня вступления.
+func JoinChallenge(challengeID int, userID int, today time.Time, conn *pgxpool.Pool) (*models.ChallengeTemplates, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var data []byte
+	err = tx.QueryRow(ctx,
+		`SELECT templates
+		FROM challenges
+		WHERE challenge_id = $1`,
+		challengeID,
+	).Scan(&data)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("challenge not found")
+		}
+		return nil, fmt.Errorf("failed to get challenge: %w", err)
+	}
+	var templates models.ChallengeTemplates
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to decode challenge templates: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO challenge_members (challenge_id, user_id)
+		VALUES ($1, $2)`,
+		challengeID,
+		userID,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("already joined")
+		}
+		return nil, fmt.Errorf("failed to join challenge: %w", err)
+	}
+
+	created := &models.ChallengeTemplates{}
+
+	for _, habit := range templates.Habits {
+		habit.UserID = userID
+		habit.GoodCount, habit.BadCount = 0, 0
+		habit.TotalGoodCount, habit.TotalBadCount = 0, 0
+		habit.Value, habit.Strength = 0, game.HabitStrength(0)
+		habit.CountReset = habit.ResetPeriod()
+		habit.CountsSince = today
+		err = tx.QueryRow(ctx,
+			`INSERT INTO habits (
+				user_id, text, note, good, bad, difficulty,
+				count_reset, good_count, bad_count, counts_since)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id`,
+			habit.UserID,
+			habit.Text,
+			habit.Note,
+			habit.Good,
+			habit.Bad,
+			habit.Difficulty,
+			habit.CountReset,
+			habit.GoodCount,
+			habit.BadCount,
+			habit.CountsSince,
+		).Scan(&habit.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy habit %q: %w", habit.Text, err)
+		}
+		if err := linkChallengeItem(ctx, tx, challengeID, userID, "habit", habit.ID); err != nil {
+			return nil, err
+		}
+		created.Habits = append(created.Habits, habit)
+	}
+
+	for _, daily := range templates.Dailies {
+		daily.UserID = userID
+		daily.StartDate = today
+		daily.Streak = 0
+		daily.LastCompleted = nil
+		err = tx.QueryRow(ctx,
+			`INSERT INTO dailies (
+				user_id, text, note, difficulty, start_date,
+				repeat_every, repeat_every_x, dayweeks, streak)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id`,
+			daily.UserID,
+			daily.Text,
+			daily.Note,
+			daily.Difficulty,
+			daily.StartDate,
+			daily.RepeatEvery,
+			daily.RepeatEveryX,
+			daily.DayWeeks,
+			daily.Streak,
+		).Scan(&daily.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy daily %q: %w", daily.Text, err)
+		}
+		if err := linkChallengeItem(ctx, tx, challengeID, userID, "daily", daily.ID); err != nil {
+			return nil, err
+		}
+		created.Dailies = append(created.Dailies, daily)
+	}
+
+	for _, task := range templates.Tasks {
+		task.UserID = userID
+		task.Completed = false
+		task.CompletedAt = nil
+		// Структура задач владельца испытания не переносится
+		task.ParentID = nil
+		task.BlockedBy, task.Blocked = nil, false
+		task.ID, err = insertTask(ctx, tx, task)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy task %q: %w", task.Name, err)
+		}
+		if err := linkChallengeItem(ctx, tx, challengeID, userID, "task", task.ID); err != nil {
+			return nil, err
+		}
+		created.Tasks = append(created.Tasks, task)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return created, nil
+}
+
+func linkChallengeItem(ctx context.Context, tx pgx.Tx, challengeID int, userID int, kind string, itemID int) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO challenge_links (challenge_id, user_id, kind, item_id)
+		VALUES ($1, $2, $3, $4)`,
+		challengeID,
+		userID,
+		kind,
+		itemID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to link challenge item: %w", err)
+	}
+	return nil
+}
+
+// LeaveChallenge выводит пользователя из испытания. Если keepItems
+// false, связанные элементы удаляются и возвращаются вызывающему;
+// иначе они остаются обычными элементами пользователя.
+func LeaveChallenge(challengeID int, userID int, keepItems bool, conn *pgxpool.Pool) ([]models.ChallengeLink, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var deleted []models.ChallengeLink
+	if !keepItems {
+		rows, err := tx.Query(ctx,
+			`SELECT challenge_id, user_id, kind, item_id
+			FROM challenge_links
+			WHERE challenge_id = $1 AND user_id = $2`,
+			challengeID,
+			userID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get challenge items: %w", err)
+		}
+		for rows.Next() {
+			var link models.ChallengeLink
+			if err := rows.Scan(&link.ChallengeID, &link.UserID, &link.Kind, &link.ItemID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan challenge item: %w", err)
+			}
+			deleted = append(deleted, link)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating over rows: %w", err)
+		}
+
+		tables := map[string]string{"habit": "habits", "daily": "dailies", "task": "tasks"}
+		for _, link := range deleted {
+			_, err := tx.Exec(ctx,
+				`DELETE FROM `+tables[link.Kind]+`
+				WHERE id = $1 AND user_id = $2`,
+				link.ItemID,
+				userID,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete challenge %s: %w", link.Kind, err)
+			}
+		}
+	}
+
+	// Связи удаляются каскадом вместе с участием
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM challenge_members
+		WHERE challenge_id = $1 AND user_id = $2`,
+		challengeID,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to leave challenge: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("not a challenge member")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+// GetChallengeLeaderboard считает очки участников по связанным элементам,
+// которые еще существуют. При равенстве очков выше тот, у кого длиннее
+// лучшая серия, затем - кто раньше вступил.
+func GetChallengeLeaderboard(challengeID int, conn *pgxpool.Pool) ([]models.LeaderboardEntry, error) {
+	var exists bool
+	err := conn.QueryRow(context.Background(),
+		`SELECT EXISTS(SELECT 1 FROM challenges WHERE challenge_id = $1)`,
+		challengeID,
+	).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check challenge: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("challenge not found")
+	}
+
+	entries := []models.LeaderboardEntry{}
+	rows, err := conn.Query(context.Background(),
+		`WITH habit_scores AS (
+			SELECT l.user_id, SUM(h.total_good_count - h.total_bad_count) AS score
+			FROM challenge_links l
+			JOIN habits h ON h.id = l.item_id
+			WHERE l.challenge_id = $1 AND l.kind = 'habit'
+			GROUP BY l.user_id),
+		streaks AS (
+			SELECT l.user_id, SUM(d.streak) AS total, MAX(d.streak) AS best
+			FROM challenge_links l
+			JOIN dailies d ON d.id = l.item_id
+			WHERE l.challenge_id = $1 AND l.kind = 'daily'
+			GROUP BY l.user_id),
+		completed AS (
+			SELECT l.user_id, COUNT(*) AS total
+			FROM challenge_links l
+			JOIN tasks t ON t.id = l.item_id
+			WHERE l.challenge_id = $1 AND l.kind = 'task' AND t.completed
+			GROUP BY l.user_id)
+		SELECT m.user_id, u.username,
+			COALESCE(h.score, 0)::int,
+			COALESCE(s.total, 0)::int,
+			COALESCE(s.best, 0)::int,
+			COALESCE(c.total, 0)::int
+		FROM challenge_members m
+		JOIN users u ON u.user_id = m.user_id
+		LEFT JOIN habit_scores h ON h.user_id = m.user_id
+		LEFT JOIN streaks s ON s.user_id = m.user_id
+		LEFT JOIN completed c ON c.user_id = m.user_id
+		WHERE m.challenge_id = $1
+		ORDER BY COALESCE(h.score, 0) + COALESCE(s.total, 0) + COALESCE(c.total, 0) DESC,
+			COALESCE(s.best, 0) DESC,
+			m.joined_at`,
+		challengeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		err := rows.Scan(
+			&entry.UserID,
+			&entry.Username,
+			&entry.HabitScore,
+			&entry.StreakTotal,
+			&entry.BestStreak,
+			&entry.TasksCompleted,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard entry: %w", err)
+		}
+		entry.Score = entry.HabitScore + entry.StreakTotal + entry.TasksCompleted
+		entry.Rank = len(entries) + 1
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return entries, nil
+}
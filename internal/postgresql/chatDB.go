@@ -0,0 +1,110 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"huibitica/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ChatChannel - канал LISTEN/NOTIFY для новых сообщений чата,
+// в уведомлении передается ID сообщения
+const ChatChannel = "huibitica_chat"
+
+// KickChannel - канал LISTEN/NOTIFY для отписки пользователя от канала
+// чата на всех экземплярах, в уведомлении - "<user_id> <канал>"
+const KickChannel = "huibitica_kick"
+
+func NotifyKick(userID int, channel string, conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(),
+		`SELECT pg_notify($1, $2)`,
+		KickChannel,
+		fmt.Sprintf("%d %s", userID, channel),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to notify kick: %w", err)
+	}
+	return nil
+}
+
+func AddChatMessage(message *models.ChatMessage, conn *pgxpool.Pool) error {
+	err := conn.QueryRow(context.Background(),
+		`WITH m AS (
+			INSERT INTO chat_messages (channel, user_id, text)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at)
+		SELECT id, created_at, pg_notify($4, id::text)
+		FROM m`,
+		message.Channel,
+		message.UserID,
+		message.Text,
+		ChatChannel,
+	).Scan(&message.ID, &message.CreatedAt, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add chat message: %w", err)
+	}
+	return nil
+}
+
+func GetChatMessage(id int64, conn *pgxpool.Pool) (*models.ChatMessage, error) {
+	var message models.ChatMessage
+	err := conn.QueryRow(context.Background(),
+		`SELECT id, channel, user_id, text, created_at
+		FROM chat_messages
+		WHERE id = $1`,
+		id,
+	).Scan(
+		&message.ID,
+		&message.Channel,
+		&message.UserID,
+		&message.Text,
+		&message.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat message: %w", err)
+	}
+	return &message, nil
+}
+
+// GetChatHistory - последние limit сообщений канала в хронологическом порядке
+func GetChatHistory(channel string, limit int, conn *pgxpool.Pool) ([]models.ChatMessage, error) {
+	var messages []models.ChatMessage
+	rows, err := conn.Query(context.Background(),
+		`SELECT id, channel, user_id, text, created_at
+		FROM (
+			SELECT id, channel, user_id, text, created_at
+			FROM chat_messages
+			WHERE channel = $1
+			ORDER BY id DESC
+			LIMIT $2) recent
+		ORDER BY id`,
+		channel,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message models.ChatMessage
+		err := rows.Scan(
+			&message.ID,
+			&message.Channel,
+			&message.UserID,
+			&message.Text,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,287 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// userBonuses - бонусы надетого снаряжения вместе с приростом
+// характеристик класса
+func userBonuses(ctx context.Context, q querier, userID int) (game.Bonuses, error) {
+	bonuses, err := equipmentBonuses(ctx, q, userID)
+	if err != nil {
+		return game.Bonuses{}, err
+	}
+
+	var class string
+	var level int
+	err = q.QueryRow(ctx,
+		`SELECT class, level
+		FROM stats
+		WHERE user_id = $1`,
+		userID,
+	).Scan(&class, &level)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return game.Bonuses{}, fmt.Errorf("failed to get class: %w", err)
+	}
+
+	return bonuses.Add(game.ClassBonuses(class, level)), nil
+}
+
+// SetClass выбирает класс персонажа. Выбрать можно с game.ClassLevel
+// уровня, смена уже выбранного класса стоит золота.
+func SetClass(userID int, class string, conn *pgxpool.Pool) (*models.Stats, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stats, err := lockStats(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Level < game.ClassLevel {
+		return nil, fmt.Errorf("level too low")
+	}
+	if stats.Class == class {
+		return nil, fmt.Errorf("class already chosen")
+	}
+	if stats.Class != "" {
+		if stats.Gold < game.ClassChangeCost {
+			return nil, fmt.Errorf("not enough gold")
+		}
+		stats.Gold -= game.ClassChangeCost
+	}
+	stats.Class = class
+	if err := saveStats(ctx, tx, stats); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &stats, nil
+}
+
+// GetSkillCasts - когда пользователь последний раз применял каждое умение
+func GetSkillCasts(userID int, conn *pgxpool.Pool) (map[string]time.Time, error) {
+	rows, err := conn.Query(context.Background(),
+		`SELECT skill, cast_at
+		FROM skill_casts
+		WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get skill casts: %w", err)
+	}
+	defer rows.Close()
+
+	casts := map[string]time.Time{}
+	for rows.Next() {
+		var skill string
+		var at time.Time
+		if err := rows.Scan(&skill, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan skill cast: %w", err)
+		}
+		casts[skill] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return casts, nil
+}
+
+// CastSkill применяет умение класса: проверяет перезарядку, класс и ману,
+// выполняет эффект и списывает ману - все в одной транзакции. Эффект
+// идет до блокировки статов заклинателя, чтобы сохранить общий порядок
+// блокировок: квест, затем статы. today - день, который защищает
+// скрытность.
+func CastSkill(userID int, skill game.Skill, targetID int, now time.Time, today time.Time, conn *pgxpool.Pool) (*models.SkillResult, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Строка перезарядки блокируется сразу, даже если умение еще не
+	// применялось, чтобы два одновременных применения не прошли оба
+	var lastCast time.Time
+	err = tx.QueryRow(ctx,
+		`INSERT INTO skill_casts (user_id, skill, cast_at)
+		VALUES ($1, $2, 'epoch')
+		ON CONFLICT (user_id, skill) DO UPDATE
+		SET cast_at = skill_casts.cast_at
+		RETURNING cast_at`,
+		userID,
+		skill.Key,
+	).Scan(&lastCast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check cooldown: %w", err)
+	}
+	if now.Before(lastCast.Add(skill.CooldownDuration())) {
+		return nil, fmt.Errorf("skill on cooldown")
+	}
+
+	var class string
+	err = tx.QueryRow(ctx,
+		`SELECT class FROM stats WHERE user_id = $1`,
+		userID,
+	).Scan(&class)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get class: %w", err)
+	}
+	if _, skillClass, _ := game.FindSkill(skill.Key); skillClass != class {
+		return nil, fmt.Errorf("skill not available for class")
+	}
+
+	result := &models.SkillResult{Skill: skill.Key}
+	switch skill.Key {
+	case game.SkillPowerStrike:
+		hit, err := damageBoss(ctx, tx, userID, game.PowerStrikeDamage)
+		if err != nil {
+			return nil, err
+		}
+		if hit == nil {
+			return nil, fmt.Errorf("quest not found")
+		}
+		result.Quest = hit
+	case game.SkillEmpower:
+		task, err := empowerTask(ctx, tx, userID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		result.Task = task
+	case game.SkillHealParty:
+		healed, err := healParty(ctx, tx, userID, game.HealPartyHP)
+		if err != nil {
+			return nil, err
+		}
+		result.Healed = healed
+	case game.SkillStealth:
+		if err := shieldStreaks(ctx, tx, userID, today); err != nil {
+			return nil, err
+		}
+		result.ProtectedDay = today.Format(time.DateOnly)
+	default:
+		return nil, fmt.Errorf("unknown skill %q", skill.Key)
+	}
+
+	stats, err := lockStats(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Mana < skill.Mana {
+		return nil, fmt.Errorf("not enough mana")
+	}
+	stats.Mana -= skill.Mana
+	if err := saveStats(ctx, tx, stats); err != nil {
+		return nil, err
+	}
+	result.Stats = stats
+	for i := range result.Healed {
+		if result.Healed[i].UserID == userID {
+			result.Healed[i] = stats
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE skill_casts
+		SET cast_at = $3
+		WHERE user_id = $1 AND skill = $2`,
+		userID,
+		skill.Key,
+		now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save skill cast: %w", err)
+	}
+	result.ReadyAt = now.Add(skill.CooldownDuration())
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// empowerTask повышает сложность невыполненной задачи, но не выше
+// максимальной
+func empowerTask(ctx context.Context, tx pgx.Tx, userID int, taskID int) (*models.Task, error) {
+	var task models.Task
+	err := scanTask(tx.QueryRow(ctx,
+		`UPDATE tasks
+		SET difficulty = LEAST(difficulty + 1, $3)
+		WHERE id = $1 AND user_id = $2 AND NOT completed
+		RETURNING `+taskColumns,
+		taskID,
+		userID,
+		models.MaxDifficulty,
+	), &task)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task not found")
+		}
+		return nil, fmt.Errorf("failed to empower task: %w", err)
+	}
+	return &task, nil
+}
+
+// healParty лечит пользователя и всех участников его группы. Статы
+// блокируются по возрастанию user_id, как и в квестах.
+func healParty(ctx context.Context, tx pgx.Tx, userID int, hp int) ([]models.Stats, error) {
+	members := []int{userID}
+	var partyID int
+	err := tx.QueryRow(ctx,
+		`SELECT party_id FROM party_members WHERE user_id = $1`,
+		userID,
+	).Scan(&partyID)
+	if err == nil {
+		members, err = partyMemberIDs(ctx, tx, partyID)
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get party: %w", err)
+	}
+
+	healed := make([]models.Stats, 0, len(members))
+	for _, memberID := range members {
+		stats, err := lockStats(ctx, tx, memberID)
+		if err != nil {
+			return nil, err
+		}
+		stats = game.Heal(stats, hp)
+		if err := saveStats(ctx, tx, stats); err != nil {
+			return nil, err
+		}
+		healed = append(healed, stats)
+	}
+	return healed, nil
+}
+
+func shieldStreaks(ctx context.Context, tx pgx.Tx, userID int, day time.Time) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO streak_shields (user_id, day)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, day) DO NOTHING`,
+		userID,
+		day,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to protect streaks: %w", err)
+	}
+	return nil
+}
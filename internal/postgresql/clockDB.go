@@ -0,0 +1,91 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/schedule"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetUserClock - часы пользователя. Для неизвестного пользователя -
+// schedule.UTC, как было до появления настроек.
+func GetUserClock(userID int, conn *pgxpool.Pool) (schedule.Clock, error) {
+	return userClock(context.Background(), conn, userID)
+}
+
+func userClock(ctx context.Context, q querier, userID int) (schedule.Clock, error) {
+	var timezone string
+	var dayStart int
+	err := q.QueryRow(ctx,
+		`SELECT timezone, day_start
+		FROM users
+		WHERE user_id = $1`,
+		userID,
+	).Scan(&timezone, &dayStart)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return schedule.UTC, nil
+		}
+		return schedule.Clock{}, fmt.Errorf("failed to get user clock: %w", err)
+	}
+	return clockOrUTC(timezone, dayStart), nil
+}
+
+// GetUserClocks - часы всех пользователей, для фоновых задач
+func GetUserClocks(conn *pgxpool.Pool) (map[int]schedule.Clock, error) {
+	rows, err := conn.Query(context.Background(),
+		`SELECT user_id, timezone, day_start
+		FROM users`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user clocks: %w", err)
+	}
+	defer rows.Close()
+
+	clocks := map[int]schedule.Clock{}
+	for rows.Next() {
+		var userID, dayStart int
+		var timezone string
+		if err := rows.Scan(&userID, &timezone, &dayStart); err != nil {
+			return nil, fmt.Errorf("failed to scan user clock: %w", err)
+		}
+		clocks[userID] = clockOrUTC(timezone, dayStart)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return clocks, nil
+}
+
+// clockOrUTC - пояс проверяется при сохранении, но может пропасть из
+// базы tzdata сервера; тогда считаем по UTC, а не ломаем смену дня
+func clockOrUTC(timezone string, dayStart int) schedule.Clock {
+	clock, err := schedule.NewClock(timezone, dayStart)
+	if err != nil {
+		return schedule.UTC
+	}
+	return clock
+}
+
+func EditUserClock(userID int, timezone string, dayStart int, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`UPDATE users
+		SET timezone = $1, day_start = $2
+		WHERE user_id = $3`,
+		timezone,
+		dayStart,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update timezone: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventsChannel - канал LISTEN/NOTIFY, через который экземпляры сервера
+// узнают о новых событиях. В уведомлении передается только ID записи.
+const EventsChannel = "huibitica_events"
+
+// AppendEvent сохраняет событие в журнал и в том же запросе уведомляет
+// остальные экземпляры сервера
+func AppendEvent(userID int, eventType string, data []byte, conn *pgxpool.Pool) (int64, time.Time, error) {
+	var id int64
+	var createdAt time.Time
+	err := conn.QueryRow(context.Background(),
+		`WITH e AS (
+			INSERT INTO event_log (user_id, type, data)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at)
+		SELECT id, created_at, pg_notify($4, id::text)
+		FROM e`,
+		userID,
+		eventType,
+		data,
+		EventsChannel,
+	).Scan(&id, &createdAt, nil)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to append event: %w", err)
+	}
+	return id, createdAt, nil
+}
+
+func GetEvent(id int64, conn *pgxpool.Pool) (*models.EventRecord, error) {
+	var record models.EventRecord
+	err := conn.QueryRow(context.Background(),
+		`SELECT id, user_id, type, data, created_at
+		FROM event_log
+		WHERE id = $1`,
+		id,
+	).Scan(
+		&record.ID,
+		&record.UserID,
+		&record.Type,
+		&record.Data,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	return &record, nil
+}
+
+// GetEventsSince - события пользователя после afterID по возрастанию,
+// для продолжения потока с Last-Event-ID
+func GetEventsSince(userID int, afterID int64, limit int, conn *pgxpool.Pool) ([]models.EventRecord, error) {
+	var records []models.EventRecord
+	rows, err := conn.Query(context.Background(),
+		`SELECT id, user_id, type, data, created_at
+		FROM event_log
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`,
+		userID,
+		afterID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.EventRecord
+		err := rows.Scan(
+			&record.ID,
+			&record.UserID,
+			&record.Type,
+			&record.Data,
+			&record.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return records, nil
+}
+
+func DeleteEventsBefore(before time.Time, conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(),
+		`DELETE FROM event_log
+		WHERE created_at < $1`,
+		before,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete old events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"huibitica/internal/schedule"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ResetHabitCounts обнуляет счетчики привычек пользователя, у которых
+// к дню today начался новый период, и возвращает, сколько привычек
+// сброшено
+func ResetHabitCounts(userID int, today time.Time, conn *pgxpool.Pool) (int, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	reset, err := resetHabitCounts(ctx, tx, userID, today)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reset, nil
+}
+
+// resetHabitCounts переносит счетчики прошедшего периода в habit_history
+// и обнуляет их. Пустые периоды в историю не пишутся. Счетчики за все
+// время не меняются.
+//
+// Счетчики копятся только в периоде, где лежит counts_since: отметка
+// сначала сбрасывает прошедший период. Поэтому запись истории - это
+// counts_since и конец его периода, а не весь промежуток до сброса,
+// который мог занять несколько пустых периодов.
+func resetHabitCounts(ctx context.Context, tx pgx.Tx, userID int, today time.Time) (int, error) {
+	firstDay, err := userWeekStart(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var reset int
+	err = tx.QueryRow(ctx,
+		`WITH stale AS (
+			SELECT id, user_id, counts_since, good_count, bad_count,
+				CASE count_reset
+					WHEN 'daily' THEN $2::date
+					WHEN 'weekly' THEN $3::date
+					ELSE $4::date
+				END AS period_start
+			FROM habits
+			WHERE user_id = $1 AND count_reset <> 'never'
+				AND counts_since < CASE count_reset
+					WHEN 'daily' THEN $2::date
+					WHEN 'weekly' THEN $3::date
+					ELSE $4::date
+				END
+			FOR UPDATE),
+		reset AS (
+			UPDATE habits h
+			SET good_count = 0, bad_count = 0, counts_since = s.period_start
+			FROM stale s
+			WHERE h.id = s.id
+			RETURNING s.id, s.user_id, h.count_reset, s.counts_since, s.period_start,
+				s.good_count, s.bad_count),
+		archived AS (
+			INSERT INTO habit_history (habit_id, user_id, period_start, period_end, good_count, bad_count)
+			SELECT id, user_id, counts_since,
+				LEAST(period_start - 1, CASE count_reset
+					WHEN 'daily' THEN counts_since
+					WHEN 'weekly' THEN counts_since + 6
+						- (EXTRACT(DOW FROM counts_since)::int - $5 + 7) % 7
+					ELSE (date_trunc('month', counts_since) + interval '1 month - 1 day')::date
+				END),
+				good_count, bad_count
+			FROM reset
+			WHERE good_count > 0 OR bad_count > 0
+			ON CONFLICT (habit_id, period_start) DO NOTHING)
+		SELECT COUNT(*) FROM reset`,
+		userID,
+		schedule.PeriodStart(models.ResetDaily, today, firstDay),
+		schedule.PeriodStart(models.ResetWeekly, today, firstDay),
+		schedule.PeriodStart(models.ResetMonthly, today, firstDay),
+		int(firstDay),
+	).Scan(&reset)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset habit counters: %w", err)
+	}
+	return reset, nil
+}
+
+// DecayHabitValues сдвигает к нулю силу привычек пользователя, у которых
+// только одна кнопка (см. game.HabitDecay), и возвращает число
+// изменившихся привычек. Вызывается раз в день при смене дня.
+func DecayHabitValues(userID int, conn *pgxpool.Pool) (int, error) {
+	tag, err := conn.Exec(context.Background(),
+		`UPDATE habits
+		SET value = CASE WHEN ABS(value * $2) < $3 THEN 0 ELSE value * $2 END
+		WHERE user_id = $1 AND good <> bad AND value <> 0`,
+		userID,
+		game.HabitDecay,
+		game.HabitDecaySnap,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decay habit values: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// GetHabitHistory - счетчики привычки по завершившимся периодам, новые
+// первыми
+func GetHabitHistory(habitID int, conn *pgxpool.Pool) ([]models.HabitPeriod, error) {
+	ctx := context.Background()
+
+	var exists bool
+	err := conn.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM habits WHERE id = $1)`,
+		habitID,
+	).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check habit: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("habit not found")
+	}
+
+	periods := []models.HabitPeriod{}
+	rows, err := conn.Query(ctx,
+		`SELECT habit_id, period_start, period_end, good_count, bad_count
+		FROM habit_history
+		WHERE habit_id = $1
+		ORDER BY period_start DESC`,
+		habitID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get habit history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var period models.HabitPeriod
+		err := rows.Scan(
+			&period.HabitID,
+			&period.PeriodStart,
+			&period.PeriodEnd,
+			&period.GoodCount,
+			&period.BadCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan habit period: %w", err)
+		}
+		periods = append(periods, period)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return periods, nil
+}
@@ -0,0 +1,343 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ImportAccount создает пользователя (если UserID не указан) и все его
+// привычки, ежедневные задачи и задачи в одной транзакции. ID из документа
+// не используются - база выдает новые, а соответствие попадает в отчет.
+// При DryRun транзакция откатывается, поэтому отчет показывает ровно то,
+// что было бы создано.
+func ImportAccount(req models.ImportRequest, conn *pgxpool.Pool) (*models.ImportReport, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	report := &models.ImportReport{DryRun: req.DryRun, UserID: req.UserID, Ignored: req.Ignored}
+
+	if req.UserID == 0 {
+		report.UserID, err = importUser(ctx, tx, req)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var exists bool
+		err = tx.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)`,
+			req.UserID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check user: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("user not found")
+		}
+	}
+
+	existing, err := existingTitles(ctx, tx, report.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	clock, err := userClock(ctx, tx, report.UserID)
+	if err != nil {
+		return nil, err
+	}
+	today := clock.Today(time.Now())
+
+	for _, habit := range req.Data.Habits {
+		item := models.ImportedItem{Kind: "habit", OldID: habit.ID, Text: habit.Text}
+		skip, err := resolveConflict(req.OnConflict, existing["habit"], item)
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			report.Skipped = append(report.Skipped, item)
+			continue
+		}
+
+		err = tx.QueryRow(ctx,
+			`INSERT INTO habits (
+				user_id, text, note, good, bad, difficulty,
+				count_reset, good_count, bad_count, counts_since,
+				total_good_count, total_bad_count, value)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`,
+			report.UserID,
+			habit.Text,
+			habit.Note,
+			habit.Good,
+			habit.Bad,
+			habit.Difficulty,
+			habit.ResetPeriod(),
+			habit.GoodCount,
+			habit.BadCount,
+			today,
+			max(habit.TotalGoodCount, habit.GoodCount),
+			max(habit.TotalBadCount, habit.BadCount),
+			game.ClampHabitValue(habit.Value),
+		).Scan(&item.NewID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import habit %q: %w", habit.Text, err)
+		}
+		existing["habit"][habit.Text] = true
+		report.Created = append(report.Created, item)
+	}
+
+	for _, daily := range req.Data.Dailies {
+		item := models.ImportedItem{Kind: "daily", OldID: daily.ID, Text: daily.Text}
+		skip, err := resolveConflict(req.OnConflict, existing["daily"], item)
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			report.Skipped = append(report.Skipped, item)
+			continue
+		}
+
+		err = tx.QueryRow(ctx,
+			`INSERT INTO dailies (
+				user_id, text, note, difficulty, start_date,
+				repeat_every, repeat_every_x, dayweeks, streak)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id`,
+			report.UserID,
+			daily.Text,
+			daily.Note,
+			daily.Difficulty,
+			daily.StartDate,
+			daily.RepeatEvery,
+			daily.RepeatEveryX,
+			daily.DayWeeks,
+			daily.Streak,
+		).Scan(&item.NewID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import daily %q: %w", daily.Text, err)
+		}
+		existing["daily"][daily.Text] = true
+		report.Created = append(report.Created, item)
+	}
+
+	// Родители и зависимости ссылаются на старые ID, поэтому переносятся
+	// после того, как все задачи получили новые
+	taskIDs := map[int]int{}
+	var imported []models.Task
+	for _, task := range req.Data.Tasks {
+		item := models.ImportedItem{Kind: "task", OldID: task.ID, Text: task.Name}
+		skip, err := resolveConflict(req.OnConflict, existing["task"], item)
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			report.Skipped = append(report.Skipped, item)
+			continue
+		}
+
+		task.UserID = report.UserID
+		parentID := task.ParentID
+		task.ParentID = nil
+		item.NewID, err = insertTask(ctx, tx, task)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import task %q: %w", task.Name, err)
+		}
+		if task.ID != 0 {
+			taskIDs[task.ID] = item.NewID
+		}
+		task.ID, task.ParentID = item.NewID, parentID
+		imported = append(imported, task)
+		existing["task"][task.Name] = true
+		report.Created = append(report.Created, item)
+	}
+	if err := importTaskStructure(ctx, tx, report.UserID, imported, taskIDs); err != nil {
+		return nil, err
+	}
+
+	if req.DryRun {
+		// ID, выданные внутри откатываемой транзакции, клиенту бесполезны
+		if req.UserID == 0 {
+			report.UserID = 0
+		}
+		for i := range report.Created {
+			report.Created[i].NewID = 0
+		}
+		return report, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return report, nil
+}
+
+// importTaskStructure восстанавливает родителей и зависимости
+// импортированных задач. Ссылки на задачи вне импорта (пропущенные или
+// отсутствующие в файле) отбрасываются, циклы отклоняются так же, как при
+// обычном редактировании.
+func importTaskStructure(ctx context.Context, tx pgx.Tx, userID int, tasks []models.Task, taskIDs map[int]int) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	if err := lockTaskGraph(ctx, tx, userID); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if task.ParentID == nil {
+			continue
+		}
+		parentID, ok := taskIDs[*task.ParentID]
+		if !ok {
+			continue
+		}
+		if err := checkTaskParent(ctx, tx, userID, task.ID, parentID); err != nil {
+			return fmt.Errorf("failed to import task %q: %w", task.Name, err)
+		}
+		err := checkTaskGraph(ctx, tx, userID, taskGraphChange{
+			TaskID:                  task.ID,
+			ParentID:                &parentID,
+			AllowIncompleteSubtasks: task.AllowIncompleteSubtasks,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to import task %q: %w", task.Name, err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE tasks SET parent_id = $1 WHERE id = $2`, parentID, task.ID); err != nil {
+			return fmt.Errorf("failed to import task %q: %w", task.Name, err)
+		}
+	}
+
+	for _, task := range tasks {
+		for _, oldID := range task.BlockedBy {
+			blockedBy, ok := taskIDs[oldID]
+			if !ok {
+				continue
+			}
+			dep := models.TaskDependency{TaskID: task.ID, BlockedBy: blockedBy}
+			if err := dep.Validate(); err != nil {
+				return fmt.Errorf("failed to import task %q: %w", task.Name, err)
+			}
+			if err := checkTaskDependency(ctx, tx, userID, dep); err != nil {
+				return fmt.Errorf("failed to import task %q: %w", task.Name, err)
+			}
+			_, err := tx.Exec(ctx,
+				`INSERT INTO task_dependencies (task_id, blocked_by)
+				VALUES ($1, $2)
+				ON CONFLICT DO NOTHING`,
+				dep.TaskID,
+				dep.BlockedBy,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to import task %q: %w", task.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func importUser(ctx context.Context, tx pgx.Tx, req models.ImportRequest) (int, error) {
+	createdAt := req.Data.User.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	var userID int
+	err := tx.QueryRow(ctx,
+		`INSERT INTO users (username, email, phone, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING user_id`,
+		req.Data.User.Username,
+		req.Data.User.Email,
+		req.Data.User.Phone,
+		createdAt,
+	).Scan(&userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.ConstraintName {
+			case "users_username_key":
+				return 0, fmt.Errorf("username already exists")
+			case "users_email_key":
+				return 0, fmt.Errorf("email already exists")
+			}
+		}
+		return 0, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO passwords (user_id, username, password)
+		VALUES ($1, $2, $3)`,
+		userID,
+		req.Data.User.Username,
+		req.Password,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert password: %w", err)
+	}
+
+	return userID, nil
+}
+
+// existingTitles возвращает названия уже существующих элементов пользователя,
+// сгруппированные по типу - по ним определяются конфликты импорта.
+func existingTitles(ctx context.Context, tx pgx.Tx, userID int) (map[string]map[string]bool, error) {
+	titles := map[string]map[string]bool{
+		"habit": {},
+		"daily": {},
+		"task":  {},
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT 'habit', text FROM habits WHERE user_id = $1
+		UNION ALL
+		SELECT 'daily', text FROM dailies WHERE user_id = $1
+		UNION ALL
+		SELECT 'task', name FROM tasks WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, title string
+		if err := rows.Scan(&kind, &title); err != nil {
+			return nil, fmt.Errorf("failed to scan existing item: %w", err)
+		}
+		titles[kind][title] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return titles, nil
+}
+
+func resolveConflict(mode string, existing map[string]bool, item models.ImportedItem) (bool, error) {
+	if !existing[item.Text] {
+		return false, nil
+	}
+
+	switch mode {
+	case models.ConflictSkip:
+		return true, nil
+	case models.ConflictFail:
+		return false, fmt.Errorf("%s %q already exists", item.Kind, item.Text)
+	default:
+		return false, nil
+	}
+}
@@ -71,9 +71,14 @@ func InitDB(dbAddress string, dbName string) (*pgxpool.Pool, error) {
 			good BOOLEAN DEFAULT TRUE NOT NULL,
 			bad BOOLEAN DEFAULT FALSE NOT NULL,
 			difficulty INT NOT NULL CHECK (difficulty BETWEEN 1 AND 5),
-			count_reset_after INT DEFAULT 0 NOT NULL,
+			count_reset VARCHAR(16) DEFAULT 'never' NOT NULL
+				CHECK (count_reset IN ('never', 'daily', 'weekly', 'monthly')),
 			good_count INT DEFAULT 0 NOT NULL,
 			bad_count INT DEFAULT 0 NOT NULL,
+			counts_since DATE NOT NULL,
+			total_good_count INT DEFAULT 0 NOT NULL,
+			total_bad_count INT DEFAULT 0 NOT NULL,
+			value DOUBLE PRECISION DEFAULT 0 NOT NULL,
 			CONSTRAINT fk_habits_user 
 				FOREIGN KEY(user_id) 
 				REFERENCES users(user_id)
@@ -102,13 +107,435 @@ func InitDB(dbAddress string, dbName string) (*pgxpool.Pool, error) {
 			note VARCHAR(255),
 			difficulty INT NOT NULL CHECK (difficulty BETWEEN 1 AND 5),
 			deadline DATE NOT NULL,
+			recurrence VARCHAR(255) DEFAULT '' NOT NULL,
+			priority INT DEFAULT 0 NOT NULL CHECK (priority BETWEEN 0 AND 3),
+			start_date DATE,
+			deadline_time TIME,
+			deadline_timezone VARCHAR(64) DEFAULT '' NOT NULL,
+			estimated_minutes INT DEFAULT 0 NOT NULL,
+			parent_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+			allow_incomplete_subtasks BOOLEAN DEFAULT FALSE NOT NULL,
 			CONSTRAINT fk_tasks_user 
 				FOREIGN KEY(user_id) 
 				REFERENCES users(user_id)
 				ON DELETE CASCADE)`,
+
+		"user_tokens": `CREATE TABLE IF NOT EXISTS user_tokens (
+			token VARCHAR(64) PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			scope VARCHAR(32) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT fk_user_tokens_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"stats": `CREATE TABLE IF NOT EXISTS stats (
+			user_id INTEGER PRIMARY KEY,
+			level INT DEFAULT 1 NOT NULL,
+			xp INT DEFAULT 0 NOT NULL,
+			gold INT DEFAULT 0 NOT NULL CHECK (gold >= 0),
+			hp INT DEFAULT 50 NOT NULL,
+			mana INT DEFAULT 10 NOT NULL,
+			CONSTRAINT fk_stats_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"webhooks": `CREATE TABLE IF NOT EXISTS webhooks (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			url VARCHAR(2048) NOT NULL,
+			secret VARCHAR(64) NOT NULL,
+			events TEXT[] NOT NULL,
+			active BOOLEAN DEFAULT TRUE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT fk_webhooks_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"webhook_deliveries": `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id SERIAL PRIMARY KEY,
+			webhook_id INTEGER NOT NULL,
+			event VARCHAR(32) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(16) DEFAULT 'pending' NOT NULL,
+			attempts INT DEFAULT 0 NOT NULL,
+			next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			last_status INT DEFAULT 0 NOT NULL,
+			last_error VARCHAR(255) DEFAULT '' NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP,
+			CONSTRAINT fk_webhook_deliveries_webhook
+				FOREIGN KEY(webhook_id)
+				REFERENCES webhooks(id)
+				ON DELETE CASCADE)`,
+
+		"notification_settings": `CREATE TABLE IF NOT EXISTS notification_settings (
+			user_id INTEGER PRIMARY KEY,
+			email_enabled BOOLEAN DEFAULT TRUE NOT NULL,
+			remind_at TIME DEFAULT '08:00' NOT NULL,
+			deadline_days INT DEFAULT 1 NOT NULL CHECK (deadline_days >= 0),
+			CONSTRAINT fk_notification_settings_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"reminders_sent": `CREATE TABLE IF NOT EXISTS reminders_sent (
+			user_id INTEGER NOT NULL,
+			item_kind VARCHAR(16) NOT NULL,
+			item_id INTEGER NOT NULL,
+			day DATE NOT NULL,
+			sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, item_kind, item_id, day),
+			CONSTRAINT fk_reminders_sent_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"notification_channels": `CREATE TABLE IF NOT EXISTS notification_channels (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			kind VARCHAR(16) NOT NULL,
+			endpoint VARCHAR(2048) NOT NULL,
+			p256dh VARCHAR(255) DEFAULT '' NOT NULL,
+			auth VARCHAR(255) DEFAULT '' NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, kind, endpoint),
+			CONSTRAINT fk_notification_channels_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"event_log": `CREATE TABLE IF NOT EXISTS event_log (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			type VARCHAR(32) NOT NULL,
+			data JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_event_log_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"chat_messages": `CREATE TABLE IF NOT EXISTS chat_messages (
+			id BIGSERIAL PRIMARY KEY,
+			channel VARCHAR(64) NOT NULL,
+			user_id INTEGER NOT NULL,
+			text VARCHAR(500) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_chat_messages_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"parties": `CREATE TABLE IF NOT EXISTS parties (
+			party_id SERIAL PRIMARY KEY,
+			name VARCHAR(63) NOT NULL,
+			owner_id INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_parties_owner
+				FOREIGN KEY(owner_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"party_members": `CREATE TABLE IF NOT EXISTS party_members (
+			party_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL UNIQUE,
+			share_stats BOOLEAN DEFAULT TRUE NOT NULL,
+			share_progress BOOLEAN DEFAULT TRUE NOT NULL,
+			joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			PRIMARY KEY (party_id, user_id),
+			CONSTRAINT fk_party_members_party
+				FOREIGN KEY(party_id)
+				REFERENCES parties(party_id)
+				ON DELETE CASCADE,
+			CONSTRAINT fk_party_members_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"party_invites": `CREATE TABLE IF NOT EXISTS party_invites (
+			party_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			inviter_id INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			PRIMARY KEY (party_id, user_id),
+			CONSTRAINT fk_party_invites_party
+				FOREIGN KEY(party_id)
+				REFERENCES parties(party_id)
+				ON DELETE CASCADE,
+			CONSTRAINT fk_party_invites_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE,
+			CONSTRAINT fk_party_invites_inviter
+				FOREIGN KEY(inviter_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"challenges": `CREATE TABLE IF NOT EXISTS challenges (
+			challenge_id SERIAL PRIMARY KEY,
+			owner_id INTEGER NOT NULL,
+			name VARCHAR(63) NOT NULL,
+			description VARCHAR(255) DEFAULT '' NOT NULL,
+			templates JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_challenges_owner
+				FOREIGN KEY(owner_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"challenge_members": `CREATE TABLE IF NOT EXISTS challenge_members (
+			challenge_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			PRIMARY KEY (challenge_id, user_id),
+			CONSTRAINT fk_challenge_members_challenge
+				FOREIGN KEY(challenge_id)
+				REFERENCES challenges(challenge_id)
+				ON DELETE CASCADE,
+			CONSTRAINT fk_challenge_members_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"challenge_links": `CREATE TABLE IF NOT EXISTS challenge_links (
+			challenge_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			kind VARCHAR(16) NOT NULL,
+			item_id INTEGER NOT NULL,
+			PRIMARY KEY (kind, item_id),
+			CONSTRAINT fk_challenge_links_member
+				FOREIGN KEY(challenge_id, user_id)
+				REFERENCES challenge_members(challenge_id, user_id)
+				ON DELETE CASCADE)`,
+
+		"quests": `CREATE TABLE IF NOT EXISTS quests (
+			quest_id SERIAL PRIMARY KEY,
+			party_id INTEGER NOT NULL,
+			boss VARCHAR(32) NOT NULL,
+			hp INT NOT NULL,
+			max_hp INT NOT NULL,
+			status VARCHAR(16) DEFAULT 'active' NOT NULL,
+			started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP,
+			CONSTRAINT fk_quests_party
+				FOREIGN KEY(party_id)
+				REFERENCES parties(party_id)
+				ON DELETE CASCADE)`,
+
+		"quest_contributions": `CREATE TABLE IF NOT EXISTS quest_contributions (
+			quest_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			damage INT DEFAULT 0 NOT NULL,
+			PRIMARY KEY (quest_id, user_id),
+			CONSTRAINT fk_quest_contributions_quest
+				FOREIGN KEY(quest_id)
+				REFERENCES quests(quest_id)
+				ON DELETE CASCADE,
+			CONSTRAINT fk_quest_contributions_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"rewards": `CREATE TABLE IF NOT EXISTS rewards (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			text VARCHAR(63) NOT NULL,
+			note VARCHAR(255),
+			cost INT NOT NULL CHECK (cost >= 0),
+			CONSTRAINT fk_rewards_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"reward_purchases": `CREATE TABLE IF NOT EXISTS reward_purchases (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			reward_id INTEGER,
+			text VARCHAR(63) NOT NULL,
+			cost INT NOT NULL,
+			purchased_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_reward_purchases_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE,
+			CONSTRAINT fk_reward_purchases_reward
+				FOREIGN KEY(reward_id)
+				REFERENCES rewards(id)
+				ON DELETE SET NULL)`,
+
+		"inventory": `CREATE TABLE IF NOT EXISTS inventory (
+			user_id INTEGER NOT NULL,
+			item VARCHAR(32) NOT NULL,
+			quantity INT DEFAULT 0 NOT NULL CHECK (quantity >= 0),
+			PRIMARY KEY (user_id, item),
+			CONSTRAINT fk_inventory_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"equipment": `CREATE TABLE IF NOT EXISTS equipment (
+			user_id INTEGER NOT NULL,
+			slot VARCHAR(16) NOT NULL,
+			item VARCHAR(32) NOT NULL,
+			PRIMARY KEY (user_id, slot),
+			CONSTRAINT fk_equipment_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"drop_counts": `CREATE TABLE IF NOT EXISTS drop_counts (
+			user_id INTEGER NOT NULL,
+			day DATE NOT NULL,
+			rolls INT DEFAULT 0 NOT NULL,
+			drops INT DEFAULT 0 NOT NULL,
+			PRIMARY KEY (user_id, day),
+			CONSTRAINT fk_drop_counts_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"pets": `CREATE TABLE IF NOT EXISTS pets (
+			user_id INTEGER NOT NULL,
+			pet VARCHAR(32) NOT NULL,
+			fullness INT DEFAULT 0 NOT NULL,
+			hatched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, pet),
+			CONSTRAINT fk_pets_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"mounts": `CREATE TABLE IF NOT EXISTS mounts (
+			user_id INTEGER NOT NULL,
+			mount VARCHAR(32) NOT NULL,
+			obtained_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, mount),
+			CONSTRAINT fk_mounts_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"user_achievements": `CREATE TABLE IF NOT EXISTS user_achievements (
+			user_id INTEGER NOT NULL,
+			achievement VARCHAR(64) NOT NULL,
+			unlocked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, achievement),
+			CONSTRAINT fk_user_achievements_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"achievement_backfills": `CREATE TABLE IF NOT EXISTS achievement_backfills (
+			version VARCHAR(64) PRIMARY KEY,
+			started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL)`,
+
+		"skill_casts": `CREATE TABLE IF NOT EXISTS skill_casts (
+			user_id INTEGER NOT NULL,
+			skill VARCHAR(32) NOT NULL,
+			cast_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, skill),
+			CONSTRAINT fk_skill_casts_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"streak_shields": `CREATE TABLE IF NOT EXISTS streak_shields (
+			user_id INTEGER NOT NULL,
+			day DATE NOT NULL,
+			PRIMARY KEY (user_id, day),
+			CONSTRAINT fk_streak_shields_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"vacations": `CREATE TABLE IF NOT EXISTS vacations (
+			vacation_id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			start_date DATE NOT NULL,
+			end_date DATE NOT NULL CHECK (end_date >= start_date),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_vacations_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"habit_history": `CREATE TABLE IF NOT EXISTS habit_history (
+			habit_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			period_start DATE NOT NULL,
+			period_end DATE NOT NULL,
+			good_count INT NOT NULL,
+			bad_count INT NOT NULL,
+			PRIMARY KEY (habit_id, period_start),
+			CONSTRAINT fk_habit_history_habit
+				FOREIGN KEY(habit_id)
+				REFERENCES habits(id)
+				ON DELETE CASCADE)`,
+
+		"task_templates": `CREATE TABLE IF NOT EXISTS task_templates (
+			template_id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			name VARCHAR(63) NOT NULL,
+			tasks JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_task_templates_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"user_settings": `CREATE TABLE IF NOT EXISTS user_settings (
+			user_id INTEGER PRIMARY KEY,
+			version INT NOT NULL,
+			data JSONB DEFAULT '{}' NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			CONSTRAINT fk_user_settings_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"task_dependencies": `CREATE TABLE IF NOT EXISTS task_dependencies (
+			task_id INTEGER NOT NULL,
+			blocked_by INTEGER NOT NULL CHECK (blocked_by <> task_id),
+			PRIMARY KEY (task_id, blocked_by),
+			CONSTRAINT fk_task_dependencies_task
+				FOREIGN KEY(task_id)
+				REFERENCES tasks(id)
+				ON DELETE CASCADE,
+			CONSTRAINT fk_task_dependencies_blocked_by
+				FOREIGN KEY(blocked_by)
+				REFERENCES tasks(id)
+				ON DELETE CASCADE)`,
+
+		"reminder_runs": `CREATE TABLE IF NOT EXISTS reminder_runs (
+			user_id INTEGER PRIMARY KEY,
+			last_day DATE NOT NULL,
+			CONSTRAINT fk_reminder_runs_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
+
+		"rollovers": `CREATE TABLE IF NOT EXISTS rollovers (
+			user_id INTEGER PRIMARY KEY,
+			last_day DATE NOT NULL,
+			CONSTRAINT fk_rollovers_user
+				FOREIGN KEY(user_id)
+				REFERENCES users(user_id)
+				ON DELETE CASCADE)`,
 	}
 
-	creationOrder := [5]string{"users", "passwords", "habits", "dailies", "tasks"}
+	creationOrder := [...]string{"users", "passwords", "habits", "dailies", "tasks", "user_tokens",
+		"stats", "webhooks", "webhook_deliveries", "notification_settings", "reminders_sent",
+		"notification_channels", "event_log", "chat_messages",
+		"parties", "party_members", "party_invites", "challenges", "challenge_members",
+		"challenge_links", "quests", "quest_contributions", "rollovers",
+		"rewards", "reward_purchases", "inventory", "equipment",
+		"drop_counts", "pets", "mounts", "user_achievements",
+		"achievement_backfills", "skill_casts", "streak_shields", "vacations", "user_settings",
+		"habit_history", "task_templates", "task_dependencies", "reminder_runs"}
 	for _, table := range creationOrder {
 		query := queries[table]
 		_, err = pool.Exec(context.Background(), query)
@@ -117,5 +544,77 @@ func InitDB(dbAddress string, dbName string) (*pgxpool.Pool, error) {
 		}
 	}
 
+	// Новые колонки в уже существующих таблицах. Выполняются по порядку,
+	// каждая миграция должна быть идемпотентной.
+	migrations := []string{
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed BOOLEAN DEFAULT FALSE NOT NULL`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP`,
+		`ALTER TABLE dailies ADD COLUMN IF NOT EXISTS last_completed DATE`,
+		`ALTER TABLE stats ADD COLUMN IF NOT EXISTS class VARCHAR(16) DEFAULT '' NOT NULL`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) DEFAULT 'UTC' NOT NULL`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS day_start INT DEFAULT 0 NOT NULL CHECK (day_start BETWEEN 0 AND 23)`,
+		`ALTER TABLE habits ADD COLUMN IF NOT EXISTS count_reset VARCHAR(16) DEFAULT 'never' NOT NULL
+			CHECK (count_reset IN ('never', 'daily', 'weekly', 'monthly'))`,
+		// Период существующих привычек начинается сегодня по часам
+		// пользователя, а не сервера; новые привычки передают дату сами
+		`ALTER TABLE habits ADD COLUMN IF NOT EXISTS counts_since DATE`,
+		`UPDATE habits h
+			SET counts_since = ((now() AT TIME ZONE u.timezone) - make_interval(hours => u.day_start))::date
+			FROM users u
+			WHERE u.user_id = h.user_id AND h.counts_since IS NULL`,
+		`ALTER TABLE habits ALTER COLUMN counts_since DROP DEFAULT`,
+		`ALTER TABLE habits ALTER COLUMN counts_since SET NOT NULL`,
+		`ALTER TABLE habits ADD COLUMN IF NOT EXISTS total_good_count INT DEFAULT 0 NOT NULL`,
+		`ALTER TABLE habits ADD COLUMN IF NOT EXISTS total_bad_count INT DEFAULT 0 NOT NULL`,
+		// Счетчики за все время не меньше текущих; выполняется только
+		// для привычек, созданных до появления total_*
+		`UPDATE habits
+			SET total_good_count = GREATEST(total_good_count, good_count),
+				total_bad_count = GREATEST(total_bad_count, bad_count)
+			WHERE total_good_count < good_count OR total_bad_count < bad_count`,
+		`ALTER TABLE habits ADD COLUMN IF NOT EXISTS value DOUBLE PRECISION DEFAULT 0 NOT NULL`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS recurrence VARCHAR(255) DEFAULT '' NOT NULL`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS priority INT DEFAULT 0 NOT NULL CHECK (priority BETWEEN 0 AND 3)`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS start_date DATE`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deadline_time TIME`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deadline_timezone VARCHAR(64) DEFAULT '' NOT NULL`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS estimated_minutes INT DEFAULT 0 NOT NULL`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE`,
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS allow_incomplete_subtasks BOOLEAN DEFAULT FALSE NOT NULL`,
+		// count_reset_after (сброс через n дней) заменил count_reset;
+		// перед удалением колонки ее значения переносятся в ближайший период
+		`DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_name = 'habits' AND column_name = 'count_reset_after') THEN
+				UPDATE habits
+				SET count_reset = CASE
+						WHEN count_reset_after = 1 THEN 'daily'
+						WHEN count_reset_after = 7 THEN 'weekly'
+						WHEN count_reset_after BETWEEN 28 AND 31 THEN 'monthly'
+						ELSE count_reset
+					END
+				WHERE count_reset = 'never' AND count_reset_after > 0;
+			END IF;
+		END $$`,
+		`ALTER TABLE habits DROP COLUMN IF EXISTS count_reset_after`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+			ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`,
+		`CREATE INDEX IF NOT EXISTS idx_event_log_user ON event_log (user_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_messages_channel ON chat_messages (channel, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_challenge_links_member ON challenge_links (challenge_id, user_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_quests_active ON quests (party_id) WHERE status = 'active'`,
+		`CREATE INDEX IF NOT EXISTS idx_reward_purchases_user ON reward_purchases (user_id, purchased_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_vacations_user ON vacations (user_id, end_date)`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks (parent_id) WHERE parent_id IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_task_dependencies_blocked_by ON task_dependencies (blocked_by)`,
+	}
+	for i, migration := range migrations {
+		_, err = pool.Exec(context.Background(), migration)
+		if err != nil {
+			return nil, fmt.Errorf("unable to apply migration %d: %v", i, err)
+		}
+	}
+
 	return pool, nil
 }
@@ -0,0 +1,270 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier - общее у пула и транзакции, чтобы читать и внутри, и вне транзакций
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func GetInventory(userID int, conn *pgxpool.Pool) ([]models.InventoryItem, error) {
+	items := []models.InventoryItem{}
+	rows, err := conn.Query(context.Background(),
+		`SELECT item, quantity
+		FROM inventory
+		WHERE user_id = $1 AND quantity > 0
+		ORDER BY item`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.InventoryItem
+		if err := rows.Scan(&item.Item, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetEquipment возвращает надетые предметы по слотам
+func GetEquipment(userID int, conn *pgxpool.Pool) (map[string]string, error) {
+	return equipment(context.Background(), conn, userID)
+}
+
+func equipment(ctx context.Context, q querier, userID int) (map[string]string, error) {
+	rows, err := q.Query(ctx,
+		`SELECT slot, item
+		FROM equipment
+		WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get equipment: %w", err)
+	}
+	defer rows.Close()
+
+	equipped := map[string]string{}
+	for rows.Next() {
+		var slot, item string
+		if err := rows.Scan(&slot, &item); err != nil {
+			return nil, fmt.Errorf("failed to scan equipment: %w", err)
+		}
+		equipped[slot] = item
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return equipped, nil
+}
+
+func GetEquipmentBonuses(userID int, conn *pgxpool.Pool) (game.Bonuses, error) {
+	return equipmentBonuses(context.Background(), conn, userID)
+}
+
+func equipmentBonuses(ctx context.Context, q querier, userID int) (game.Bonuses, error) {
+	equipped, err := equipment(ctx, q, userID)
+	if err != nil {
+		return game.Bonuses{}, err
+	}
+	keys := make([]string, 0, len(equipped))
+	for _, key := range equipped {
+		keys = append(keys, key)
+	}
+	return game.EquipmentBonuses(keys), nil
+}
+
+// BuyItem покупает предметы за золото. Снаряжение можно иметь только
+// в одном экземпляре.
+func BuyItem(userID int, item game.Item, quantity int, conn *pgxpool.Pool) (*models.Stats, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stats, err := lockStats(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Gear() {
+		var owned int
+		err := tx.QueryRow(ctx,
+			`SELECT quantity
+			FROM inventory
+			WHERE user_id = $1 AND item = $2`,
+			userID,
+			item.Key,
+		).Scan(&owned)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to check inventory: %w", err)
+		}
+		if owned+quantity > 1 {
+			return nil, fmt.Errorf("item already owned")
+		}
+	}
+
+	cost := item.Price * quantity
+	if stats.Gold < cost {
+		return nil, fmt.Errorf("not enough gold")
+	}
+	stats.Gold -= cost
+	if err := saveStats(ctx, tx, stats); err != nil {
+		return nil, err
+	}
+
+	if err := addInventory(ctx, tx, userID, item.Key, quantity); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &stats, nil
+}
+
+// Equip надевает предмет из инвентаря, заменяя надетый в том же слоте
+func Equip(userID int, item game.Item, conn *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var owned bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM inventory WHERE user_id = $1 AND item = $2 AND quantity > 0)`,
+		userID,
+		item.Key,
+	).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("failed to check inventory: %w", err)
+	}
+	if !owned {
+		return fmt.Errorf("item not in inventory")
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO equipment (user_id, slot, item)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, slot) DO UPDATE
+		SET item = EXCLUDED.item`,
+		userID,
+		item.Type,
+		item.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to equip item: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func Unequip(userID int, slot string, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`DELETE FROM equipment
+		WHERE user_id = $1 AND slot = $2`,
+		userID,
+		slot,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to unequip item: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("slot is empty")
+	}
+	return nil
+}
+
+// UseItem расходует зелье из инвентаря и применяет его к статам
+func UseItem(userID int, item game.Item, conn *pgxpool.Pool) (*models.Stats, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Статы блокируются первыми, как при покупке: иначе встречные покупка
+	// и использование ждут друг друга
+	stats, err := lockStats(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := takeInventory(ctx, tx, userID, item.Key); err != nil {
+		return nil, err
+	}
+	stats = game.UsePotion(stats, item)
+	if err := saveStats(ctx, tx, stats); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &stats, nil
+}
+
+func addInventory(ctx context.Context, tx pgx.Tx, userID int, item string, quantity int) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO inventory (user_id, item, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, item) DO UPDATE
+		SET quantity = inventory.quantity + EXCLUDED.quantity`,
+		userID,
+		item,
+		quantity,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add item: %w", err)
+	}
+	return nil
+}
+
+// takeInventory списывает один предмет из инвентаря
+func takeInventory(ctx context.Context, tx pgx.Tx, userID int, item string) error {
+	tag, err := tx.Exec(ctx,
+		`UPDATE inventory
+		SET quantity = quantity - 1
+		WHERE user_id = $1 AND item = $2 AND quantity > 0`,
+		userID,
+		item,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to take item: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("item not in inventory")
+	}
+	return nil
+}
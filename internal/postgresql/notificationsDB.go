@@ -0,0 +1,303 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func GetNotificationSettings(userID int, conn *pgxpool.Pool) (*models.NotificationSettings, error) {
+	settings := models.NotificationSettings{
+		UserID:       userID,
+		EmailEnabled: true,
+		RemindAt:     models.DefaultRemindAt,
+		DeadlineDays: models.DefaultDeadlineDays,
+	}
+	err := conn.QueryRow(context.Background(),
+		`SELECT email_enabled, to_char(remind_at, 'HH24:MI'), deadline_days
+		FROM notification_settings
+		WHERE user_id = $1`,
+		userID,
+	).Scan(
+		&settings.EmailEnabled,
+		&settings.RemindAt,
+		&settings.DeadlineDays,
+	)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func SaveNotificationSettings(settings models.NotificationSettings, conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(),
+		`INSERT INTO notification_settings (user_id, email_enabled, remind_at, deadline_days)
+		VALUES ($1, $2, $3::time, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET email_enabled = EXCLUDED.email_enabled,
+			remind_at = EXCLUDED.remind_at,
+			deadline_days = EXCLUDED.deadline_days`,
+		settings.UserID,
+		settings.EmailEnabled,
+		settings.RemindAt,
+		settings.DeadlineDays,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save notification settings: %w", err)
+	}
+	return nil
+}
+
+// ClaimReminderRecipients отбирает пользователей, у которых по их часам
+// наступило время напоминания (remind_at) и которым сегодня еще не
+// напоминали, и отмечает для них сегодняшний день. Day у получателя -
+// его текущий день, как schedule.Clock.Today. Время сравнивается со
+// сдвигом на day_start: remind_at раньше начала дня (например 02:00 при
+// day_start 4) относится к концу текущего дня, а не к его началу.
+// Отметка атомарна, поэтому при нескольких экземплярах сервера
+// напоминание отправит один. Отключенная почта не исключает
+// пользователя: у него могут быть другие каналы.
+func ClaimReminderRecipients(now time.Time, conn *pgxpool.Pool) ([]models.ReminderRecipient, error) {
+	var recipients []models.ReminderRecipient
+	// Неизвестный пояс считается UTC, как в clockOrUTC
+	rows, err := conn.Query(context.Background(),
+		`WITH zones AS (
+			SELECT name FROM pg_timezone_names
+		), local AS (
+			SELECT u.user_id, u.email, u.timezone, u.day_start,
+				COALESCE(ns.email_enabled, TRUE) AS email_enabled,
+				COALESCE(ns.remind_at, $2::time) AS remind_at,
+				COALESCE(ns.deadline_days, $3) AS deadline_days,
+				$1::timestamptz AT TIME ZONE COALESCE(z.name, 'UTC') AS local_time
+			FROM users u
+			LEFT JOIN notification_settings ns ON ns.user_id = u.user_id
+			LEFT JOIN zones z ON z.name = u.timezone
+		), due AS (
+			SELECT l.*, (l.local_time - make_interval(hours => l.day_start))::date AS day
+			FROM local l
+			WHERE (l.local_time - make_interval(hours => l.day_start))::time
+				>= l.remind_at - make_interval(hours => l.day_start)
+		), claimed AS (
+			INSERT INTO reminder_runs (user_id, last_day)
+			SELECT d.user_id, d.day
+			FROM due d
+			LEFT JOIN reminder_runs r ON r.user_id = d.user_id
+			WHERE r.last_day IS NULL OR r.last_day < d.day
+			ON CONFLICT (user_id) DO UPDATE
+			SET last_day = EXCLUDED.last_day
+			WHERE reminder_runs.last_day < EXCLUDED.last_day
+			RETURNING user_id
+		)
+		SELECT d.user_id, d.email, d.email_enabled,
+			to_char(d.remind_at, 'HH24:MI'), d.deadline_days,
+			d.timezone, d.day_start, d.day
+		FROM due d
+		JOIN claimed c ON c.user_id = d.user_id`,
+		now,
+		models.DefaultRemindAt,
+		models.DefaultDeadlineDays,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim reminder recipients: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var recipient models.ReminderRecipient
+		err := rows.Scan(
+			&recipient.UserID,
+			&recipient.Email,
+			&recipient.EmailEnabled,
+			&recipient.RemindAt,
+			&recipient.DeadlineDays,
+			&recipient.Timezone,
+			&recipient.DayStart,
+			&recipient.Day,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reminder recipient: %w", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return recipients, nil
+}
+
+// ReleaseReminderRun снимает отметку дня, если напоминание не удалось,
+// чтобы следующая проверка его повторила
+func ReleaseReminderRun(userID int, day time.Time, conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(),
+		`UPDATE reminder_runs
+		SET last_day = $2::date - 1
+		WHERE user_id = $1 AND last_day = $2`,
+		userID,
+		day,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release reminder run: %w", err)
+	}
+	return nil
+}
+
+// ClaimReminders отмечает элементы как отправленные за день day и
+// возвращает только те, о которых в этот день еще не напоминали.
+// Отметка ставится до отправки, чтобы два экземпляра сервера не
+// отправили одно напоминание дважды.
+func ClaimReminders(userID int, day time.Time, items []models.ReminderItem, conn *pgxpool.Pool) ([]models.ReminderItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	kinds := make([]string, len(items))
+	ids := make([]int, len(items))
+	for i, item := range items {
+		kinds[i] = item.Kind
+		ids[i] = item.ID
+	}
+
+	rows, err := conn.Query(context.Background(),
+		`INSERT INTO reminders_sent (user_id, item_kind, item_id, day)
+		SELECT $1, kind, id, $2
+		FROM unnest($3::text[], $4::int[]) AS t(kind, id)
+		ON CONFLICT DO NOTHING
+		RETURNING item_kind, item_id`,
+		userID,
+		day,
+		kinds,
+		ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim reminders: %w", err)
+	}
+	defer rows.Close()
+
+	claimed := map[string]bool{}
+	for rows.Next() {
+		var kind string
+		var id int
+		if err := rows.Scan(&kind, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan reminder: %w", err)
+		}
+		claimed[fmt.Sprintf("%s:%d", kind, id)] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	var fresh []models.ReminderItem
+	for _, item := range items {
+		if claimed[fmt.Sprintf("%s:%d", item.Kind, item.ID)] {
+			fresh = append(fresh, item)
+		}
+	}
+	return fresh, nil
+}
+
+// ReleaseReminders снимает отметки, если отправить напоминание не удалось,
+// чтобы следующая попытка его повторила
+func ReleaseReminders(userID int, day time.Time, items []models.ReminderItem, conn *pgxpool.Pool) error {
+	kinds := make([]string, len(items))
+	ids := make([]int, len(items))
+	for i, item := range items {
+		kinds[i] = item.Kind
+		ids[i] = item.ID
+	}
+
+	_, err := conn.Exec(context.Background(),
+		`DELETE FROM reminders_sent
+		WHERE user_id = $1 AND day = $2
+			AND (item_kind, item_id) IN (
+				SELECT kind, id FROM unnest($3::text[], $4::int[]) AS t(kind, id))`,
+		userID,
+		day,
+		kinds,
+		ids,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release reminders: %w", err)
+	}
+	return nil
+}
+
+func AddNotificationChannel(channel models.NotificationChannel, conn *pgxpool.Pool) (int, error) {
+	var id int
+	err := conn.QueryRow(context.Background(),
+		`INSERT INTO notification_channels (user_id, kind, endpoint, p256dh, auth)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, kind, endpoint) DO UPDATE
+		SET p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth
+		RETURNING id`,
+		channel.UserID,
+		channel.Kind,
+		channel.Endpoint,
+		channel.Keys.P256dh,
+		channel.Keys.Auth,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert notification channel: %w", err)
+	}
+	return id, nil
+}
+
+func GetNotificationChannels(userID int, conn *pgxpool.Pool) ([]models.NotificationChannel, error) {
+	var channels []models.NotificationChannel
+	rows, err := conn.Query(context.Background(),
+		`SELECT id, user_id, kind, endpoint, p256dh, auth, created_at
+		FROM notification_channels
+		WHERE user_id = $1
+		ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification channels: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var channel models.NotificationChannel
+		err := rows.Scan(
+			&channel.ID,
+			&channel.UserID,
+			&channel.Kind,
+			&channel.Endpoint,
+			&channel.Keys.P256dh,
+			&channel.Keys.Auth,
+			&channel.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification channel: %w", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return channels, nil
+}
+
+func DeleteNotificationChannel(id int, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`DELETE FROM notification_channels
+		WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification channel: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("notification channel not found")
+	}
+	return nil
+}
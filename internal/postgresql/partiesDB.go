@@ -0,0 +1,474 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Пользователь может состоять только в одной группе (UNIQUE на
+// party_members.user_id). Владелец группы всегда ее участник.
+
+func CreateParty(party models.Party, conn *pgxpool.Pool) (*models.Party, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := ensureNoParty(ctx, tx, party.OwnerID); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO parties (name, owner_id)
+		VALUES ($1, $2)
+		RETURNING party_id, created_at`,
+		party.Name,
+		party.OwnerID,
+	).Scan(&party.ID, &party.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create party: %w", err)
+	}
+
+	if err := addPartyMember(ctx, tx, party.ID, party.OwnerID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &party, nil
+}
+
+func ensureNoParty(ctx context.Context, tx pgx.Tx, userID int) error {
+	var exists bool
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM party_members WHERE user_id = $1)`,
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check party membership: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("user already in a party")
+	}
+	return nil
+}
+
+// addPartyMember добавляет участника с флагами приватности из его настроек
+func addPartyMember(ctx context.Context, tx pgx.Tx, partyID int, userID int) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO party_members (party_id, user_id, share_stats, share_progress)
+		SELECT $1, $2,
+			COALESCE((s.data->'privacy'->>'share_stats')::boolean, TRUE),
+			COALESCE((s.data->'privacy'->>'share_progress')::boolean, TRUE)
+		FROM (SELECT 1) AS one
+		LEFT JOIN user_settings s ON s.user_id = $2`,
+		partyID,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add party member: %w", err)
+	}
+	return nil
+}
+
+// GetPartyByUser возвращает группу, в которой состоит пользователь
+func GetPartyByUser(userID int, conn *pgxpool.Pool) (*models.Party, error) {
+	var party models.Party
+	err := conn.QueryRow(context.Background(),
+		`SELECT p.party_id, p.name, p.owner_id, p.created_at
+		FROM parties p
+		JOIN party_members m ON m.party_id = p.party_id
+		WHERE m.user_id = $1`,
+		userID,
+	).Scan(
+		&party.ID,
+		&party.Name,
+		&party.OwnerID,
+		&party.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("party not found")
+		}
+		return nil, fmt.Errorf("failed to get party: %w", err)
+	}
+	return &party, nil
+}
+
+func GetPartyMembers(partyID int, conn *pgxpool.Pool) ([]models.PartyMember, error) {
+	var members []models.PartyMember
+	rows, err := conn.Query(context.Background(),
+		`SELECT m.party_id, m.user_id, u.username, m.share_stats, m.share_progress, m.joined_at
+		FROM party_members m
+		JOIN users u ON u.user_id = m.user_id
+		WHERE m.party_id = $1
+		ORDER BY m.joined_at, m.user_id`,
+		partyID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party members: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.PartyMember
+		err := rows.Scan(
+			&member.PartyID,
+			&member.UserID,
+			&member.Username,
+			&member.ShareStats,
+			&member.ShareProgress,
+			&member.JoinedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan party member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return members, nil
+}
+
+func IsPartyMember(partyID int, userID int, conn *pgxpool.Pool) (bool, error) {
+	var exists bool
+	err := conn.QueryRow(context.Background(),
+		`SELECT EXISTS(SELECT 1 FROM party_members WHERE party_id = $1 AND user_id = $2)`,
+		partyID,
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check party membership: %w", err)
+	}
+	return exists, nil
+}
+
+// InviteToParty - приглашать может только владелец группы
+func InviteToParty(inviterID int, userID int, conn *pgxpool.Pool) (*models.PartyInvite, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	invite := models.PartyInvite{UserID: userID, InviterID: inviterID}
+	var ownerID int
+	err = tx.QueryRow(ctx,
+		`SELECT p.party_id, p.name, p.owner_id
+		FROM parties p
+		JOIN party_members m ON m.party_id = p.party_id
+		WHERE m.user_id = $1`,
+		inviterID,
+	).Scan(&invite.PartyID, &invite.PartyName, &ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("party not found")
+		}
+		return nil, fmt.Errorf("failed to get party: %w", err)
+	}
+	if ownerID != inviterID {
+		return nil, fmt.Errorf("only the owner can invite")
+	}
+	if err := ensureNoParty(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO party_invites (party_id, user_id, inviter_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (party_id, user_id) DO UPDATE
+		SET inviter_id = EXCLUDED.inviter_id
+		RETURNING created_at`,
+		invite.PartyID,
+		invite.UserID,
+		invite.InviterID,
+	).Scan(&invite.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invite to party: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &invite, nil
+}
+
+func GetPartyInvites(userID int, conn *pgxpool.Pool) ([]models.PartyInvite, error) {
+	var invites []models.PartyInvite
+	rows, err := conn.Query(context.Background(),
+		`SELECT i.party_id, p.name, i.user_id, i.inviter_id, i.created_at
+		FROM party_invites i
+		JOIN parties p ON p.party_id = i.party_id
+		WHERE i.user_id = $1
+		ORDER BY i.created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party invites: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invite models.PartyInvite
+		err := rows.Scan(
+			&invite.PartyID,
+			&invite.PartyName,
+			&invite.UserID,
+			&invite.InviterID,
+			&invite.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan party invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return invites, nil
+}
+
+// AcceptPartyInvite вступает в группу. Остальные приглашения
+// пользователя удаляются - состоять можно только в одной группе.
+func AcceptPartyInvite(userID int, partyID int, conn *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := deletePartyInvite(ctx, tx, userID, partyID); err != nil {
+		return err
+	}
+	if err := ensureNoParty(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err := addPartyMember(ctx, tx, partyID, userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM party_invites
+		WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete party invites: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func DeclinePartyInvite(userID int, partyID int, conn *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := deletePartyInvite(ctx, tx, userID, partyID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func deletePartyInvite(ctx context.Context, tx pgx.Tx, userID int, partyID int) error {
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM party_invites
+		WHERE user_id = $1 AND party_id = $2`,
+		userID,
+		partyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete party invite: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("invite not found")
+	}
+	return nil
+}
+
+// LeaveParty выводит пользователя из группы и возвращает ее ID. Если ушел
+// владелец, группа переходит к самому давнему участнику; последний
+// вышедший удаляет группу.
+func LeaveParty(userID int, conn *pgxpool.Pool) (int, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var partyID, ownerID int
+	err = tx.QueryRow(ctx,
+		`SELECT p.party_id, p.owner_id
+		FROM parties p
+		JOIN party_members m ON m.party_id = p.party_id
+		WHERE m.user_id = $1
+		FOR UPDATE OF p`,
+		userID,
+	).Scan(&partyID, &ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("party not found")
+		}
+		return 0, fmt.Errorf("failed to get party: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM party_members
+		WHERE party_id = $1 AND user_id = $2`,
+		partyID,
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to leave party: %w", err)
+	}
+
+	if ownerID == userID {
+		var successorID int
+		err = tx.QueryRow(ctx,
+			`SELECT user_id
+			FROM party_members
+			WHERE party_id = $1
+			ORDER BY joined_at, user_id
+			LIMIT 1`,
+			partyID,
+		).Scan(&successorID)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			_, err = tx.Exec(ctx,
+				`DELETE FROM parties
+				WHERE party_id = $1`,
+				partyID,
+			)
+			if err != nil {
+				return 0, fmt.Errorf("failed to delete party: %w", err)
+			}
+		case err != nil:
+			return 0, fmt.Errorf("failed to find new owner: %w", err)
+		default:
+			if err := setPartyOwner(ctx, tx, partyID, successorID); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return partyID, nil
+}
+
+// TransferPartyOwnership передает группу другому участнику
+func TransferPartyOwnership(ownerID int, newOwnerID int, conn *pgxpool.Pool) (int, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var partyID, currentOwnerID int
+	err = tx.QueryRow(ctx,
+		`SELECT p.party_id, p.owner_id
+		FROM parties p
+		JOIN party_members m ON m.party_id = p.party_id
+		WHERE m.user_id = $1
+		FOR UPDATE OF p`,
+		ownerID,
+	).Scan(&partyID, &currentOwnerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("party not found")
+		}
+		return 0, fmt.Errorf("failed to get party: %w", err)
+	}
+	if currentOwnerID != ownerID {
+		return 0, fmt.Errorf("only the owner can transfer ownership")
+	}
+
+	var member bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM party_members WHERE party_id = $1 AND user_id = $2)`,
+		partyID,
+		newOwnerID,
+	).Scan(&member)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check party membership: %w", err)
+	}
+	if !member {
+		return 0, fmt.Errorf("user is not a party member")
+	}
+
+	if err := setPartyOwner(ctx, tx, partyID, newOwnerID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return partyID, nil
+}
+
+func setPartyOwner(ctx context.Context, tx pgx.Tx, partyID int, userID int) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE parties
+		SET owner_id = $1
+		WHERE party_id = $2`,
+		userID,
+		partyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set party owner: %w", err)
+	}
+	return nil
+}
+
+// SetPartyPrivacy - что участник показывает остальным в обзоре группы
+func SetPartyPrivacy(userID int, shareStats bool, shareProgress bool, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`UPDATE party_members
+		SET share_stats = $1, share_progress = $2
+		WHERE user_id = $3`,
+		shareStats,
+		shareProgress,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update party privacy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("party not found")
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Во всех транзакциях квестов сначала блокируется строка квеста, затем
+// статы участников по возрастанию user_id - так параллельные удары по
+// боссу и атаки босса не взаимоблокируются.
+
+// StartQuest - начать квест может только владелец группы
+func StartQuest(userID int, boss game.Boss, conn *pgxpool.Pool) (*models.Quest, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var partyID, ownerID int
+	err = tx.QueryRow(ctx,
+		`SELECT p.party_id, p.owner_id
+		FROM parties p
+		JOIN party_members m ON m.party_id = p.party_id
+		WHERE m.user_id = $1`,
+		userID,
+	).Scan(&partyID, &ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("party not found")
+		}
+		return nil, fmt.Errorf("failed to get party: %w", err)
+	}
+	if ownerID != userID {
+		return nil, fmt.Errorf("only the owner can start a quest")
+	}
+
+	quest := models.Quest{PartyID: partyID, Boss: boss.Key, HP: boss.HP, MaxHP: boss.HP, Status: models.QuestActive}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO quests (party_id, boss, hp, max_hp, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING quest_id, started_at`,
+		quest.PartyID,
+		quest.Boss,
+		quest.HP,
+		quest.MaxHP,
+		quest.Status,
+	).Scan(&quest.ID, &quest.StartedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("quest already active")
+		}
+		return nil, fmt.Errorf("failed to start quest: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &quest, nil
+}
+
+// GetQuest возвращает активный квест группы пользователя, а если его
+// нет - последний завершенный, вместе с вкладом участников
+func GetQuest(userID int, conn *pgxpool.Pool) (*models.Quest, error) {
+	var quest models.Quest
+	err := conn.QueryRow(context.Background(),
+		`SELECT q.quest_id, q.party_id, q.boss, q.hp, q.max_hp, q.status, q.started_at, q.finished_at
+		FROM quests q
+		JOIN party_members m ON m.party_id = q.party_id
+		WHERE m.user_id = $1
+		ORDER BY q.status = 'active' DESC, q.quest_id DESC
+		LIMIT 1`,
+		userID,
+	).Scan(
+		&quest.ID,
+		&quest.PartyID,
+		&quest.Boss,
+		&quest.HP,
+		&quest.MaxHP,
+		&quest.Status,
+		&quest.StartedAt,
+		&quest.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("quest not found")
+		}
+		return nil, fmt.Errorf("failed to get quest: %w", err)
+	}
+
+	rows, err := conn.Query(context.Background(),
+		`SELECT c.user_id, u.username, c.damage
+		FROM quest_contributions c
+		JOIN users u ON u.user_id = c.user_id
+		WHERE c.quest_id = $1
+		ORDER BY c.damage DESC, c.user_id`,
+		quest.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quest contributions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contribution models.QuestContribution
+		if err := rows.Scan(&contribution.UserID, &contribution.Username, &contribution.Damage); err != nil {
+			return nil, fmt.Errorf("failed to scan quest contribution: %w", err)
+		}
+		quest.Contributions = append(quest.Contributions, contribution)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return &quest, nil
+}
+
+func AbandonQuest(userID int, conn *pgxpool.Pool) (*models.Quest, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	quest, err := lockActiveQuest(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if quest == nil {
+		return nil, fmt.Errorf("quest not found")
+	}
+
+	var ownerID int
+	if err := tx.QueryRow(ctx, `SELECT owner_id FROM parties WHERE party_id = $1`, quest.PartyID).Scan(&ownerID); err != nil {
+		return nil, fmt.Errorf("failed to get party: %w", err)
+	}
+	if ownerID != userID {
+		return nil, fmt.Errorf("only the owner can abandon a quest")
+	}
+
+	if err := finishQuest(ctx, tx, quest, models.QuestAbandoned); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return quest, nil
+}
+
+// DamageBoss наносит урон боссу активного квеста группы пользователя.
+// Урон усиливается интеллектом снаряжения и класса. Если квеста нет,
+// возвращает nil. При победе все участники группы получают награду босса.
+func DamageBoss(userID int, damage int, conn *pgxpool.Pool) (*models.QuestHit, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	hit, err := damageBoss(ctx, tx, userID, damage)
+	if err != nil || hit == nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return hit, nil
+}
+
+func damageBoss(ctx context.Context, tx pgx.Tx, userID int, damage int) (*models.QuestHit, error) {
+	quest, err := lockActiveQuest(ctx, tx, userID)
+	if err != nil || quest == nil {
+		return nil, err
+	}
+	boss, ok := game.FindBoss(quest.Boss)
+	if !ok {
+		return nil, fmt.Errorf("unknown boss %q", quest.Boss)
+	}
+
+	bonuses, err := userBonuses(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	damage = min(bonuses.BossDamage(damage), quest.HP)
+	quest.HP -= damage
+	hit := &models.QuestHit{Damage: damage}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO quest_contributions (quest_id, user_id, damage)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (quest_id, user_id) DO UPDATE
+		SET damage = quest_contributions.damage + EXCLUDED.damage`,
+		quest.ID,
+		userID,
+		damage,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save quest contribution: %w", err)
+	}
+
+	if quest.HP > 0 {
+		_, err = tx.Exec(ctx,
+			`UPDATE quests
+			SET hp = $1
+			WHERE quest_id = $2`,
+			quest.HP,
+			quest.ID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update quest: %w", err)
+		}
+	} else {
+		hit.Defeated = true
+		if err := finishQuest(ctx, tx, quest, models.QuestWon); err != nil {
+			return nil, err
+		}
+
+		members, err := partyMemberIDs(ctx, tx, quest.PartyID)
+		if err != nil {
+			return nil, err
+		}
+		for _, memberID := range members {
+			stats, err := lockStats(ctx, tx, memberID)
+			if err != nil {
+				return nil, err
+			}
+			result := game.Gain(stats, boss.RewardXP, boss.RewardGold)
+			if err := saveStats(ctx, tx, result.Stats); err != nil {
+				return nil, err
+			}
+			hit.Rewards = append(hit.Rewards, result)
+		}
+	}
+
+	hit.Quest = *quest
+	return hit, nil
+}
+
+// BossAttack - босс активного квеста бьет всю группу пользователя за его
+// пропуски с суммарной сложностью missedDifficulty. Если квеста нет,
+// возвращает nil.
+func BossAttack(userID int, missedDifficulty int, conn *pgxpool.Pool) (*models.QuestHit, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	quest, err := lockActiveQuest(ctx, tx, userID)
+	if err != nil || quest == nil {
+		return nil, err
+	}
+	boss, ok := game.FindBoss(quest.Boss)
+	if !ok {
+		return nil, fmt.Errorf("unknown boss %q", quest.Boss)
+	}
+
+	hit := &models.QuestHit{Quest: *quest, Damage: game.BossAttack(boss, missedDifficulty)}
+
+	members, err := partyMemberIDs(ctx, tx, quest.PartyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, memberID := range members {
+		stats, err := lockStats(ctx, tx, memberID)
+		if err != nil {
+			return nil, err
+		}
+		bonuses, err := userBonuses(ctx, tx, memberID)
+		if err != nil {
+			return nil, err
+		}
+		result := game.Hurt(stats, bonuses.Damage(hit.Damage))
+		if err := saveStats(ctx, tx, result.Stats); err != nil {
+			return nil, err
+		}
+		hit.Hits = append(hit.Hits, result)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return hit, nil
+}
+
+// lockActiveQuest возвращает активный квест группы пользователя,
+// заблокировав его строку, или nil, если квеста нет
+func lockActiveQuest(ctx context.Context, tx pgx.Tx, userID int) (*models.Quest, error) {
+	var quest models.Quest
+	err := tx.QueryRow(ctx,
+		`SELECT q.quest_id, q.party_id, q.boss, q.hp, q.max_hp, q.status, q.started_at
+		FROM quests q
+		JOIN party_members m ON m.party_id = q.party_id
+		WHERE m.user_id = $1 AND q.status = 'active'
+		FOR UPDATE OF q`,
+		userID,
+	).Scan(
+		&quest.ID,
+		&quest.PartyID,
+		&quest.Boss,
+		&quest.HP,
+		&quest.MaxHP,
+		&quest.Status,
+		&quest.StartedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get quest: %w", err)
+	}
+	return &quest, nil
+}
+
+func finishQuest(ctx context.Context, tx pgx.Tx, quest *models.Quest, status string) error {
+	now := time.Now()
+	_, err := tx.Exec(ctx,
+		`UPDATE quests
+		SET hp = $1, status = $2, finished_at = $3
+		WHERE quest_id = $4`,
+		quest.HP,
+		status,
+		now,
+		quest.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish quest: %w", err)
+	}
+	quest.Status = status
+	quest.FinishedAt = &now
+	return nil
+}
+
+func partyMemberIDs(ctx context.Context, tx pgx.Tx, partyID int) ([]int, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT user_id
+		FROM party_members
+		WHERE party_id = $1
+		ORDER BY user_id`,
+		partyID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get party members: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan party member: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,207 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func AddReward(reward models.Reward, conn *pgxpool.Pool) (int, error) {
+	var id int
+	err := conn.QueryRow(context.Background(),
+		`INSERT INTO rewards (
+			user_id, text, note, cost)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		reward.UserID,
+		reward.Text,
+		reward.Note,
+		reward.Cost,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert reward: %w", err)
+	}
+	return id, nil
+}
+
+// EditReward возвращает владельца записи
+func EditReward(reward models.Reward, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
+		`UPDATE rewards
+		SET text = $1, note = $2, cost = $3
+		WHERE id = $4
+		RETURNING user_id`,
+		reward.Text,
+		reward.Note,
+		reward.Cost,
+		reward.ID,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("reward not found")
+		}
+		return 0, fmt.Errorf("failed to update reward: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteReward возвращает владельца удаленной записи
+func DeleteReward(id int, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
+		`DELETE FROM rewards
+		WHERE id = $1
+		RETURNING user_id`,
+		id,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("reward not found")
+		}
+		return 0, fmt.Errorf("failed to delete reward: %w", err)
+	}
+	return userID, nil
+}
+
+func GetRewards(userID int, conn *pgxpool.Pool) ([]models.Reward, error) {
+	var rewards []models.Reward
+	rows, err := conn.Query(context.Background(),
+		`SELECT id, user_id, text, note, cost
+		FROM rewards
+		WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rewards: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reward models.Reward
+		err := rows.Scan(
+			&reward.ID,
+			&reward.UserID,
+			&reward.Text,
+			&reward.Note,
+			&reward.Cost,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reward: %w", err)
+		}
+		rewards = append(rewards, reward)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return rewards, nil
+}
+
+// PurchaseReward списывает цену награды с золота владельца и записывает
+// покупку в историю. Строка статов блокируется, поэтому параллельные
+// покупки не уведут баланс в минус.
+func PurchaseReward(rewardID int, conn *pgxpool.Pool) (*models.RewardPurchase, *models.Stats, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var reward models.Reward
+	err = tx.QueryRow(ctx,
+		`SELECT id, user_id, text, cost
+		FROM rewards
+		WHERE id = $1`,
+		rewardID,
+	).Scan(
+		&reward.ID,
+		&reward.UserID,
+		&reward.Text,
+		&reward.Cost,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("reward not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get reward: %w", err)
+	}
+
+	stats, err := lockStats(ctx, tx, reward.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stats.Gold < reward.Cost {
+		return nil, nil, fmt.Errorf("not enough gold")
+	}
+	stats.Gold -= reward.Cost
+	if err := saveStats(ctx, tx, stats); err != nil {
+		return nil, nil, err
+	}
+
+	purchase := models.RewardPurchase{UserID: reward.UserID, RewardID: &reward.ID, Text: reward.Text, Cost: reward.Cost}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO reward_purchases (user_id, reward_id, text, cost)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, purchased_at`,
+		purchase.UserID,
+		purchase.RewardID,
+		purchase.Text,
+		purchase.Cost,
+	).Scan(&purchase.ID, &purchase.PurchasedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record purchase: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &purchase, &stats, nil
+}
+
+// GetRewardPurchases - история покупок, новые первыми
+func GetRewardPurchases(userID int, limit int, conn *pgxpool.Pool) ([]models.RewardPurchase, error) {
+	var purchases []models.RewardPurchase
+	rows, err := conn.Query(context.Background(),
+		`SELECT id, user_id, reward_id, text, cost, purchased_at
+		FROM reward_purchases
+		WHERE user_id = $1
+		ORDER BY purchased_at DESC, id DESC
+		LIMIT $2`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchases: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var purchase models.RewardPurchase
+		err := rows.Scan(
+			&purchase.ID,
+			&purchase.UserID,
+			&purchase.RewardID,
+			&purchase.Text,
+			&purchase.Cost,
+			&purchase.PurchasedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan purchase: %w", err)
+		}
+		purchases = append(purchases, purchase)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return purchases, nil
+}
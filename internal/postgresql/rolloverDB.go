@@ -0,0 +1,190 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ClaimRollovers отмечает смену дня для всех пользователей, у которых
+// наступил новый день: days - текущий день каждого пользователя по его
+// часам. Возвращает тех, для кого смена еще не проводилась, вместе с
+// днем прошлой смены (нулевое время - смен еще не было), чтобы после
+// простоя можно было подвести итоги всех пропущенных дней. Отметка
+// атомарна, поэтому при нескольких экземплярах сервера день обработает один.
+func ClaimRollovers(days map[int]time.Time, conn *pgxpool.Pool) (map[int]time.Time, error) {
+	ids := make([]int, 0, len(days))
+	dates := make([]time.Time, 0, len(days))
+	for userID, day := range days {
+		ids = append(ids, userID)
+		dates = append(dates, day)
+	}
+
+	// RETURNING видит только новую строку, прошлый день берется из
+	// снимка до вставки
+	rows, err := conn.Query(context.Background(),
+		`WITH previous AS (
+			SELECT user_id, last_day
+			FROM rollovers
+			WHERE user_id = ANY($1)
+		)
+		INSERT INTO rollovers (user_id, last_day)
+		SELECT d.user_id, d.day
+		FROM unnest($1::int[], $2::date[]) AS d(user_id, day)
+		JOIN users u ON u.user_id = d.user_id
+		ON CONFLICT (user_id) DO UPDATE
+		SET last_day = EXCLUDED.last_day
+		WHERE rollovers.last_day < EXCLUDED.last_day
+		RETURNING user_id, (
+			SELECT p.last_day
+			FROM previous p
+			WHERE p.user_id = rollovers.user_id)`,
+		ids,
+		dates,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim rollovers: %w", err)
+	}
+	defer rows.Close()
+
+	claimed := map[int]time.Time{}
+	for rows.Next() {
+		var id int
+		var lastDay *time.Time
+		if err := rows.Scan(&id, &lastDay); err != nil {
+			return nil, fmt.Errorf("failed to scan rollover: %w", err)
+		}
+		claimed[id] = time.Time{}
+		if lastDay != nil {
+			claimed[id] = *lastDay
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// MissDailies сбрасывает серии пропущенных ежедневных задач и наносит
+// пользователю урон за каждую. Если задачу успели выполнить уже сегодня,
+// серия начинается заново с 1. Заморозки из инвентаря спасают по одной
+// задаче, начиная с самых длинных серий; спасенные возвращаются в frozen.
+// Если спасены все, result - nil.
+func MissDailies(userID int, missed []models.Daily, today time.Time, conn *pgxpool.Pool) (frozen []models.Daily, result *models.ScoreResult, err error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Статы блокируются первыми, как в BuyItem и UseItem: иначе покупка
+	// заморозки во время смены дня ждет встречную блокировку
+	stats, err := lockStats(ctx, tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var freezes int
+	err = tx.QueryRow(ctx,
+		`SELECT quantity
+		FROM inventory
+		WHERE user_id = $1 AND item = $2
+		FOR UPDATE`,
+		userID,
+		game.StreakFreeze,
+	).Scan(&freezes)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, fmt.Errorf("failed to get streak freezes: %w", err)
+	}
+
+	missed = slices.Clone(missed)
+	sort.SliceStable(missed, func(i, j int) bool {
+		return missed[i].Streak > missed[j].Streak
+	})
+	used := min(freezes, len(missed))
+	frozen, missed = missed[:used], missed[used:]
+
+	if used > 0 {
+		_, err = tx.Exec(ctx,
+			`UPDATE inventory
+			SET quantity = quantity - $3
+			WHERE user_id = $1 AND item = $2`,
+			userID,
+			game.StreakFreeze,
+			used,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to use streak freezes: %w", err)
+		}
+	}
+
+	if len(missed) > 0 {
+		ids := make([]int, 0, len(missed))
+		damage := 0
+		for _, daily := range missed {
+			ids = append(ids, daily.ID)
+			damage += game.Damage(daily.Difficulty)
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE dailies
+			SET streak = CASE WHEN last_completed >= $3 THEN 1 ELSE 0 END
+			WHERE user_id = $1 AND id = ANY($2)`,
+			userID,
+			ids,
+			today,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to reset streaks: %w", err)
+		}
+
+		bonuses, err := userBonuses(ctx, tx, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hurt := game.Hurt(stats, bonuses.Damage(damage))
+		if err := saveStats(ctx, tx, hurt.Stats); err != nil {
+			return nil, nil, err
+		}
+		result = &hurt
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return frozen, result, nil
+}
+
+// IsRestDay - отдыхает ли пользователь в день day: в отпуске или под
+// защитой скрытности. В такой день пропуски не наказываются.
+func IsRestDay(userID int, day time.Time, conn *pgxpool.Pool) (bool, error) {
+	var rest bool
+	err := conn.QueryRow(context.Background(),
+		`SELECT EXISTS(
+			SELECT 1 FROM vacations
+			WHERE user_id = $1 AND $2 BETWEEN start_date AND end_date
+		) OR EXISTS(
+			SELECT 1 FROM streak_shields
+			WHERE user_id = $1 AND day = $2
+		)`,
+		userID,
+		day,
+	).Scan(&rest)
+	if err != nil {
+		return false, fmt.Errorf("failed to check rest day: %w", err)
+	}
+	return rest, nil
+}
@@ -0,0 +1,383 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"huibitica/internal/schedule"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func GetStats(userID int, conn *pgxpool.Pool) (*models.Stats, error) {
+	stats := game.NewStats(userID)
+	err := conn.QueryRow(context.Background(),
+		`SELECT level, xp, gold, hp, mana, class
+		FROM stats
+		WHERE user_id = $1`,
+		userID,
+	).Scan(
+		&stats.Level,
+		&stats.XP,
+		&stats.Gold,
+		&stats.HP,
+		&stats.Mana,
+		&stats.Class,
+	)
+	// Строка статов появляется при первом начислении, до этого - значения по умолчанию
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// lockStats возвращает статы пользователя, заблокировав строку до конца
+// транзакции. Если строки еще нет, она создается.
+func lockStats(ctx context.Context, tx pgx.Tx, userID int) (models.Stats, error) {
+	initial := game.NewStats(userID)
+	_, err := tx.Exec(ctx,
+		`INSERT INTO stats (user_id, level, xp, gold, hp, mana)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO NOTHING`,
+		initial.UserID,
+		initial.Level,
+		initial.XP,
+		initial.Gold,
+		initial.HP,
+		initial.Mana,
+	)
+	if err != nil {
+		return models.Stats{}, fmt.Errorf("failed to init stats: %w", err)
+	}
+
+	stats := models.Stats{UserID: userID}
+	err = tx.QueryRow(ctx,
+		`SELECT level, xp, gold, hp, mana, class
+		FROM stats
+		WHERE user_id = $1
+		FOR UPDATE`,
+		userID,
+	).Scan(
+		&stats.Level,
+		&stats.XP,
+		&stats.Gold,
+		&stats.HP,
+		&stats.Mana,
+		&stats.Class,
+	)
+	if err != nil {
+		return models.Stats{}, fmt.Errorf("failed to lock stats: %w", err)
+	}
+	return stats, nil
+}
+
+func saveStats(ctx context.Context, tx pgx.Tx, stats models.Stats) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE stats
+		SET level = $1, xp = $2, gold = $3, hp = $4, mana = $5, class = $6
+		WHERE user_id = $7`,
+		stats.Level,
+		stats.XP,
+		stats.Gold,
+		stats.HP,
+		stats.Mana,
+		stats.Class,
+		stats.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update stats: %w", err)
+	}
+	return nil
+}
+
+// ScoreHabit отмечает "+" (up) или "-" у привычки в момент now, сдвигает
+// ее силу и начисляет награду или урон с множителем от силы. Направление
+// должно быть разрешено флагами Good/Bad. Если по часам владельца начался
+// новый период, счетчики сначала уходят в историю.
+func ScoreHabit(habitID int, up bool, now time.Time, conn *pgxpool.Pool) (*models.Habit, *models.ScoreResult, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var ownerID int
+	err = tx.QueryRow(ctx, `SELECT user_id FROM habits WHERE id = $1`, habitID).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("habit not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get habit: %w", err)
+	}
+	clock, err := userClock(ctx, tx, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := resetHabitCounts(ctx, tx, ownerID, clock.Today(now)); err != nil {
+		return nil, nil, err
+	}
+
+	var value float64
+	err = tx.QueryRow(ctx,
+		`SELECT value
+		FROM habits
+		WHERE id = $1
+		FOR UPDATE`,
+		habitID,
+	).Scan(&value)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("habit not found")
+		}
+		return nil, nil, fmt.Errorf("failed to lock habit: %w", err)
+	}
+	value, multiplier := game.ScoreHabitValue(value, up)
+
+	var habit models.Habit
+	err = tx.QueryRow(ctx,
+		`UPDATE habits
+		SET good_count = good_count + CASE WHEN $2 THEN 1 ELSE 0 END,
+			bad_count = bad_count + CASE WHEN $2 THEN 0 ELSE 1 END,
+			total_good_count = total_good_count + CASE WHEN $2 THEN 1 ELSE 0 END,
+			total_bad_count = total_bad_count + CASE WHEN $2 THEN 0 ELSE 1 END,
+			value = $3
+		WHERE id = $1
+		RETURNING id, user_id, text, note, good, bad,
+			difficulty, count_reset, good_count, bad_count,
+			counts_since, total_good_count, total_bad_count, value`,
+		habitID,
+		up,
+		value,
+	).Scan(
+		&habit.ID,
+		&habit.UserID,
+		&habit.Text,
+		&habit.Note,
+		&habit.Good,
+		&habit.Bad,
+		&habit.Difficulty,
+		&habit.CountReset,
+		&habit.GoodCount,
+		&habit.BadCount,
+		&habit.CountsSince,
+		&habit.TotalGoodCount,
+		&habit.TotalBadCount,
+		&habit.Value,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to score habit: %w", err)
+	}
+	habit.Strength = game.HabitStrength(habit.Value)
+	if (up && !habit.Good) || (!up && !habit.Bad) {
+		return nil, nil, fmt.Errorf("direction not allowed")
+	}
+
+	stats, err := lockStats(ctx, tx, habit.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bonuses, err := userBonuses(ctx, tx, habit.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := game.ScoreScaled(stats, bonuses, habit.Difficulty, up, multiplier)
+	if err := saveStats(ctx, tx, result.Stats); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &habit, &result, nil
+}
+
+// CompleteDaily отмечает ежедневную задачу выполненной в момент now - на
+// текущий день по часам ее владельца. Повторное выполнение в тот же день
+// возвращает ошибку.
+func CompleteDaily(dailyID int, now time.Time, conn *pgxpool.Pool) (*models.Daily, *models.ScoreResult, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var ownerID int
+	err = tx.QueryRow(ctx, `SELECT user_id FROM dailies WHERE id = $1`, dailyID).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("daily not found")
+		}
+		return nil, nil, fmt.Errorf("failed to get daily: %w", err)
+	}
+	clock, err := userClock(ctx, tx, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	today := clock.Today(now)
+
+	var daily models.Daily
+	err = tx.QueryRow(ctx,
+		`UPDATE dailies
+		SET streak = streak + 1, last_completed = $2
+		WHERE id = $1 AND (last_completed IS NULL OR last_completed < $2)
+		RETURNING id, user_id, text, note, difficulty,
+			start_date, repeat_every, repeat_every_x,
+			dayweeks, streak, last_completed`,
+		dailyID,
+		today,
+	).Scan(
+		&daily.ID,
+		&daily.UserID,
+		&daily.Text,
+		&daily.Note,
+		&daily.Difficulty,
+		&daily.StartDate,
+		&daily.RepeatEvery,
+		&daily.RepeatEveryX,
+		&daily.DayWeeks,
+		&daily.Streak,
+		&daily.LastCompleted,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			var exists bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM dailies WHERE id = $1)`, dailyID).Scan(&exists); err != nil {
+				return nil, nil, fmt.Errorf("failed to check daily: %w", err)
+			}
+			if exists {
+				return nil, nil, fmt.Errorf("daily already completed")
+			}
+			return nil, nil, fmt.Errorf("daily not found")
+		}
+		return nil, nil, fmt.Errorf("failed to complete daily: %w", err)
+	}
+
+	stats, err := lockStats(ctx, tx, daily.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bonuses, err := userBonuses(ctx, tx, daily.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := game.Score(stats, bonuses, daily.Difficulty, true)
+	if err := saveStats(ctx, tx, result.Stats); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &daily, &result, nil
+}
+
+// CompleteTask отмечает задачу выполненной. Заблокированную задачу и
+// родителя с невыполненными подзадачами выполнить нельзя (см.
+// checkTaskCompletable). Для повторяющейся задачи заодно создается
+// следующий экземпляр (next), иначе next - nil.
+func CompleteTask(taskID int, conn *pgxpool.Pool) (*models.Task, *models.Task, *models.ScoreResult, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	task := &models.Task{}
+	err = scanTask(tx.QueryRow(ctx,
+		`UPDATE tasks
+		SET completed = TRUE, completed_at = $2
+		WHERE id = $1 AND NOT completed
+		RETURNING `+taskColumns,
+		taskID,
+		time.Now().UTC(),
+	), task)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			var exists bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)`, taskID).Scan(&exists); err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to check task: %w", err)
+			}
+			if exists {
+				return nil, nil, nil, fmt.Errorf("task already completed")
+			}
+			return nil, nil, nil, fmt.Errorf("task not found")
+		}
+		return nil, nil, nil, fmt.Errorf("failed to complete task: %w", err)
+	}
+	if err := checkTaskCompletable(ctx, tx, *task); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var next *models.Task
+	if task.Recurrence != "" {
+		next, err = nextTask(ctx, tx, *task)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	stats, err := lockStats(ctx, tx, task.UserID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	bonuses, err := userBonuses(ctx, tx, task.UserID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	result := game.Score(stats, bonuses, task.Difficulty, true)
+	if err := saveStats(ctx, tx, result.Stats); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return task, next, &result, nil
+}
+
+// nextTask создает следующий экземпляр повторяющейся задачи, если
+// повторы не закончились. Правило проверяется при сохранении; если оно
+// все же не разбирается, задача просто перестает повторяться.
+func nextTask(ctx context.Context, tx pgx.Tx, task models.Task) (*models.Task, error) {
+	rule, err := models.ParseRecurrence(task.Recurrence)
+	if err != nil {
+		return nil, nil
+	}
+	deadline, rest, ok := schedule.NextDeadline(rule, task.Deadline)
+	if !ok {
+		return nil, nil
+	}
+
+	// Следующий экземпляр - та же задача, сдвинутая на новый срок вместе
+	// с датой начала
+	next := task
+	next.Completed = false
+	next.CompletedAt = nil
+	next.Recurrence = rest.String()
+	if task.StartDate != nil {
+		start := task.StartDate.AddDate(0, 0, int(deadline.Sub(schedule.Day(task.Deadline)).Hours()/24))
+		next.StartDate = &start
+	}
+	next.Deadline = deadline
+	next.ID, err = insertTask(ctx, tx, next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create next task: %w", err)
+	}
+	return &next, nil
+}
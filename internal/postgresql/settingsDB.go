@@ -0,0 +1,226 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+	"huibitica/internal/schedule"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// settingsMigrations[v] переводит сохраненные настройки версии v в v+1.
+// Новые поля миграций не требуют - недостающие ключи берутся из
+// models.DefaultSettings. Миграция нужна, только если поле переименовали
+// или поменяли его формат.
+var settingsMigrations = map[int]func(data map[string]any){}
+
+// GetSettings собирает настройки пользователя: значения по умолчанию,
+// поверх них сохраненный JSONB, поверх него часы и уведомления из их
+// таблиц.
+func GetSettings(userID int, conn *pgxpool.Pool) (*models.Settings, error) {
+	return readSettings(context.Background(), conn, userID, "")
+}
+
+// PatchSettings читает настройки, применяет к ним apply и сохраняет
+// результат в одной транзакции. Строки пользователя блокируются на время
+// правки, поэтому параллельные правки разных полей не затирают друг
+// друга. Ошибка apply возвращается как есть.
+func PatchSettings(userID int, apply func(settings *models.Settings) error, conn *pgxpool.Pool) (*models.Settings, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	settings, err := readSettings(ctx, tx, userID, "FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(settings); err != nil {
+		return nil, err
+	}
+	settings.Version = models.SettingsVersion
+	if err := saveSettings(ctx, tx, userID, *settings); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return settings, nil
+}
+
+// readSettings - см. GetSettings. lock ("" или "FOR UPDATE") добавляется
+// ко всем чтениям; первой читается строка users, она же задает порядок
+// блокировок.
+func readSettings(ctx context.Context, q querier, userID int, lock string) (*models.Settings, error) {
+	settings := models.DefaultSettings()
+
+	var timezone string
+	var dayStart int
+	err := q.QueryRow(ctx,
+		`SELECT timezone, day_start
+		FROM users
+		WHERE user_id = $1 `+lock,
+		userID,
+	).Scan(&timezone, &dayStart)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get timezone: %w", err)
+	}
+
+	var version int
+	var data map[string]any
+	err = q.QueryRow(ctx,
+		`SELECT version, data
+		FROM user_settings
+		WHERE user_id = $1 `+lock,
+		userID,
+	).Scan(&version, &data)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	if err == nil {
+		if err := migrateSettings(data, version); err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode settings: %w", err)
+		}
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, fmt.Errorf("failed to decode settings: %w", err)
+		}
+		settings.Version = models.SettingsVersion
+	}
+	settings.Timezone = timezone
+	settings.DayStart = dayStart
+
+	settings.Notifications = models.NotificationPreferences{
+		EmailEnabled: true,
+		RemindAt:     models.DefaultRemindAt,
+		DeadlineDays: models.DefaultDeadlineDays,
+	}
+	err = q.QueryRow(ctx,
+		`SELECT email_enabled, to_char(remind_at, 'HH24:MI'), deadline_days
+		FROM notification_settings
+		WHERE user_id = $1 `+lock,
+		userID,
+	).Scan(
+		&settings.Notifications.EmailEnabled,
+		&settings.Notifications.RemindAt,
+		&settings.Notifications.DeadlineDays,
+	)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+func migrateSettings(data map[string]any, version int) error {
+	if version > models.SettingsVersion {
+		return fmt.Errorf("settings version %d is newer than supported %d", version, models.SettingsVersion)
+	}
+	for ; version < models.SettingsVersion; version++ {
+		if migrate, ok := settingsMigrations[version]; ok {
+			migrate(data)
+		}
+	}
+	return nil
+}
+
+// saveSettings сохраняет настройки целиком: JSONB, часы и уведомления в
+// их таблицы, приватность - и в членство в группе
+func saveSettings(ctx context.Context, tx pgx.Tx, userID int, settings models.Settings) error {
+	tag, err := tx.Exec(ctx,
+		`UPDATE users
+		SET timezone = $1, day_start = $2
+		WHERE user_id = $3`,
+		settings.Timezone,
+		settings.DayStart,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update timezone: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO user_settings (user_id, version, data, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE
+		SET version = EXCLUDED.version,
+			data = EXCLUDED.data,
+			updated_at = EXCLUDED.updated_at`,
+		userID,
+		settings.Version,
+		settings,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO notification_settings (user_id, email_enabled, remind_at, deadline_days)
+		VALUES ($1, $2, $3::time, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET email_enabled = EXCLUDED.email_enabled,
+			remind_at = EXCLUDED.remind_at,
+			deadline_days = EXCLUDED.deadline_days`,
+		userID,
+		settings.Notifications.EmailEnabled,
+		settings.Notifications.RemindAt,
+		settings.Notifications.DeadlineDays,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save notification settings: %w", err)
+	}
+
+	// При вступлении в группу приватность копируется в party_members
+	// (addPartyMember), поэтому текущему членству ее нужно обновить
+	_, err = tx.Exec(ctx,
+		`UPDATE party_members
+		SET share_stats = $1, share_progress = $2
+		WHERE user_id = $3`,
+		settings.Privacy.ShareStats,
+		settings.Privacy.ShareProgress,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update party privacy: %w", err)
+	}
+	return nil
+}
+
+// userWeekStart - первый день недели из настроек пользователя
+func userWeekStart(ctx context.Context, q querier, userID int) (time.Weekday, error) {
+	var name *string
+	err := q.QueryRow(ctx,
+		`SELECT data->>'week_start'
+		FROM user_settings
+		WHERE user_id = $1`,
+		userID,
+	).Scan(&name)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return time.Sunday, fmt.Errorf("failed to get week start: %w", err)
+	}
+	if name != nil {
+		if day, ok := schedule.ParseWeekDay(*name); ok {
+			return day, nil
+		}
+	}
+	day, _ := schedule.ParseWeekDay(models.DefaultSettings().WeekStart)
+	return day, nil
+}
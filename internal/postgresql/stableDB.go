@@ -0,0 +1,256 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/game"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RollDrop бросает кубик выпадения за действие пользователя. Зерно берется
+// из номера броска за день, поэтому исход детерминирован. Возвращает nil,
+// если ничего не выпало или дневной лимит исчерпан.
+func RollDrop(userID int, difficulty int, day time.Time, conn *pgxpool.Pool) (*game.Drop, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Вставка с возвратом счетчиков заодно блокирует строку дня
+	var rolls, drops int
+	err = tx.QueryRow(ctx,
+		`INSERT INTO drop_counts (user_id, day)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, day) DO UPDATE
+		SET rolls = drop_counts.rolls
+		RETURNING rolls, drops`,
+		userID,
+		day,
+	).Scan(&rolls, &drops)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get drop counts: %w", err)
+	}
+	if drops >= game.DropDailyCap {
+		return nil, nil
+	}
+
+	drop, ok := game.DailyDrop(userID, day, rolls, drops, difficulty)
+	if ok {
+		drops++
+		if err := addInventory(ctx, tx, userID, drop.InventoryKey(), 1); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE drop_counts
+		SET rolls = $3, drops = $4
+		WHERE user_id = $1 AND day = $2`,
+		userID,
+		day,
+		rolls+1,
+		drops,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update drop counts: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &drop, nil
+}
+
+func GetPets(userID int, conn *pgxpool.Pool) ([]models.Pet, error) {
+	pets := []models.Pet{}
+	rows, err := conn.Query(context.Background(),
+		`SELECT pet, fullness, hatched_at
+		FROM pets
+		WHERE user_id = $1
+		ORDER BY hatched_at, pet`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pet models.Pet
+		if err := rows.Scan(&pet.Pet, &pet.Fullness, &pet.HatchedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pet: %w", err)
+		}
+		pets = append(pets, pet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return pets, nil
+}
+
+func GetMounts(userID int, conn *pgxpool.Pool) ([]models.Mount, error) {
+	mounts := []models.Mount{}
+	rows, err := conn.Query(context.Background(),
+		`SELECT mount, obtained_at
+		FROM mounts
+		WHERE user_id = $1
+		ORDER BY obtained_at, mount`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mounts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mount models.Mount
+		if err := rows.Scan(&mount.Mount, &mount.ObtainedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mount: %w", err)
+		}
+		mounts = append(mounts, mount)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return mounts, nil
+}
+
+// HatchPet выводит питомца, расходуя яйцо и инкубационный эликсир
+func HatchPet(userID int, egg string, potion string, conn *pgxpool.Pool) (*models.Pet, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	eggDrop := game.Drop{Kind: game.DropEgg, Key: egg}
+	if err := takeInventory(ctx, tx, userID, eggDrop.InventoryKey()); err != nil {
+		return nil, err
+	}
+	potionDrop := game.Drop{Kind: game.DropHatchingPotion, Key: potion}
+	if err := takeInventory(ctx, tx, userID, potionDrop.InventoryKey()); err != nil {
+		return nil, err
+	}
+
+	pet := models.Pet{Pet: game.PetKey(egg, potion)}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO pets (user_id, pet)
+		VALUES ($1, $2)
+		RETURNING fullness, hatched_at`,
+		userID,
+		pet.Pet,
+	).Scan(&pet.Fullness, &pet.HatchedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("pet already hatched")
+		}
+		return nil, fmt.Errorf("failed to hatch pet: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &pet, nil
+}
+
+// FeedPet кормит питомца. Насытившийся питомец уходит из стойла питомцев
+// и становится ездовым; тогда возвращается mount.
+func FeedPet(userID int, pet string, food string, conn *pgxpool.Pool) (*models.Pet, *models.Mount, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	fed := models.Pet{Pet: pet}
+	err = tx.QueryRow(ctx,
+		`UPDATE pets
+		SET fullness = fullness + $3
+		WHERE user_id = $1 AND pet = $2
+		RETURNING fullness, hatched_at`,
+		userID,
+		pet,
+		game.FeedPoints,
+	).Scan(&fed.Fullness, &fed.HatchedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("pet not found")
+		}
+		return nil, nil, fmt.Errorf("failed to feed pet: %w", err)
+	}
+
+	foodDrop := game.Drop{Kind: game.DropFood, Key: food}
+	if err := takeInventory(ctx, tx, userID, foodDrop.InventoryKey()); err != nil {
+		return nil, nil, err
+	}
+
+	var mount *models.Mount
+	if fed.Fullness >= game.MountFullness {
+		mount = &models.Mount{Mount: pet}
+		err = tx.QueryRow(ctx,
+			`INSERT INTO mounts (user_id, mount)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, mount) DO UPDATE
+			SET mount = EXCLUDED.mount
+			RETURNING obtained_at`,
+			userID,
+			pet,
+		).Scan(&mount.ObtainedAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to add mount: %w", err)
+		}
+
+		_, err = tx.Exec(ctx,
+			`DELETE FROM pets
+			WHERE user_id = $1 AND pet = $2`,
+			userID,
+			pet,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to remove pet: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &fed, mount, nil
+}
+
+// ReleasePet отпускает питомца
+func ReleasePet(userID int, pet string, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`DELETE FROM pets
+		WHERE user_id = $1 AND pet = $2`,
+		userID,
+		pet,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release pet: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("pet not found")
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockTaskGraph сериализует изменения родителей и зависимостей задач
+// одного пользователя. Без этого два встречных изменения (A под B и B
+// под A) по отдельности проходят проверку на цикл, а вместе образуют его.
+func lockTaskGraph(ctx context.Context, tx pgx.Tx, userID int) error {
+	var id int
+	err := tx.QueryRow(ctx,
+		`SELECT user_id
+		FROM users
+		WHERE user_id = $1
+		FOR NO KEY UPDATE`,
+		userID,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("failed to lock tasks: %w", err)
+	}
+	return nil
+}
+
+// checkTaskParent проверяет, что parentID - задача того же пользователя и
+// не лежит в поддереве taskID (taskID = 0 - задача еще не создана)
+func checkTaskParent(ctx context.Context, q querier, userID int, taskID int, parentID int) error {
+	var exists bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)`,
+		parentID,
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check parent task: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("parent task not found")
+	}
+	if taskID == 0 {
+		return nil
+	}
+
+	// Цикл появится, если задача - один из предков нового родителя
+	var cycle bool
+	err = q.QueryRow(ctx,
+		`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM tasks WHERE id = $1
+			UNION
+			SELECT t.id, t.parent_id
+			FROM tasks t
+			JOIN ancestors a ON t.id = a.parent_id
+		)
+		SELECT EXISTS(SELECT 1 FROM ancestors WHERE id = $2)`,
+		parentID,
+		taskID,
+	).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("failed to check parent task: %w", err)
+	}
+	if cycle {
+		return fmt.Errorf("task cannot be moved under its own subtask")
+	}
+	return nil
+}
+
+// checkTaskCompletable проверяет, можно ли выполнить задачу: ни у нее, ни
+// у ее родителей нет невыполненных блокирующих задач, а все подзадачи на
+// любой глубине выполнены (если родитель это требует)
+func checkTaskCompletable(ctx context.Context, tx pgx.Tx, task models.Task) error {
+	var blocked bool
+	err := tx.QueryRow(ctx,
+		`WITH RECURSIVE lineage AS (
+			SELECT id, parent_id FROM tasks WHERE id = $1
+			UNION
+			SELECT t.id, t.parent_id
+			FROM tasks t
+			JOIN lineage l ON t.id = l.parent_id
+		)
+		SELECT EXISTS(
+			SELECT 1
+			FROM lineage l
+			JOIN task_dependencies d ON d.task_id = l.id
+			JOIN tasks b ON b.id = d.blocked_by
+			WHERE NOT b.completed)`,
+		task.ID,
+	).Scan(&blocked)
+	if err != nil {
+		return fmt.Errorf("failed to check task dependencies: %w", err)
+	}
+	if blocked {
+		return fmt.Errorf("task is blocked")
+	}
+	if task.AllowIncompleteSubtasks {
+		return nil
+	}
+
+	var incomplete bool
+	err = tx.QueryRow(ctx,
+		`WITH RECURSIVE subtree AS (
+			SELECT id, completed FROM tasks WHERE parent_id = $1
+			UNION
+			SELECT t.id, t.completed
+			FROM tasks t
+			JOIN subtree s ON t.parent_id = s.id
+		)
+		SELECT EXISTS(SELECT 1 FROM subtree WHERE NOT completed)`,
+		task.ID,
+	).Scan(&incomplete)
+	if err != nil {
+		return fmt.Errorf("failed to check subtasks: %w", err)
+	}
+	if incomplete {
+		return fmt.Errorf("task has incomplete subtasks")
+	}
+	return nil
+}
+
+// checkTaskDependency проверяет, что блокирующая задача принадлежит тому
+// же пользователю и новая зависимость не замыкает цикл ожидания
+func checkTaskDependency(ctx context.Context, q querier, userID int, dep models.TaskDependency) error {
+	var exists bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)`,
+		dep.BlockedBy,
+		userID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to get blocking task: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("blocking task not found")
+	}
+	return checkTaskGraph(ctx, q, userID, taskGraphChange{Dependency: dep})
+}
+
+// taskGraphChange - проверяемое изменение графа задач: новый родитель и
+// флаг AllowIncompleteSubtasks задачи TaskID (0 - без изменений) и/или
+// новая зависимость (TaskID = 0 - без нее)
+type taskGraphChange struct {
+	TaskID                  int
+	ParentID                *int
+	AllowIncompleteSubtasks bool
+	Dependency              models.TaskDependency
+}
+
+// checkTaskGraph проверяет, что после изменения ни одна задача не будет
+// ждать саму себя. Задача ждет блокирующие задачи свои и всех своих
+// предков (см. checkTaskCompletable), а родитель без
+// AllowIncompleteSubtasks - все свои подзадачи. Цикл через новые ребра
+// обязательно проходит через поддерево измененной задачи или предков
+// нового родителя, поэтому обход начинается только с них.
+func checkTaskGraph(ctx context.Context, q querier, userID int, change taskGraphChange) error {
+	var cycle bool
+	err := q.QueryRow(ctx,
+		`WITH RECURSIVE nodes AS (
+			SELECT id,
+				CASE WHEN id = $2 THEN $3::int ELSE parent_id END AS parent_id,
+				CASE WHEN id = $2 THEN $4::bool ELSE allow_incomplete_subtasks END AS allow_incomplete
+			FROM tasks
+			WHERE user_id = $1
+		), deps AS (
+			SELECT d.task_id, d.blocked_by
+			FROM task_dependencies d
+			JOIN nodes n ON n.id = d.task_id
+			UNION
+			SELECT $5::int, $6::int WHERE $5::int <> 0
+		), lineage AS (
+			SELECT id AS task_id, id AS ancestor_id, parent_id
+			FROM nodes
+			UNION
+			SELECT l.task_id, n.id, n.parent_id
+			FROM lineage l
+			JOIN nodes n ON n.id = l.parent_id
+		), waits AS (
+			SELECT l.task_id, d.blocked_by AS waits_for
+			FROM lineage l
+			JOIN deps d ON d.task_id = l.ancestor_id
+			UNION
+			SELECT l.ancestor_id, l.task_id
+			FROM lineage l
+			JOIN nodes n ON n.id = l.ancestor_id
+			WHERE l.task_id <> l.ancestor_id AND NOT n.allow_incomplete
+		), starts AS (
+			SELECT task_id AS id FROM lineage WHERE ancestor_id IN ($2, $5)
+			UNION
+			SELECT ancestor_id FROM lineage WHERE task_id = $3
+		), reach AS (
+			SELECT w.task_id AS start_id, w.waits_for
+			FROM waits w
+			JOIN starts s ON s.id = w.task_id
+			UNION
+			SELECT r.start_id, w.waits_for
+			FROM reach r
+			JOIN waits w ON w.task_id = r.waits_for
+		)
+		SELECT EXISTS(SELECT 1 FROM reach WHERE start_id = waits_for)`,
+		userID,
+		change.TaskID,
+		change.ParentID,
+		change.AllowIncompleteSubtasks,
+		change.Dependency.TaskID,
+		change.Dependency.BlockedBy,
+	).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("failed to check dependency cycle: %w", err)
+	}
+	if cycle {
+		return fmt.Errorf("dependency would create a cycle")
+	}
+	return nil
+}
+
+// dependentTask - задача с зависимостями и признаком блокировки, как в
+// GetTasks: после изменения зависимостей ее нужно разослать клиентам
+func dependentTask(ctx context.Context, q querier, taskID int) (models.Task, error) {
+	var task models.Task
+	row := q.QueryRow(ctx,
+		`WITH RECURSIVE lineage AS (
+			SELECT id, parent_id FROM tasks WHERE id = $1
+			UNION
+			SELECT t.id, t.parent_id
+			FROM tasks t
+			JOIN lineage l ON t.id = l.parent_id
+		)
+		SELECT `+taskColumns+`,
+			ARRAY(SELECT d.blocked_by
+				FROM task_dependencies d
+				WHERE d.task_id = tasks.id
+				ORDER BY d.blocked_by),
+			EXISTS(SELECT 1
+				FROM lineage l
+				JOIN task_dependencies d ON d.task_id = l.id
+				JOIN tasks b ON b.id = d.blocked_by
+				WHERE NOT b.completed)
+		FROM tasks
+		WHERE id = $1`,
+		taskID,
+	)
+	if err := scanTask(row, &task, &task.BlockedBy, &task.Blocked); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Task{}, fmt.Errorf("task not found")
+		}
+		return models.Task{}, fmt.Errorf("failed to get task: %w", err)
+	}
+	return task, nil
+}
+
+// AddTaskDependency блокирует задачу другой задачей того же пользователя.
+// Возвращает задачу с новыми зависимостями.
+func AddTaskDependency(dep models.TaskDependency, conn *pgxpool.Pool) (models.Task, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return models.Task{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	err = tx.QueryRow(ctx,
+		`SELECT user_id FROM tasks WHERE id = $1`,
+		dep.TaskID,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Task{}, fmt.Errorf("task not found")
+		}
+		return models.Task{}, fmt.Errorf("failed to get task: %w", err)
+	}
+	if err := lockTaskGraph(ctx, tx, userID); err != nil {
+		return models.Task{}, err
+	}
+
+	if err := checkTaskDependency(ctx, tx, userID, dep); err != nil {
+		return models.Task{}, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO task_dependencies (task_id, blocked_by)
+		VALUES ($1, $2)`,
+		dep.TaskID,
+		dep.BlockedBy,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return models.Task{}, fmt.Errorf("dependency already exists")
+		}
+		return models.Task{}, fmt.Errorf("failed to insert dependency: %w", err)
+	}
+
+	task, err := dependentTask(ctx, tx, dep.TaskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Task{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return task, nil
+}
+
+// DeleteTaskDependency возвращает задачу с оставшимися зависимостями
+func DeleteTaskDependency(dep models.TaskDependency, conn *pgxpool.Pool) (models.Task, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return models.Task{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM task_dependencies
+		WHERE task_id = $1 AND blocked_by = $2`,
+		dep.TaskID,
+		dep.BlockedBy,
+	)
+	if err != nil {
+		return models.Task{}, fmt.Errorf("failed to delete dependency: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.Task{}, fmt.Errorf("dependency not found")
+	}
+
+	task, err := dependentTask(ctx, tx, dep.TaskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Task{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return task, nil
+}
@@ -0,0 +1,143 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func AddTaskTemplate(template *models.TaskTemplate, conn *pgxpool.Pool) error {
+	tasks, err := json.Marshal(template.Tasks)
+	if err != nil {
+		return fmt.Errorf("failed to encode template tasks: %w", err)
+	}
+
+	err = conn.QueryRow(context.Background(),
+		`INSERT INTO task_templates (user_id, name, tasks)
+		VALUES ($1, $2, $3)
+		RETURNING template_id, created_at`,
+		template.UserID,
+		template.Name,
+		tasks,
+	).Scan(&template.ID, &template.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert task template: %w", err)
+	}
+	return nil
+}
+
+func GetTaskTemplates(userID int, conn *pgxpool.Pool) ([]models.TaskTemplate, error) {
+	templates := []models.TaskTemplate{}
+	rows, err := conn.Query(context.Background(),
+		`SELECT template_id, user_id, name, tasks, created_at
+		FROM task_templates
+		WHERE user_id = $1
+		ORDER BY template_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task templates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var template models.TaskTemplate
+		var tasks []byte
+		err := rows.Scan(
+			&template.ID,
+			&template.UserID,
+			&template.Name,
+			&tasks,
+			&template.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan task template: %w", err)
+		}
+		if err := json.Unmarshal(tasks, &template.Tasks); err != nil {
+			return nil, fmt.Errorf("failed to decode template tasks: %w", err)
+		}
+		templates = append(templates, template)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return templates, nil
+}
+
+func DeleteTaskTemplate(templateID int, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`DELETE FROM task_templates
+		WHERE template_id = $1`,
+		templateID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete task template: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("task template not found")
+	}
+	return nil
+}
+
+// ApplyTaskTemplate создает владельцу шаблона все задачи из него одной
+// транзакцией. Сроки считаются от start, а если он не задан - от
+// сегодняшнего дня по часам пользователя.
+func ApplyTaskTemplate(templateID int, start time.Time, conn *pgxpool.Pool) ([]models.Task, error) {
+	ctx := context.Background()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	var templateTasks []models.TemplateTask
+	var raw []byte
+	err = tx.QueryRow(ctx,
+		`SELECT user_id, tasks
+		FROM task_templates
+		WHERE template_id = $1`,
+		templateID,
+	).Scan(&userID, &raw)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task template not found")
+		}
+		return nil, fmt.Errorf("failed to get task template: %w", err)
+	}
+	if err := json.Unmarshal(raw, &templateTasks); err != nil {
+		return nil, fmt.Errorf("failed to decode template tasks: %w", err)
+	}
+
+	if start.IsZero() {
+		clock, err := userClock(ctx, tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		start = clock.Today(time.Now())
+	}
+
+	tasks := make([]models.Task, 0, len(templateTasks))
+	for _, templateTask := range templateTasks {
+		task := templateTask.Task(userID, start)
+		task.ID, err = insertTask(ctx, tx, task)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create task %q: %w", task.Name, err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,71 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"huibitica/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// taskColumns - колонки задачи в порядке scanTask. Время срока хранится
+// как TIME, а в модели - строкой "HH:MM".
+const taskColumns = `id, user_id, name, note, difficulty,
+	deadline, completed, completed_at, recurrence,
+	priority, start_date, COALESCE(to_char(deadline_time, 'HH24:MI'), ''),
+	deadline_timezone, estimated_minutes, parent_id, allow_incomplete_subtasks`
+
+// scanTask читает колонки taskColumns, а затем extra - дополнительные
+// колонки запроса, если они есть
+func scanTask(row pgx.Row, task *models.Task, extra ...any) error {
+	return row.Scan(append([]any{
+		&task.ID,
+		&task.UserID,
+		&task.Name,
+		&task.Note,
+		&task.Difficulty,
+		&task.Deadline,
+		&task.Completed,
+		&task.CompletedAt,
+		&task.Recurrence,
+		&task.Priority,
+		&task.StartDate,
+		&task.DeadlineTime,
+		&task.DeadlineTimezone,
+		&task.EstimatedMinutes,
+		&task.ParentID,
+		&task.AllowIncompleteSubtasks,
+	}, extra...)...)
+}
+
+// insertTask создает задачу и возвращает ее ID. Используется везде, где
+// задачи появляются: создание, импорт, испытания, шаблоны, повторы.
+func insertTask(ctx context.Context, q querier, task models.Task) (int, error) {
+	var id int
+	err := q.QueryRow(ctx,
+		`INSERT INTO tasks (
+			user_id, name, note, difficulty, deadline, recurrence,
+			priority, start_date, deadline_time, deadline_timezone,
+			estimated_minutes, parent_id, allow_incomplete_subtasks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, '')::time, $10, $11,
+			$12, $13)
+		RETURNING id`,
+		task.UserID,
+		task.Name,
+		task.Note,
+		task.Difficulty,
+		task.Deadline,
+		task.Recurrence,
+		task.Priority,
+		task.StartDate,
+		task.DeadlineTime,
+		task.DeadlineTimezone,
+		task.EstimatedMinutes,
+		task.ParentID,
+		task.AllowIncompleteSubtasks,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert task: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,77 @@
+package postgresql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	TokenScopeCalendar = "calendar"
+	TokenScopeStream   = "stream"
+)
+
+// IssueToken выдает пользователю новый токен для scope. Старые токены того же
+// scope отзываются, так что перевыпуск заодно закрывает утекшую ссылку.
+func IssueToken(userID int, scope string, conn *pgxpool.Pool) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(),
+		`DELETE FROM user_tokens
+		WHERE user_id = $1 AND scope = $2`,
+		userID,
+		scope,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	_, err = tx.Exec(context.Background(),
+		`INSERT INTO user_tokens (token, user_id, scope)
+		VALUES ($1, $2, $3)`,
+		token,
+		userID,
+		scope,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert token: %w", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return token, nil
+}
+
+func GetUserIDByToken(token string, scope string, conn *pgxpool.Pool) (int, error) {
+	var userID int
+	err := conn.QueryRow(context.Background(),
+		`SELECT user_id
+		FROM user_tokens
+		WHERE token = $1 AND scope = $2`,
+		token,
+		scope,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("invalid token")
+		}
+		return 0, fmt.Errorf("failed to get token: %w", err)
+	}
+	return userID, nil
+}
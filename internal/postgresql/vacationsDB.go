@@ -0,0 +1,68 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"huibitica/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func AddVacation(vacation *models.Vacation, conn *pgxpool.Pool) error {
+	err := conn.QueryRow(context.Background(),
+		`INSERT INTO vacations (user_id, start_date, end_date)
+		VALUES ($1, $2, $3)
+		RETURNING vacation_id, created_at`,
+		vacation.UserID,
+		vacation.StartDate,
+		vacation.EndDate,
+	).Scan(&vacation.ID, &vacation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert vacation: %w", err)
+	}
+	return nil
+}
+
+func GetVacations(userID int, conn *pgxpool.Pool) ([]models.Vacation, error) {
+	vacations := []models.Vacation{}
+	rows, err := conn.Query(context.Background(),
+		`SELECT vacation_id, user_id, start_date, end_date, created_at
+		FROM vacations
+		WHERE user_id = $1
+		ORDER BY start_date`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vacations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.Vacation
+		if err := rows.Scan(&v.ID, &v.UserID, &v.StartDate, &v.EndDate, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan vacation: %w", err)
+		}
+		vacations = append(vacations, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return vacations, nil
+}
+
+func DeleteVacation(id int, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`DELETE FROM vacations
+		WHERE vacation_id = $1`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete vacation: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("vacation not found")
+	}
+	return nil
+}
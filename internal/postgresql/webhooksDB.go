@@ -0,0 +1,221 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"huibitica/internal/models"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func AddWebhook(webhook models.Webhook, conn *pgxpool.Pool) (int, error) {
+	var id int
+	err := conn.QueryRow(context.Background(),
+		`INSERT INTO webhooks (user_id, url, secret, events, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		webhook.Events,
+		webhook.Active,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return id, nil
+}
+
+// GetWebhooks не возвращает секреты - они показываются только при создании
+func GetWebhooks(userID int, conn *pgxpool.Pool) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	rows, err := conn.Query(context.Background(),
+		`SELECT id, user_id, url, events, active, created_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook models.Webhook
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.UserID,
+			&webhook.URL,
+			&webhook.Events,
+			&webhook.Active,
+			&webhook.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+func DeleteWebhook(id int, conn *pgxpool.Pool) error {
+	tag, err := conn.Exec(context.Background(),
+		`DELETE FROM webhooks
+		WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+	return nil
+}
+
+// EnqueueWebhookDeliveries ставит событие в очередь для всех активных
+// вебхуков пользователя, подписанных на него.
+func EnqueueWebhookDeliveries(userID int, event string, payload []byte, conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(),
+		`INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2::text, $3::jsonb
+		FROM webhooks
+		WHERE user_id = $1 AND active AND ($2::text = ANY(events) OR '*' = ANY(events))`,
+		userID,
+		event,
+		payload,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries забирает до limit доставок, время которых пришло,
+// и откладывает их на lease - чтобы другой экземпляр сервера не отправил
+// их повторно, пока идет попытка.
+func ClaimWebhookDeliveries(limit int, lease time.Duration, conn *pgxpool.Pool) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	rows, err := conn.Query(context.Background(),
+		`UPDATE webhook_deliveries d
+		SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING d.id, d.webhook_id, w.url, w.secret, d.event,
+			d.payload, d.status, d.attempts, d.created_at`,
+		limit,
+		time.Now().Add(lease),
+		time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.URL,
+			&delivery.Secret,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func UpdateWebhookDelivery(delivery models.WebhookDelivery, conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(),
+		`UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3,
+			last_status = $4, last_error = $5, delivered_at = $6
+		WHERE id = $7`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatus,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries - журнал доставок пользователя, новые сверху.
+// webhookID = 0 - по всем вебхукам.
+func GetWebhookDeliveries(userID int, webhookID int, limit int, conn *pgxpool.Pool) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	rows, err := conn.Query(context.Background(),
+		`SELECT d.id, d.webhook_id, d.event, d.status, d.attempts,
+			d.next_attempt_at, d.last_status, d.last_error,
+			d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE w.user_id = $1 AND ($2 = 0 OR d.webhook_id = $2)
+		ORDER BY d.id DESC
+		LIMIT $3`,
+		userID,
+		webhookID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatus,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return deliveries, nil
+}
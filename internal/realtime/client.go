@@ -0,0 +1,347 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/ws"
+	"sync"
+	"time"
+)
+
+const (
+	// Сервер пингует клиента каждые pingInterval; если за readTimeout от
+	// клиента не пришло ни одного кадра, соединение закрывается
+	pingInterval = 25 * time.Second
+	readTimeout  = 60 * time.Second
+	writeTimeout = 10 * time.Second
+	// sendBuffer - сколько исходящих сообщений может ждать медленный
+	// клиент, прежде чем его отключат
+	sendBuffer = 64
+	replayPage = 500
+)
+
+// Протокол - JSON в текстовых кадрах, поле type определяет сообщение
+const (
+	typeSubscribe   = "subscribe"
+	typeUnsubscribe = "unsubscribe"
+	typeChat        = "chat"
+	typePing        = "ping"
+
+	typeSubscribed   = "subscribed"
+	typeUnsubscribed = "unsubscribed"
+	typeEvent        = "event"
+	typePresence     = "presence"
+	typePong         = "pong"
+	typeError        = "error"
+
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+type inbound struct {
+	Type        string `json:"type"`
+	Channel     string `json:"channel"`
+	Text        string `json:"text"`
+	LastEventID int64  `json:"last_event_id"`
+}
+
+type outbound struct {
+	Type     string               `json:"type"`
+	Channel  string               `json:"channel,omitempty"`
+	Event    *events.Event        `json:"event,omitempty"`
+	Message  *models.ChatMessage  `json:"message,omitempty"`
+	History  []models.ChatMessage `json:"history,omitempty"`
+	Presence []int                `json:"presence,omitempty"`
+	UserID   int                  `json:"user_id,omitempty"`
+	Status   string               `json:"status,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+type client struct {
+	server *Server
+	conn   *ws.Conn
+	userID int
+
+	out       chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+
+	mu       sync.Mutex
+	channels map[string]struct{}
+	events   *events.Subscription
+}
+
+func newClient(s *Server, conn *ws.Conn, userID int) *client {
+	conn.ReadTimeout = readTimeout
+	return &client{
+		server:    s,
+		conn:      conn,
+		userID:    userID,
+		out:       make(chan []byte, sendBuffer),
+		done:      make(chan struct{}),
+		closeCode: ws.CloseGoingAway,
+		channels:  map[string]struct{}{},
+	}
+}
+
+func (c *client) run() {
+	go c.writeLoop()
+	c.readLoop()
+	c.close(ws.CloseNormal)
+
+	c.mu.Lock()
+	channels := c.channels
+	c.channels = map[string]struct{}{}
+	sub := c.events
+	c.events = nil
+	c.mu.Unlock()
+
+	if sub != nil {
+		sub.Close()
+	}
+	for channel := range channels {
+		if channel != ChannelUser {
+			c.server.leave(c, channel)
+		}
+	}
+}
+
+// send ставит сообщение в очередь без блокировки. Клиента, который не
+// успевает читать, отключаем: держать для него растущую очередь нельзя,
+// а после переподключения он доберет события и историю чата.
+func (c *client) send(msg outbound) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.server.log.Error().Err(err).Msg("Failed to encode WebSocket message")
+		return
+	}
+
+	select {
+	case <-c.done:
+	case c.out <- data:
+	default:
+		c.server.log.Warn().Int("user_id", c.userID).Msg("WebSocket client is too slow, disconnecting")
+		c.close(ws.CloseTryAgainLater)
+	}
+}
+
+// sendWait ставит сообщение в очередь, дожидаясь места: так повтор
+// журнала идет со скоростью клиента, а не отключает его
+func (c *client) sendWait(msg outbound) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.done:
+		return ws.ErrClosed
+	case c.out <- data:
+		return nil
+	}
+}
+
+func (c *client) close(code int) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		close(c.done)
+	})
+}
+
+func (c *client) writeLoop() {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			c.conn.WriteClose(c.closeCode, "")
+			return
+		case data := <-c.out:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(ws.OpText, data); err != nil {
+				c.close(ws.CloseGoingAway)
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(ws.OpPing, nil); err != nil {
+				c.close(ws.CloseGoingAway)
+				return
+			}
+		}
+	}
+}
+
+func (c *client) readLoop() {
+	for {
+		opcode, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if opcode != ws.OpText {
+			c.send(outbound{Type: typeError, Error: "only text messages are supported"})
+			continue
+		}
+
+		var msg inbound
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.send(outbound{Type: typeError, Error: "invalid message"})
+			continue
+		}
+
+		switch msg.Type {
+		case typeSubscribe:
+			c.subscribe(msg)
+		case typeUnsubscribe:
+			c.unsubscribe(msg.Channel)
+		case typeChat:
+			c.chat(msg)
+		case typePing:
+			c.send(outbound{Type: typePong})
+		default:
+			c.send(outbound{Type: typeError, Error: "unknown message type"})
+		}
+	}
+}
+
+func (c *client) subscribed(channel string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.channels[channel]
+	return ok
+}
+
+func (c *client) subscribe(msg inbound) {
+	if c.subscribed(msg.Channel) {
+		c.send(outbound{Type: typeSubscribed, Channel: msg.Channel})
+		return
+	}
+	if err := c.server.authorize(c.userID, msg.Channel); err != nil {
+		c.send(outbound{Type: typeError, Channel: msg.Channel, Error: err.Error()})
+		return
+	}
+
+	if msg.Channel == ChannelUser {
+		c.subscribeEvents(msg.LastEventID)
+		return
+	}
+
+	history, err := postgresql.GetChatHistory(msg.Channel, historyLimit, c.server.db)
+	if err != nil {
+		c.server.log.Error().Int("user_id", c.userID).Str("channel", msg.Channel).Err(err).Msg("Failed to load chat history")
+		c.send(outbound{Type: typeError, Channel: msg.Channel, Error: "failed to load chat history"})
+		return
+	}
+
+	c.mu.Lock()
+	c.channels[msg.Channel] = struct{}{}
+	c.mu.Unlock()
+
+	presence := c.server.join(c, msg.Channel)
+	c.send(outbound{Type: typeSubscribed, Channel: msg.Channel, History: history, Presence: presence})
+}
+
+// subscribeEvents подписывает на события пользователя. Как и в SSE,
+// подписка оформляется до чтения журнала, а дубли отбрасываются по ID.
+func (c *client) subscribeEvents(lastEventID int64) {
+	sub := c.server.hub.Subscribe(c.userID)
+
+	c.mu.Lock()
+	c.channels[ChannelUser] = struct{}{}
+	c.events = sub
+	c.mu.Unlock()
+
+	c.send(outbound{Type: typeSubscribed, Channel: ChannelUser})
+
+	// Пропущенное отдается целиком, страницами. Если повтор не удался,
+	// соединение закрывается: иначе живые события скрыли бы пропуск, а так
+	// клиент переподключится с последнего полученного ID
+	if lastEventID > 0 {
+		var err error
+		lastEventID, err = c.server.hub.Replay(c.userID, lastEventID, replayPage, func(event events.Event) error {
+			return c.sendWait(outbound{Type: typeEvent, Channel: ChannelUser, Event: &event})
+		})
+		if errors.Is(err, ws.ErrClosed) {
+			return
+		}
+		if err != nil {
+			c.server.log.Error().Int("user_id", c.userID).Err(err).Msg("Failed to replay events")
+			c.close(ws.CloseTryAgainLater)
+			return
+		}
+	}
+
+	go func() {
+		for event := range sub.C {
+			if event.ID <= lastEventID {
+				continue
+			}
+			c.send(outbound{Type: typeEvent, Channel: ChannelUser, Event: &event})
+		}
+
+		// Подписку закрыл не клиент, а Hub - значит, клиент не успевал
+		c.mu.Lock()
+		dropped := c.events == sub
+		c.mu.Unlock()
+		if dropped {
+			c.close(ws.CloseTryAgainLater)
+		}
+	}()
+}
+
+func (c *client) unsubscribe(channel string) {
+	c.mu.Lock()
+	_, ok := c.channels[channel]
+	delete(c.channels, channel)
+	sub := c.events
+	if channel == ChannelUser {
+		c.events = nil
+	}
+	c.mu.Unlock()
+
+	if ok {
+		if channel == ChannelUser {
+			sub.Close()
+		} else {
+			c.server.leave(c, channel)
+		}
+	}
+	c.send(outbound{Type: typeUnsubscribed, Channel: channel})
+}
+
+func (c *client) chat(msg inbound) {
+	if msg.Channel == ChannelUser || !c.subscribed(msg.Channel) {
+		c.send(outbound{Type: typeError, Channel: msg.Channel, Error: "subscribe to the channel first"})
+		return
+	}
+
+	// Подписка могла пережить выход из группы (например, если отписка
+	// через NOTIFY потерялась), поэтому членство проверяется на каждое
+	// сообщение
+	if err := c.server.authorize(c.userID, msg.Channel); err != nil {
+		c.send(outbound{Type: typeError, Channel: msg.Channel, Error: err.Error()})
+		if errors.Is(err, ErrForbidden) {
+			c.unsubscribe(msg.Channel)
+		}
+		return
+	}
+
+	message := models.ChatMessage{Channel: msg.Channel, UserID: c.userID, Text: msg.Text}
+	if err := message.Validate(); err != nil {
+		c.send(outbound{Type: typeError, Channel: msg.Channel, Error: err.Error()})
+		return
+	}
+
+	// Сообщение придет обратно отправителю вместе со всеми через NOTIFY
+	if err := postgresql.AddChatMessage(&message, c.server.db); err != nil {
+		c.server.log.Error().Int("user_id", c.userID).Str("channel", msg.Channel).Err(err).Msg("Failed to save chat message")
+		c.send(outbound{Type: typeError, Channel: msg.Channel, Error: "failed to send message"})
+	}
+}
@@ -0,0 +1,248 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/ws"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// ChannelUser - личный канал с событиями пользователя из events.Hub
+	ChannelUser = "user"
+	// partyPrefix - каналы группы вида "party:<id>" с чатом и присутствием
+	partyPrefix = "party:"
+
+	historyLimit   = 50
+	reconnectDelay = 5 * time.Second
+)
+
+var ErrForbidden = errors.New("channel is not available")
+
+// Server - WebSocket-шлюз: личные события пользователя, чат и присутствие
+// в каналах групп. Сообщения чата сохраняются в chat_messages и расходятся
+// по экземплярам сервера через NOTIFY, как события в events.Hub.
+// Присутствие считается по соединениям этого экземпляра.
+type Server struct {
+	db  *pgxpool.Pool
+	log zerolog.Logger
+	hub *events.Hub
+
+	mu       sync.Mutex
+	channels map[string]map[*client]struct{}
+}
+
+func NewServer(db *pgxpool.Pool, log zerolog.Logger, hub *events.Hub) *Server {
+	return &Server{db: db, log: log, hub: hub, channels: map[string]map[*client]struct{}{}}
+}
+
+// Serve обслуживает соединение до его закрытия
+func (s *Server) Serve(conn *ws.Conn, userID int) {
+	c := newClient(s, conn, userID)
+	s.log.Info().Int("user_id", userID).Msg("WebSocket connected")
+	c.run()
+	s.log.Info().Int("user_id", userID).Msg("WebSocket disconnected")
+}
+
+// authorize проверяет, может ли пользователь подписаться на канал
+func (s *Server) authorize(userID int, channel string) error {
+	if channel == ChannelUser {
+		return nil
+	}
+	id, err := partyID(channel)
+	if err != nil {
+		return err
+	}
+	member, err := postgresql.IsPartyMember(id, userID, s.db)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func PartyChannel(partyID int) string {
+	return partyPrefix + strconv.Itoa(partyID)
+}
+
+// Kick отписывает все соединения пользователя от канала - например,
+// после выхода из группы. Соединения могут быть на других экземплярах,
+// поэтому отписка рассылается через NOTIFY; если разослать не удалось,
+// отписываются хотя бы соединения этого экземпляра.
+func (s *Server) Kick(userID int, channel string) {
+	if err := postgresql.NotifyKick(userID, channel, s.db); err != nil {
+		s.log.Error().Int("user_id", userID).Str("channel", channel).Err(err).Msg("Failed to broadcast kick")
+		s.kick(userID, channel)
+	}
+}
+
+func (s *Server) kick(userID int, channel string) {
+	s.mu.Lock()
+	var kicked []*client
+	for c := range s.channels[channel] {
+		if c.userID == userID {
+			kicked = append(kicked, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range kicked {
+		c.unsubscribe(channel)
+	}
+}
+
+func partyID(channel string) (int, error) {
+	if !strings.HasPrefix(channel, partyPrefix) {
+		return 0, fmt.Errorf("unknown channel %q", channel)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(channel, partyPrefix))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("unknown channel %q", channel)
+	}
+	return id, nil
+}
+
+// join добавляет клиента в канал и возвращает присутствующих.
+// Остальным рассылается presence, если это первое соединение пользователя.
+func (s *Server) join(c *client, channel string) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	online := s.online(channel, c.userID)
+	if s.channels[channel] == nil {
+		s.channels[channel] = map[*client]struct{}{}
+	}
+	s.channels[channel][c] = struct{}{}
+
+	if !online {
+		s.broadcast(channel, outbound{Type: typePresence, Channel: channel, UserID: c.userID, Status: statusOnline})
+	}
+	return s.presence(channel)
+}
+
+func (s *Server) leave(c *client, channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[channel][c]; !ok {
+		return
+	}
+	delete(s.channels[channel], c)
+	if len(s.channels[channel]) == 0 {
+		delete(s.channels, channel)
+	}
+
+	if !s.online(channel, c.userID) {
+		s.broadcast(channel, outbound{Type: typePresence, Channel: channel, UserID: c.userID, Status: statusOffline})
+	}
+}
+
+// online и presence вызываются под s.mu
+func (s *Server) online(channel string, userID int) bool {
+	for c := range s.channels[channel] {
+		if c.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) presence(channel string) []int {
+	seen := map[int]bool{}
+	users := []int{}
+	for c := range s.channels[channel] {
+		if !seen[c.userID] {
+			seen[c.userID] = true
+			users = append(users, c.userID)
+		}
+	}
+	sort.Ints(users)
+	return users
+}
+
+// broadcast вызывается под s.mu
+func (s *Server) broadcast(channel string, msg outbound) {
+	for c := range s.channels[channel] {
+		c.send(msg)
+	}
+}
+
+func (s *Server) dispatch(message models.ChatMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcast(message.Channel, outbound{Type: typeChat, Channel: message.Channel, Message: &message})
+}
+
+// Listen получает NOTIFY о новых сообщениях чата и отписках от всех
+// экземпляров сервера до отмены ctx, переподключаясь при обрыве
+func (s *Server) Listen(ctx context.Context) {
+	for {
+		if err := s.listen(ctx); err != nil && ctx.Err() == nil {
+			s.log.Error().Err(err).Msg("Chat listener failed, reconnecting")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (s *Server) listen(ctx context.Context) error {
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	for _, channel := range []string{postgresql.ChatChannel, postgresql.KickChannel} {
+		if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		if notification.Channel == postgresql.KickChannel {
+			userID, channel, _ := strings.Cut(notification.Payload, " ")
+			id, err := strconv.Atoi(userID)
+			if err != nil || channel == "" {
+				s.log.Warn().Str("payload", notification.Payload).Msg("Invalid kick notification")
+				continue
+			}
+			s.kick(id, channel)
+			continue
+		}
+
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			s.log.Warn().Str("payload", notification.Payload).Msg("Invalid chat notification")
+			continue
+		}
+
+		message, err := postgresql.GetChatMessage(id, s.db)
+		if err != nil {
+			s.log.Error().Int64("message_id", id).Err(err).Msg("Failed to load chat message")
+			continue
+		}
+		s.dispatch(*message)
+	}
+}
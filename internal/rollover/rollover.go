@@ -0,0 +1,208 @@
+package rollover
+
+import (
+	"context"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"huibitica/internal/schedule"
+	"huibitica/internal/webhooks"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// MaxCatchUpDays - за сколько последних дней подводятся итоги, если
+// смена дня не проводилась дольше (простой сервера). Более старые дни
+// пропускаются без наказания.
+const MaxCatchUpDays = 7
+
+// Worker проводит смену дня: раз в Interval находит пользователей, у
+// которых по их часам (schedule.Clock) наступил новый день, и подводит
+// итоги каждого прошедшего с прошлой смены дня - обнуляет счетчики привычек, у которых закончился
+// период, сдвигает силу привычек с одной кнопкой к нулю, сбрасывает
+// серии пропущенных ежедневных задач, наносит урон, а если группа
+// пользователя сражается с боссом, босс бьет всю группу. В дни отдыха
+// (отпуск, скрытность) пропуски не наказываются, а заморозки из
+// инвентаря спасают отдельные задачи.
+type Worker struct {
+	db       *pgxpool.Pool
+	log      zerolog.Logger
+	hub      *events.Hub
+	Interval time.Duration
+}
+
+func NewWorker(db *pgxpool.Pool, log zerolog.Logger, hub *events.Hub) *Worker {
+	return &Worker{db: db, log: log, hub: hub, Interval: 5 * time.Minute}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) RunOnce(ctx context.Context, now time.Time) {
+	clocks, err := postgresql.GetUserClocks(w.db)
+	if err != nil {
+		w.log.Error().Err(err).Msg("Failed to get user clocks")
+		return
+	}
+	days := make(map[int]time.Time, len(clocks))
+	for userID, clock := range clocks {
+		days[userID] = clock.Today(now)
+	}
+
+	users, err := postgresql.ClaimRollovers(days, w.db)
+	if err != nil {
+		w.log.Error().Err(err).Msg("Failed to claim rollovers")
+		return
+	}
+
+	for userID, lastDay := range users {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := w.rollover(ctx, userID, lastDay, days[userID]); err != nil {
+			w.log.Error().Int("user_id", userID).Err(err).Msg("Rollover failed")
+		}
+	}
+}
+
+// rollover подводит итоги дней с lastDay (день прошлой смены, нулевой -
+// первая смена) по вчерашний включительно, но не больше MaxCatchUpDays.
+// Дни обрабатываются по порядку, как если бы смены шли вовремя.
+func (w *Worker) rollover(ctx context.Context, userID int, lastDay time.Time, today time.Time) error {
+	from := today.AddDate(0, 0, -1)
+	if !lastDay.IsZero() {
+		from = schedule.Day(lastDay)
+		if earliest := today.AddDate(0, 0, -MaxCatchUpDays); from.Before(earliest) {
+			w.log.Warn().Int("user_id", userID).Time("last_day", lastDay).Int("days", MaxCatchUpDays).Msg("Rollover too far behind, skipping older days")
+			from = earliest
+		}
+	}
+
+	for day := from; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := w.rolloverDay(userID, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rolloverDay подводит итоги дня yesterday так, будто сейчас следующий
+// за ним день
+func (w *Worker) rolloverDay(userID int, yesterday time.Time) error {
+	today := yesterday.AddDate(0, 0, 1)
+
+	// Сброс счетчиков привычек не должен мешать итогам по ежедневным
+	// задачам: день уже занят ClaimRollovers, повтора не будет
+	reset, err := postgresql.ResetHabitCounts(userID, today, w.db)
+	if err != nil {
+		w.log.Error().Int("user_id", userID).Err(err).Msg("Failed to reset habit counters")
+	} else if reset > 0 {
+		w.log.Info().Int("user_id", userID).Int("habits", reset).Msg("Habit counters reset")
+	}
+	decayed, err := postgresql.DecayHabitValues(userID, w.db)
+	if err != nil {
+		w.log.Error().Int("user_id", userID).Err(err).Msg("Failed to decay habit values")
+	} else if decayed > 0 {
+		w.log.Info().Int("user_id", userID).Int("habits", decayed).Msg("Habit values decayed")
+	}
+
+	dailies, err := postgresql.GetDailies(userID, w.db)
+	if err != nil {
+		return err
+	}
+
+	var missed []models.Daily
+	for _, daily := range dailies {
+		if schedule.Missed(daily, yesterday) {
+			missed = append(missed, daily)
+		}
+	}
+	if len(missed) == 0 {
+		return nil
+	}
+
+	rest, err := postgresql.IsRestDay(userID, yesterday, w.db)
+	if err != nil {
+		return err
+	}
+	if rest {
+		w.log.Info().Int("user_id", userID).Int("missed", len(missed)).Msg("Missed dailies on a rest day")
+		return nil
+	}
+
+	frozen, result, err := postgresql.MissDailies(userID, missed, today, w.db)
+	if err != nil {
+		return err
+	}
+	frozenIDs := make(map[int]bool, len(frozen))
+	for _, daily := range frozen {
+		frozenIDs[daily.ID] = true
+	}
+	penalized := []models.Daily{}
+	missedDifficulty := 0
+	for _, daily := range missed {
+		if !frozenIDs[daily.ID] {
+			penalized = append(penalized, daily)
+			missedDifficulty += daily.Difficulty
+		}
+	}
+	w.log.Info().Int("user_id", userID).Int("missed", len(penalized)).Int("frozen", len(frozen)).Msg("Dailies missed")
+
+	w.emit(events.New(events.DailyMissed, userID, map[string]interface{}{
+		"day":     yesterday.Format(time.DateOnly),
+		"dailies": penalized,
+		"frozen":  frozen,
+		"result":  result,
+	}))
+	if result == nil {
+		return nil
+	}
+	w.emit(events.New(events.StatsUpdated, userID, result.Stats))
+
+	hit, err := postgresql.BossAttack(userID, missedDifficulty, w.db)
+	if err != nil {
+		return err
+	}
+	if hit != nil {
+		for _, member := range hit.Hits {
+			w.emit(events.New(events.QuestUpdated, member.Stats.UserID, map[string]interface{}{
+				"action":   "boss_attack",
+				"user_id":  userID,
+				"quest_id": hit.Quest.ID,
+				"damage":   hit.Damage,
+			}))
+			w.emit(events.New(events.StatsUpdated, member.Stats.UserID, member.Stats))
+		}
+	}
+	return nil
+}
+
+// emit - как handlers.emit: в поток событий и в вебхуки, ошибки
+// только логируются
+func (w *Worker) emit(event events.Event) {
+	event, err := w.hub.Publish(event)
+	if err != nil {
+		w.log.Error().Str("event", event.Type).Err(err).Msg("Failed to publish event")
+	}
+
+	if err := webhooks.Enqueue(event, w.db); err != nil {
+		w.log.Error().Str("event", event.Type).Err(err).Msg("Failed to enqueue webhooks")
+	}
+}
@@ -0,0 +1,90 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock - часы пользователя: его часовой пояс и час, с которого у него
+// начинается новый день. До DayStart по местному времени еще идет
+// вчерашний день - так засидевшийся за полночь не теряет серию.
+type Clock struct {
+	Location *time.Location
+	DayStart int
+}
+
+// UTC - часы по умолчанию для пользователей без настроек
+var UTC = Clock{Location: time.UTC}
+
+// NewClock проверяет настройки пользователя: timezone - имя из базы IANA
+// ("Europe/Moscow"), dayStart - час от 0 до 23
+func NewClock(timezone string, dayStart int) (Clock, error) {
+	if dayStart < 0 || dayStart > 23 {
+		return Clock{}, fmt.Errorf("day_start must be between 0 and 23")
+	}
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Clock{}, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	return Clock{Location: location, DayStart: dayStart}, nil
+}
+
+// Local - момент now по местному времени пользователя
+func (c Clock) Local(now time.Time) time.Time {
+	if c.Location == nil {
+		return now.UTC()
+	}
+	return now.In(c.Location)
+}
+
+// Today - текущий день пользователя в момент now как дата (см. Day).
+// Сравнивается час на настенных часах, а не прошедшее время, поэтому
+// переходы на летнее время не сдвигают границу дня.
+func (c Clock) Today(now time.Time) time.Time {
+	local := c.Local(now)
+	day := local.Day()
+	if local.Hour() < c.DayStart {
+		day--
+	}
+	return time.Date(local.Year(), local.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+// DayEnd - момент, когда по часам пользователя заканчивается день day:
+// DayStart следующего календарного дня по местному времени. Если этот
+// час пропущен переводом часов, день кончается в момент перевода - с
+// него Today уже показывает следующий день.
+func (c Clock) DayEnd(day time.Time) time.Time {
+	location := c.Location
+	if location == nil {
+		location = time.UTC
+	}
+	end := time.Date(day.Year(), day.Month(), day.Day()+1, c.DayStart, 0, 0, 0, location)
+	// Для несуществующего и повторяющегося времени time.Date выбирает
+	// одну из сторон перевода, не гарантируя какую. Сравниваем показания
+	// часов и берем момент перевода или первое из повторов.
+	want := time.Date(day.Year(), day.Month(), day.Day()+1, c.DayStart, 0, 0, 0, time.UTC)
+	start, next := end.ZoneBounds()
+	switch wallClock(end).Compare(want) {
+	case -1:
+		return next
+	case 1:
+		return start
+	}
+	if start.IsZero() {
+		return end
+	}
+	_, offset := end.Zone()
+	_, prevOffset := start.Add(-time.Second).Zone()
+	if earlier := end.Add(time.Duration(offset-prevOffset) * time.Second); earlier.Before(start) && wallClock(earlier).Equal(want) {
+		return earlier
+	}
+	return end
+}
+
+// wallClock - показания часов в момент t как время в UTC
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
@@ -0,0 +1,115 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustClock(t *testing.T, timezone string, dayStart int) Clock {
+	t.Helper()
+	clock, err := NewClock(timezone, dayStart)
+	if err != nil {
+		t.Fatalf("NewClock(%q, %d): %v", timezone, dayStart, err)
+	}
+	return clock
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func utc(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+// Переходы 2024 года: New York - 10 марта 02:00 EST -> 03:00 EDT и
+// 3 ноября 02:00 EDT -> 01:00 EST; Berlin - 31 марта 02:00 CET -> 03:00
+// CEST и 27 октября 03:00 CEST -> 02:00 CET
+func TestClockTodayAcrossDST(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		dayStart int
+		now      time.Time
+		want     time.Time
+	}{
+		{"NY before midnight on spring-forward eve", "America/New_York", 0, utc(2024, 3, 10, 4, 59), date(2024, 3, 9)},
+		{"NY right before the skipped hour", "America/New_York", 0, utc(2024, 3, 10, 6, 59), date(2024, 3, 10)},
+		{"NY day start in skipped hour, 01:59 EST", "America/New_York", 2, utc(2024, 3, 10, 6, 59), date(2024, 3, 9)},
+		{"NY day start in skipped hour, 03:00 EDT", "America/New_York", 2, utc(2024, 3, 10, 7, 0), date(2024, 3, 10)},
+		{"NY day start after gap, 03:59 EDT", "America/New_York", 4, utc(2024, 3, 10, 7, 59), date(2024, 3, 9)},
+		{"NY day start after gap, 04:00 EDT", "America/New_York", 4, utc(2024, 3, 10, 8, 0), date(2024, 3, 10)},
+		{"NY fall-back, 00:59 EDT", "America/New_York", 1, utc(2024, 11, 3, 4, 59), date(2024, 11, 2)},
+		{"NY fall-back, first 01:00 EDT", "America/New_York", 1, utc(2024, 11, 3, 5, 0), date(2024, 11, 3)},
+		{"NY fall-back, second 01:30 EST", "America/New_York", 1, utc(2024, 11, 3, 6, 30), date(2024, 11, 3)},
+		{"NY fall-back, repeated hour before day start", "America/New_York", 2, utc(2024, 11, 3, 6, 30), date(2024, 11, 2)},
+		{"Berlin day start in skipped hour, 01:59 CET", "Europe/Berlin", 2, utc(2024, 3, 31, 0, 59), date(2024, 3, 30)},
+		{"Berlin day start in skipped hour, 03:00 CEST", "Europe/Berlin", 2, utc(2024, 3, 31, 1, 0), date(2024, 3, 31)},
+		{"Berlin spring-forward, 03:30 CEST", "Europe/Berlin", 4, utc(2024, 3, 31, 1, 30), date(2024, 3, 30)},
+		{"Berlin spring-forward, 04:00 CEST", "Europe/Berlin", 4, utc(2024, 3, 31, 2, 0), date(2024, 3, 31)},
+		{"Berlin fall-back, first 02:30 CEST", "Europe/Berlin", 3, utc(2024, 10, 27, 0, 30), date(2024, 10, 26)},
+		{"Berlin fall-back, second 02:30 CET", "Europe/Berlin", 3, utc(2024, 10, 27, 1, 30), date(2024, 10, 26)},
+		{"Berlin fall-back, 03:00 CET", "Europe/Berlin", 3, utc(2024, 10, 27, 2, 0), date(2024, 10, 27)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := mustClock(t, tt.timezone, tt.dayStart)
+			if got := clock.Today(tt.now); !got.Equal(tt.want) {
+				t.Errorf("Today(%v) = %v, want %v", tt.now, got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+func TestClockDayEndAcrossDST(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		dayStart int
+		day      time.Time
+		want     time.Time
+	}{
+		{"NY midnight before spring-forward", "America/New_York", 0, date(2024, 3, 9), utc(2024, 3, 10, 5, 0)},
+		{"NY day start in skipped hour", "America/New_York", 2, date(2024, 3, 9), utc(2024, 3, 10, 7, 0)},
+		{"NY day start right after gap", "America/New_York", 3, date(2024, 3, 9), utc(2024, 3, 10, 7, 0)},
+		{"NY midnight after spring-forward", "America/New_York", 0, date(2024, 3, 10), utc(2024, 3, 11, 4, 0)},
+		{"NY day start in repeated hour", "America/New_York", 1, date(2024, 11, 2), utc(2024, 11, 3, 5, 0)},
+		{"NY day start after repeated hour", "America/New_York", 2, date(2024, 11, 2), utc(2024, 11, 3, 7, 0)},
+		{"NY midnight after fall-back", "America/New_York", 0, date(2024, 11, 3), utc(2024, 11, 4, 5, 0)},
+		{"Berlin day start in skipped hour", "Europe/Berlin", 2, date(2024, 3, 30), utc(2024, 3, 31, 1, 0)},
+		{"Berlin midnight after spring-forward", "Europe/Berlin", 0, date(2024, 3, 31), utc(2024, 3, 31, 22, 0)},
+		{"Berlin day start in repeated hour", "Europe/Berlin", 2, date(2024, 10, 26), utc(2024, 10, 27, 0, 0)},
+		{"Berlin midnight after fall-back", "Europe/Berlin", 0, date(2024, 10, 27), utc(2024, 10, 27, 23, 0)},
+		// В Чили переводят часы в полночь: 8 сентября 00:00 не было
+		{"Santiago skipped midnight", "America/Santiago", 0, date(2024, 9, 7), utc(2024, 9, 8, 4, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := mustClock(t, tt.timezone, tt.dayStart)
+			if got := clock.DayEnd(tt.day); !got.Equal(tt.want) {
+				t.Errorf("DayEnd(%s) = %v, want %v", tt.day.Format(time.DateOnly), got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+// DayEnd и Today должны сходиться в любой день при любом DayStart: в
+// момент DayEnd(d) уже идет следующий день, секундой раньше - еще d
+func TestClockDayEndMatchesToday(t *testing.T) {
+	for _, timezone := range []string{"UTC", "America/New_York", "Europe/Berlin", "America/Santiago", "Australia/Lord_Howe"} {
+		for dayStart := 0; dayStart < 24; dayStart++ {
+			clock := mustClock(t, timezone, dayStart)
+			for day := date(2024, 1, 1); day.Year() == 2024; day = day.AddDate(0, 0, 1) {
+				end := clock.DayEnd(day)
+				if got, want := clock.Today(end), day.AddDate(0, 0, 1); !got.Equal(want) {
+					t.Fatalf("%s day_start %d: Today(DayEnd(%s)) = %s, want %s", timezone, dayStart,
+						day.Format(time.DateOnly), got.Format(time.DateOnly), want.Format(time.DateOnly))
+				}
+				if got := clock.Today(end.Add(-time.Second)); !got.Equal(day) {
+					t.Fatalf("%s day_start %d: Today(DayEnd(%s) - 1s) = %s", timezone, dayStart,
+						day.Format(time.DateOnly), got.Format(time.DateOnly))
+				}
+			}
+		}
+	}
+}
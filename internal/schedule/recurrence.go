@@ -0,0 +1,74 @@
+package schedule
+
+import (
+	"huibitica/internal/models"
+	"slices"
+	"time"
+)
+
+// NextDeadline - срок следующего экземпляра повторяющейся задачи: первая
+// дата правила строго после after (срока текущего экземпляра, а не дня
+// выполнения - просроченная оплата за февраль не отменяет мартовскую).
+// rest - правило для следующего экземпляра: COUNT уменьшен на один, а
+// число месяца закреплено, чтобы срок 31-го не сползал на 28-е после
+// февраля, а ежегодный срок 29 февраля - на 28-е после невисокосного
+// года. ok = false, если повторы закончились по COUNT или UNTIL.
+func NextDeadline(rule models.Recurrence, after time.Time) (next time.Time, rest models.Recurrence, ok bool) {
+	if rule.Count == 1 {
+		return time.Time{}, rule, false
+	}
+	after = Day(after)
+	every := max(rule.Interval, 1)
+
+	switch rule.Freq {
+	case models.RepeatWeekly:
+		if len(rule.ByDay) == 0 {
+			next = after.AddDate(0, 0, 7*every)
+			break
+		}
+		// Подходящий день найдется не дальше чем через every недель
+		start := weekStart(after)
+		for day := after.AddDate(0, 0, 1); ; day = day.AddDate(0, 0, 1) {
+			weeks := int(weekStart(day).Sub(start).Hours()/24) / 7
+			if weeks%every == 0 && slices.Contains(rule.ByDay, day.Weekday()) {
+				next = day
+				break
+			}
+		}
+	case models.RepeatMonthly:
+		if rule.ByMonthDay == 0 {
+			rule.ByMonthDay = after.Day()
+		}
+		for months := 0; ; months += every {
+			month := time.Date(after.Year(), after.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+			day := rule.ByMonthDay
+			if day < 0 {
+				day = 31
+			}
+			next = time.Date(month.Year(), month.Month(), clampDay(month, day), 0, 0, 0, 0, time.UTC)
+			if next.After(after) {
+				break
+			}
+		}
+	case models.RepeatYearly:
+		if rule.ByMonthDay == 0 {
+			rule.ByMonthDay = after.Day()
+		}
+		day := rule.ByMonthDay
+		if day < 0 {
+			day = 31
+		}
+		year := time.Date(after.Year()+every, after.Month(), 1, 0, 0, 0, 0, time.UTC)
+		next = time.Date(year.Year(), year.Month(), clampDay(year, day), 0, 0, 0, 0, time.UTC)
+	default:
+		next = after.AddDate(0, 0, every)
+	}
+
+	if !rule.Until.IsZero() && next.After(Day(rule.Until)) {
+		return time.Time{}, rule, false
+	}
+	if rule.Count > 0 {
+		rule.Count--
+	}
+	return next, rule, true
+}
@@ -0,0 +1,42 @@
+package schedule
+
+import (
+	"huibitica/internal/models"
+	"testing"
+	"time"
+)
+
+// Срок по правилу не должен сползать: 31-е после февраля и 29 февраля
+// после невисокосного года возвращаются к закрепленному числу
+func TestNextDeadlineKeepsDay(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		first time.Time
+		want  []time.Time
+	}{
+		{"monthly on the 31st", "FREQ=MONTHLY", date(2024, 1, 31),
+			[]time.Time{date(2024, 2, 29), date(2024, 3, 31), date(2024, 4, 30), date(2024, 5, 31)}},
+		{"yearly on Feb 29", "FREQ=YEARLY", date(2024, 2, 29),
+			[]time.Time{date(2025, 2, 28), date(2026, 2, 28), date(2027, 2, 28), date(2028, 2, 29)}},
+	}
+	for _, tt := range tests {
+		rule, err := models.ParseRecurrence(tt.rule)
+		if err != nil {
+			t.Fatalf("%s: ParseRecurrence(%q): %v", tt.name, tt.rule, err)
+		}
+		deadline := tt.first
+		for i, want := range tt.want {
+			next, rest, ok := NextDeadline(rule, deadline)
+			if !ok || !next.Equal(want) {
+				t.Fatalf("%s: instance %d = %s %v, want %s", tt.name, i+1, next.Format(time.DateOnly), ok, want.Format(time.DateOnly))
+			}
+			// Правило хранится у задачи строкой, поэтому проходит через String
+			rule, err = models.ParseRecurrence(rest.String())
+			if err != nil {
+				t.Fatalf("%s: ParseRecurrence(%q): %v", tt.name, rest.String(), err)
+			}
+			deadline = next
+		}
+	}
+}
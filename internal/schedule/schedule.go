@@ -0,0 +1,147 @@
+package schedule
+
+import (
+	"huibitica/internal/models"
+	"strings"
+	"time"
+)
+
+// Day отбрасывает время, оставляя календарную дату в UTC. Все сравнения
+// дат в пакете идут через нее.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// IsDue сообщает, нужно ли выполнять ежедневную задачу в день day
+// по правилам RepeatEvery/RepeatEveryX/DayWeeks.
+func IsDue(daily models.Daily, day time.Time) bool {
+	start := Day(daily.StartDate)
+	day = Day(day)
+	if day.Before(start) {
+		return false
+	}
+
+	every := max(daily.RepeatEveryX, 1)
+
+	switch daily.RepeatEvery {
+	case models.RepeatWeekly:
+		// Недели считаются от понедельника недели начала
+		weeks := int(day.Sub(weekStart(start)).Hours()/24) / 7
+		if weeks%every != 0 {
+			return false
+		}
+		if daily.DayWeeks == "" {
+			return day.Weekday() == start.Weekday()
+		}
+		return HasWeekDay(daily.DayWeeks, day.Weekday())
+	case models.RepeatMonthly:
+		months := (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+		return months%every == 0 && day.Day() == clampDay(day, start.Day())
+	case models.RepeatYearly:
+		years := day.Year() - start.Year()
+		return years%every == 0 && day.Month() == start.Month() && day.Day() == clampDay(day, start.Day())
+	default:
+		days := int(day.Sub(start).Hours() / 24)
+		return days%every == 0
+	}
+}
+
+// HasWeekDay проверяет, есть ли день недели в строке вида "mon,wed,fri"
+func HasWeekDay(dayWeeks string, weekday time.Weekday) bool {
+	for _, day := range strings.Split(dayWeeks, ",") {
+		if strings.EqualFold(strings.TrimSpace(day), models.WeekDays[weekday]) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompletedOn - была ли задача отмечена выполненной в день day
+func CompletedOn(daily models.Daily, day time.Time) bool {
+	return daily.LastCompleted != nil && Day(*daily.LastCompleted).Equal(Day(day))
+}
+
+// Missed - задача была положена в день day, но не выполнена. Храним
+// только дату последнего выполнения, поэтому если задачу уже отметили
+// позже day, пропуск не засчитывается.
+func Missed(daily models.Daily, day time.Time) bool {
+	if !IsDue(daily, day) {
+		return false
+	}
+	return daily.LastCompleted == nil || Day(*daily.LastCompleted).Before(Day(day))
+}
+
+// Progress считает выполнение за день day: сколько ежедневных задач
+// положено, сколько из них отмечено и сколько задач закрыто
+func Progress(dailies []models.Daily, tasks []models.Task, day time.Time) models.DayProgress {
+	var progress models.DayProgress
+	for _, daily := range dailies {
+		if !IsDue(daily, day) {
+			continue
+		}
+		progress.DailiesDue++
+		if CompletedOn(daily, day) {
+			progress.DailiesDone++
+		}
+	}
+	for _, task := range tasks {
+		if task.CompletedAt != nil && Day(*task.CompletedAt).Equal(Day(day)) {
+			progress.TasksCompleted++
+		}
+	}
+	return progress
+}
+
+// PeriodStart - первый день периода сброса счетчиков привычки
+// (models.Reset*), в который попадает day. Недели начинаются с firstDay.
+// У ResetNever периодов нет, для него возвращается нулевое время.
+func PeriodStart(period string, day time.Time, firstDay time.Weekday) time.Time {
+	day = Day(day)
+	switch period {
+	case models.ResetDaily:
+		return day
+	case models.ResetWeekly:
+		offset := (int(day.Weekday()) - int(firstDay) + 7) % 7
+		return day.AddDate(0, 0, -offset)
+	case models.ResetMonthly:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Time{}
+	}
+}
+
+// CurrentCounts - привычка со счетчиками на день today. Если с
+// CountsSince начался новый период, а сброс еще не прошел (его делают
+// смена дня и отметка привычки), счетчики прошлого периода не
+// показываются.
+func CurrentCounts(habit models.Habit, today time.Time, firstDay time.Weekday) models.Habit {
+	start := PeriodStart(habit.CountReset, today, firstDay)
+	if start.IsZero() || !Day(habit.CountsSince).Before(start) {
+		return habit
+	}
+	habit.GoodCount = 0
+	habit.BadCount = 0
+	habit.CountsSince = start
+	return habit
+}
+
+// ParseWeekDay - день недели по ключу из models.WeekDays
+func ParseWeekDay(name string) (time.Weekday, bool) {
+	for i, day := range models.WeekDays {
+		if strings.EqualFold(day, name) {
+			return time.Weekday(i), true
+		}
+	}
+	return time.Sunday, false
+}
+
+func weekStart(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// clampDay переносит 31-е число на последний день короткого месяца
+func clampDay(month time.Time, day int) int {
+	last := time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return min(day, last)
+}
@@ -0,0 +1,78 @@
+package schedule
+
+import (
+	"cmp"
+	"huibitica/internal/models"
+	"slices"
+	"time"
+)
+
+// DueAt - момент срока задачи. Со временем DeadlineTime срок отсчитывается
+// в поясе DeadlineTimezone (по умолчанию - в поясе пользователя), без
+// времени истекает в конце дня Deadline по часам пользователя.
+func DueAt(task models.Task, clock Clock) time.Time {
+	deadline := Day(task.Deadline)
+	if task.DeadlineTime == "" {
+		return clock.DayEnd(deadline)
+	}
+
+	location := clock.Location
+	if task.DeadlineTimezone != "" {
+		if zone, err := time.LoadLocation(task.DeadlineTimezone); err == nil {
+			location = zone
+		}
+	}
+	if location == nil {
+		location = time.UTC
+	}
+	at, err := time.Parse("15:04", task.DeadlineTime)
+	if err != nil {
+		return clock.DayEnd(deadline)
+	}
+	return time.Date(deadline.Year(), deadline.Month(), deadline.Day(), at.Hour(), at.Minute(), 0, 0, location)
+}
+
+// Agenda - план на сегодня: невыполненные и незаблокированные задачи,
+// которые уже начаты (StartDate не позже сегодня) или чей срок сегодня
+// либо уже прошел. Сначала высокий приоритет, внутри - ближайший срок.
+func Agenda(tasks []models.Task, clock Clock, now time.Time) []models.Task {
+	today := clock.Today(now)
+	agenda := []models.Task{}
+	for _, task := range tasks {
+		if task.Completed || task.Blocked {
+			continue
+		}
+		started := task.StartDate != nil && !Day(*task.StartDate).After(today)
+		if started || !Day(task.Deadline).After(today) {
+			agenda = append(agenda, task)
+		}
+	}
+	slices.SortStableFunc(agenda, func(a, b models.Task) int {
+		return cmp.Or(
+			cmp.Compare(b.Priority, a.Priority),
+			DueAt(a, clock).Compare(DueAt(b, clock)),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+	return agenda
+}
+
+// Overdue - невыполненные и незаблокированные задачи, срок которых истек
+// к моменту now, от самых давних. Заблокированную задачу пока нельзя
+// выполнить, поэтому, как и в Agenda, она не показывается.
+func Overdue(tasks []models.Task, clock Clock, now time.Time) []models.Task {
+	overdue := []models.Task{}
+	for _, task := range tasks {
+		if !task.Completed && !task.Blocked && DueAt(task, clock).Before(now) {
+			overdue = append(overdue, task)
+		}
+	}
+	slices.SortStableFunc(overdue, func(a, b models.Task) int {
+		return cmp.Or(
+			DueAt(a, clock).Compare(DueAt(b, clock)),
+			cmp.Compare(b.Priority, a.Priority),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+	return overdue
+}
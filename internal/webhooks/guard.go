@@ -0,0 +1,93 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Адреса вебхуков задают пользователи, поэтому сервер не должен ходить по
+// ним во внутреннюю сеть: на loopback, в частные сети, на link-local (там
+// живут метаданные облаков, 169.254.169.254) и прочие служебные диапазоны.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 - внутри может быть что угодно
+}
+
+// PublicIP - можно ли отправлять вебхук на адрес ip
+func PublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL проверяет адрес вебхука при сохранении: абсолютный http(s) URL,
+// все адреса хоста публичные. Окончательная проверка - при соединении
+// (NewClient), ведь DNS может начать отвечать иначе.
+func CheckURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("url host cannot be resolved")
+	}
+	for _, addr := range addrs {
+		if !PublicIP(addr) {
+			return fmt.Errorf("url must not point to a private or loopback address")
+		}
+	}
+	return nil
+}
+
+// NewClient - HTTP-клиент для вебхуков, который отказывается соединяться с
+// непубличными адресами. Проверяется уже разрешенный адрес прямо перед
+// соединением, поэтому подмена DNS после CheckURL не помогает. Прокси из
+// окружения не используется: иначе проверялся бы адрес прокси.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("webhook address %q: %w", address, err)
+			}
+			if !PublicIP(addrPort.Addr()) {
+				return fmt.Errorf("webhook address %s is not public", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// Редиректы не выполняются: 3xx считается неудачной доставкой
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
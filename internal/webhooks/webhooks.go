@@ -0,0 +1,205 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"huibitica/internal/events"
+	"huibitica/internal/models"
+	"huibitica/internal/postgresql"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+const (
+	SignatureHeader = "X-Huibitica-Signature"
+	EventHeader     = "X-Huibitica-Event"
+	DeliveryHeader  = "X-Huibitica-Delivery"
+
+	MaxAttempts = 8
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// Sign возвращает подпись тела запроса: "sha256=" + hex(HMAC-SHA256(secret, body)).
+// Получатель считает ее сам и сравнивает с заголовком X-Huibitica-Signature.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func NewSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// Backoff - задержка перед попыткой attempt+1: 30s, 1m, 2m, 4m... но не больше 6h
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		return 0
+	}
+	delay := baseBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
+
+// Enqueue ставит событие в очередь доставки всем подписанным вебхукам
+func Enqueue(event events.Event, conn *pgxpool.Pool) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	return postgresql.EnqueueWebhookDeliveries(event.UserID, event.Type, payload, conn)
+}
+
+// Deliver отправляет одну доставку и возвращает HTTP-статус ответа.
+// Успехом считается любой 2xx.
+func Deliver(ctx context.Context, client *http.Client, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "huibitica-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Worker периодически забирает доставки из очереди и отправляет их,
+// до Concurrency одновременно. Несколько экземпляров сервера могут
+// работать с одной очередью.
+type Worker struct {
+	db          *pgxpool.Pool
+	log         zerolog.Logger
+	Client      *http.Client
+	Interval    time.Duration
+	BatchSize   int
+	Concurrency int
+}
+
+func NewWorker(db *pgxpool.Pool, log zerolog.Logger) *Worker {
+	return &Worker{
+		db:          db,
+		log:         log,
+		Client:      NewClient(10 * time.Second),
+		Interval:    5 * time.Second,
+		BatchSize:   50,
+		Concurrency: 10,
+	}
+}
+
+func (wk *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(wk.Interval)
+	defer ticker.Stop()
+
+	for {
+		wk.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lease - на сколько откладываются забранные доставки. Пачка
+// отправляется волнами по Concurrency штук, каждая волна - не дольше
+// таймаута клиента; сверху запас на запись результатов. Пока lease не
+// истек, другой экземпляр те же доставки не заберет.
+func (wk *Worker) Lease() time.Duration {
+	concurrency := max(wk.Concurrency, 1)
+	waves := (wk.BatchSize + concurrency - 1) / concurrency
+	return time.Duration(waves)*wk.Client.Timeout + time.Minute
+}
+
+func (wk *Worker) RunOnce(ctx context.Context) {
+	deliveries, err := postgresql.ClaimWebhookDeliveries(wk.BatchSize, wk.Lease(), wk.db)
+	if err != nil {
+		wk.log.Error().Err(err).Msg("Failed to claim webhook deliveries")
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(wk.Concurrency, 1))
+	for _, delivery := range deliveries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			status, err := Deliver(ctx, wk.Client, delivery)
+			wk.record(delivery, status, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func (wk *Worker) record(delivery models.WebhookDelivery, status int, deliveryErr error) {
+	delivery = Attempted(delivery, status, deliveryErr, time.Now())
+	if deliveryErr != nil {
+		wk.log.Warn().Int("delivery_id", delivery.ID).Int("attempts", delivery.Attempts).Err(deliveryErr).Msg("Webhook delivery failed")
+	}
+
+	if err := postgresql.UpdateWebhookDelivery(delivery, wk.db); err != nil {
+		wk.log.Error().Int("delivery_id", delivery.ID).Err(err).Msg("Failed to record webhook delivery")
+	}
+}
+
+// Attempted - состояние доставки после попытки в момент now: доставлена,
+// отложена на Backoff или, после MaxAttempts, провалена
+func Attempted(delivery models.WebhookDelivery, status int, deliveryErr error, now time.Time) models.WebhookDelivery {
+	delivery.Attempts++
+	delivery.LastStatus = status
+	delivery.NextAttemptAt = now
+
+	switch {
+	case deliveryErr == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = models.Truncate(deliveryErr.Error(), 255)
+	default:
+		delivery.Status = models.DeliveryPending
+		delivery.LastError = models.Truncate(deliveryErr.Error(), 255)
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+	}
+	return delivery
+}
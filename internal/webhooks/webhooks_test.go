@@ -0,0 +1,183 @@
+package webhooks
+
+import (
+	"context"
+	"huibitica/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliverRetriesUntilSuccess(t *testing.T) {
+	const failures = 2
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(SignatureHeader), Sign("secret", body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if got := r.Header.Get(EventHeader); got != "task.completed" {
+			t.Errorf("event header = %q, want task.completed", got)
+		}
+		if got := r.Header.Get(DeliveryHeader); got != "7" {
+			t.Errorf("delivery header = %q, want 7", got)
+		}
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	delivery := models.WebhookDelivery{
+		ID:      7,
+		URL:     server.URL,
+		Secret:  "secret",
+		Event:   "task.completed",
+		Payload: []byte(`{"type":"task.completed"}`),
+		Status:  models.DeliveryPending,
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for attempt := 1; attempt <= failures; attempt++ {
+		status, err := Deliver(context.Background(), server.Client(), delivery)
+		if err == nil || status != http.StatusInternalServerError {
+			t.Fatalf("attempt %d: status %d, err %v, want 500 and an error", attempt, status, err)
+		}
+		delivery = Attempted(delivery, status, err, now)
+		if delivery.Status != models.DeliveryPending || delivery.Attempts != attempt {
+			t.Fatalf("attempt %d: status %q, attempts %d", attempt, delivery.Status, delivery.Attempts)
+		}
+		if want := now.Add(Backoff(attempt)); !delivery.NextAttemptAt.Equal(want) {
+			t.Errorf("attempt %d: next attempt at %v, want %v", attempt, delivery.NextAttemptAt, want)
+		}
+		if delivery.LastError == "" {
+			t.Errorf("attempt %d: last error is empty", attempt)
+		}
+	}
+
+	status, err := Deliver(context.Background(), server.Client(), delivery)
+	if err != nil {
+		t.Fatalf("final attempt: %v", err)
+	}
+	delivery = Attempted(delivery, status, err, now)
+	if delivery.Status != models.DeliveryDelivered || delivery.DeliveredAt == nil || delivery.LastError != "" {
+		t.Errorf("final attempt: status %q, delivered at %v, last error %q", delivery.Status, delivery.DeliveredAt, delivery.LastError)
+	}
+	if got := calls.Load(); got != failures+1 {
+		t.Errorf("server got %d requests, want %d", got, failures+1)
+	}
+}
+
+func TestAttemptedGivesUp(t *testing.T) {
+	delivery := models.WebhookDelivery{Attempts: MaxAttempts - 1, Status: models.DeliveryPending}
+	delivery = Attempted(delivery, http.StatusBadGateway, io.ErrUnexpectedEOF, time.Now())
+	if delivery.Status != models.DeliveryFailed {
+		t.Errorf("status = %q after %d attempts, want %q", delivery.Status, delivery.Attempts, models.DeliveryFailed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 0},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestLeaseCoversBatch(t *testing.T) {
+	wk := &Worker{Client: &http.Client{Timeout: 10 * time.Second}, BatchSize: 50, Concurrency: 10}
+	// 5 волн по 10 доставок, каждая до 10 секунд
+	if got := wk.Lease(); got < 50*time.Second {
+		t.Errorf("Lease() = %v, shorter than the batch can take", got)
+	}
+	wk.Concurrency = 0
+	if got := wk.Lease(); got < 500*time.Second {
+		t.Errorf("sequential Lease() = %v, shorter than the batch can take", got)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := PublicIP(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("PublicIP(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://93.184.216.34/hook", false},
+		{"ftp://93.184.216.34/hook", true},
+		{"/hook", true},
+		{"http://127.0.0.1:8081/api", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://[::1]/", true},
+		{"http://10.0.0.5/", true},
+		{"http://localhost/", true},
+	}
+	for _, tt := range tests {
+		err := CheckURL(context.Background(), tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckURL(%q) = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+// Даже если адрес прошел CheckURL, клиент не должен соединиться с
+// loopback - например, после смены DNS-записи
+func TestClientRefusesLoopback(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	delivery := models.WebhookDelivery{ID: 1, URL: server.URL, Secret: "secret", Payload: []byte(`{}`)}
+	if _, err := Deliver(context.Background(), NewClient(time.Second), delivery); err == nil {
+		t.Fatal("delivery to loopback succeeded")
+	}
+	if calls.Load() != 0 {
+		t.Error("loopback server received a request")
+	}
+}
@@ -0,0 +1,316 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Минимальная серверная реализация WebSocket (RFC 6455): без расширений
+// и подпротоколов, только то, что нужно нашему API.
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseInvalidData   = 1007
+	ClosePolicy        = 1008
+	CloseTooBig        = 1009
+	CloseTryAgainLater = 1013
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var ErrClosed = errors.New("websocket closed")
+
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// MaxMessageSize ограничивает размер собранного сообщения
+	MaxMessageSize int64
+	// ReadTimeout, если задан, продлевает дедлайн чтения перед каждым
+	// кадром - в том числе pong, так что живой клиент не отвалится
+	ReadTimeout time.Duration
+
+	writeMu sync.Mutex
+}
+
+// Upgrade проверяет рукопожатие и забирает соединение у net/http.
+// allowedOrigins - сайты, с которых браузер может открыть соединение (см.
+// CheckOrigin).
+func Upgrade(w http.ResponseWriter, r *http.Request, allowedOrigins []string) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("websocket: method %s", r.Method)
+	}
+	if !CheckOrigin(r, allowedOrigins) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("websocket: origin %q not allowed", r.Header.Get("Origin"))
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Upgrade required", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("websocket: invalid key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket is not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: response does not support hijacking")
+	}
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack failed: %w", err)
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: handshake failed: %w", err)
+	}
+
+	return &Conn{conn: netConn, br: rw.Reader, MaxMessageSize: 64 << 10}, nil
+}
+
+// CheckOrigin разрешает запросы без Origin (не из браузера), со своего
+// хоста и с адресов из allowed (схема и хост, без учета регистра)
+func CheckOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allow := range allowed {
+		if strings.EqualFold(strings.TrimRight(allow, "/"), u.Scheme+"://"+u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// ReadMessage возвращает следующее текстовое или бинарное сообщение.
+// Текстовое сообщение не в UTF-8 закрывает соединение с кодом 1007.
+// Ping отвечается автоматически, pong только продлевает ReadTimeout.
+// Close от клиента подтверждается и возвращается как ErrClosed.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var opcode int
+	var message []byte
+
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err := c.WriteMessage(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.WriteClose(code, "")
+			return 0, nil, ErrClosed
+		case OpText, OpBinary:
+			if message != nil {
+				c.WriteClose(CloseProtocolError, "expected continuation frame")
+				return 0, nil, fmt.Errorf("websocket: unexpected data frame")
+			}
+			opcode = op
+			message = payload
+		case OpContinuation:
+			if message == nil {
+				c.WriteClose(CloseProtocolError, "unexpected continuation frame")
+				return 0, nil, fmt.Errorf("websocket: unexpected continuation frame")
+			}
+			message = append(message, payload...)
+		default:
+			c.WriteClose(CloseProtocolError, "unknown opcode")
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", op)
+		}
+
+		if int64(len(message)) > c.MaxMessageSize {
+			c.WriteClose(CloseTooBig, "message too big")
+			return 0, nil, fmt.Errorf("websocket: message too big")
+		}
+		if fin {
+			if opcode == OpText && !utf8.Valid(message) {
+				c.WriteClose(CloseInvalidData, "invalid UTF-8")
+				return 0, nil, fmt.Errorf("websocket: invalid UTF-8 in text message")
+			}
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	if c.ReadTimeout > 0 {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.ReadTimeout)); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		c.WriteClose(CloseProtocolError, "reserved bits set")
+		return false, 0, nil, fmt.Errorf("websocket: reserved bits set")
+	}
+	opcode = int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7F)
+
+	// Клиент обязан маскировать кадры
+	if !masked {
+		c.WriteClose(CloseProtocolError, "frames must be masked")
+		return false, 0, nil, fmt.Errorf("websocket: unmasked client frame")
+	}
+	if opcode >= OpClose && (!fin || length > 125) {
+		c.WriteClose(CloseProtocolError, "invalid control frame")
+		return false, 0, nil, fmt.Errorf("websocket: invalid control frame")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if length < 0 || length > c.MaxMessageSize {
+		c.WriteClose(CloseTooBig, "message too big")
+		return false, 0, nil, fmt.Errorf("websocket: frame too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage отправляет сообщение одним кадром. Безопасен для вызова
+// из нескольких горутин.
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|byte(opcode))
+	switch {
+	case len(data) <= 125:
+		header = append(header, byte(len(data)))
+	case len(data) <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(data)))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(len(data)))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if _, err := c.conn.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	return c.WriteMessage(OpClose, payload)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}